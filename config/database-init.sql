@@ -31,6 +31,21 @@ CREATE TABLE IF NOT EXISTS users (
     CONSTRAINT chk_user_type CHECK (user_type IN ('web', 'mobile'))
 );
 
+-- Create devices table (one row per enrolled device; a user can have several)
+CREATE TABLE IF NOT EXISTS devices (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform VARCHAR(50),
+    model VARCHAR(255),
+    os_version VARCHAR(50),
+    app_version VARCHAR(50),
+    device_info JSONB,
+    enrolled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 -- Create enrollment_tokens table
 CREATE TABLE IF NOT EXISTS enrollment_tokens (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -63,6 +78,9 @@ CREATE TABLE IF NOT EXISTS messages (
     CONSTRAINT chk_status CHECK (status IN ('pending_sync', 'synced', 'read'))
 );
 
+-- Deletes must log sender_id and recipient_id to reach devices as tombstones
+ALTER TABLE messages REPLICA IDENTITY FULL;
+
 -- Create sync_metadata table
 CREATE TABLE IF NOT EXISTS sync_metadata (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -83,6 +101,7 @@ CREATE INDEX IF NOT EXISTS idx_enrollment_tokens_used_at ON enrollment_tokens(us
 
 CREATE INDEX IF NOT EXISTS idx_users_user_type ON users(user_type);
 CREATE INDEX IF NOT EXISTS idx_users_device_id ON users(device_id) WHERE device_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id);
 CREATE INDEX IF NOT EXISTS idx_users_enrollment_token ON users(enrollment_token_id) WHERE enrollment_token_id IS NOT NULL;
 
 CREATE INDEX IF NOT EXISTS idx_messages_sender ON messages(sender_id);
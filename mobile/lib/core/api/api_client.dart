@@ -1,11 +1,26 @@
+import 'dart:convert';
+import 'dart:io';
+
 import 'package:dio/dio.dart';
 import 'package:flutter/foundation.dart';
 import 'package:shared_preferences/shared_preferences.dart';
+import 'package:zstandard/zstandard.dart';
 
 class APIClient {
+  // Uploads larger than this are sent compressed, matching the server's
+  // sync.compression_threshold
+  static const _compressionThreshold = 1024;
+
+  // Codings accepted for sync responses. gzip bodies are decompressed by the
+  // HTTP client, zstd bodies by _decodeJson.
+  static const _acceptEncoding = 'zstd, gzip';
+
   final Dio _dio;
+  final Zstandard _zstd = Zstandard();
   String? _baseUrl;
   String? _deviceId;
+  // Cleared once a server without zstd support refuses a zstd upload
+  bool _zstdUploads = true;
 
   APIClient() : _dio = Dio(BaseOptions(
         connectTimeout: const Duration(seconds: 30),
@@ -55,6 +70,8 @@ class APIClient {
   /// Check if the API client is configured (enrolled)
   bool get isConfigured => _baseUrl != null && _deviceId != null;
 
+  String? get deviceId => _deviceId;
+
   /// Ensure the client is configured before making API calls
   void _ensureConfigured() {
     debugPrint('[API_CLIENT] Checking configuration...');
@@ -69,38 +86,104 @@ class APIClient {
   }
 
   // Sync endpoints
-  Future<Map<String, dynamic>> syncIncoming({int? limit}) async {
+  Future<Map<String, dynamic>> syncIncoming({int? limit, String? cursor}) async {
     debugPrint('[API_CLIENT] syncIncoming called');
     _ensureConfigured();
-    final queryParams = limit != null ? {'limit': limit} : null;
+    final queryParams = <String, dynamic>{
+      if (limit != null) 'limit': limit,
+      if (cursor != null) 'cursor': cursor,
+    };
     debugPrint('[API_CLIENT] Making GET request to: /api/sync/incoming');
     try {
-      final response = await _dio.get('/api/sync/incoming', queryParameters: queryParams);
+      final response = await _dio.get<List<int>>(
+        '/api/sync/incoming',
+        queryParameters: queryParams,
+        options: Options(
+          responseType: ResponseType.bytes,
+          headers: {'Accept-Encoding': _acceptEncoding},
+        ),
+      );
       debugPrint('[API_CLIENT] syncIncoming success');
-      return response.data;
+      return await _decodeJson(response);
     } catch (e) {
       debugPrint('[API_CLIENT] syncIncoming error: $e');
       rethrow;
     }
   }
 
-  Future<Map<String, dynamic>> syncOutgoing(List<Map<String, dynamic>> messages) async {
-    debugPrint('[API_CLIENT] syncOutgoing called');
+  Future<Map<String, dynamic>> ackIncoming(String cursor) async {
+    debugPrint('[API_CLIENT] ackIncoming called');
     _ensureConfigured();
-    debugPrint('[API_CLIENT] Making POST request to: /api/sync/outgoing');
+    debugPrint('[API_CLIENT] Making POST request to: /api/sync/incoming/ack');
     try {
       final response = await _dio.post(
-        '/api/sync/outgoing',
-        data: {'messages': messages},
+        '/api/sync/incoming/ack',
+        data: {'cursor': cursor},
       );
-      debugPrint('[API_CLIENT] syncOutgoing success');
+      debugPrint('[API_CLIENT] ackIncoming success');
       return response.data;
+    } catch (e) {
+      debugPrint('[API_CLIENT] ackIncoming error: $e');
+      rethrow;
+    }
+  }
+
+  Future<Map<String, dynamic>> syncOutgoing(List<Map<String, dynamic>> messages) async {
+    debugPrint('[API_CLIENT] syncOutgoing called');
+    _ensureConfigured();
+    debugPrint('[API_CLIENT] Making POST request to: /api/sync/outgoing');
+    try {
+      final body = utf8.encode(jsonEncode({'messages': messages}));
+      final compress = body.length > _compressionThreshold;
+      if (compress && _zstdUploads) {
+        final compressed = await _zstd.compress(Uint8List.fromList(body));
+        if (compressed != null) {
+          try {
+            return await _postOutgoing(compressed, 'zstd');
+          } on DioException catch (e) {
+            if (e.response?.statusCode != 415) rethrow;
+            debugPrint('[API_CLIENT] Server refused a zstd upload, using gzip');
+            _zstdUploads = false;
+          }
+        }
+      }
+      return await _postOutgoing(compress ? gzip.encode(body) : body, compress ? 'gzip' : null);
     } catch (e) {
       debugPrint('[API_CLIENT] syncOutgoing error: $e');
       rethrow;
     }
   }
 
+  Future<Map<String, dynamic>> _postOutgoing(List<int> data, String? contentEncoding) async {
+    final response = await _dio.post<List<int>>(
+      '/api/sync/outgoing',
+      data: data,
+      options: Options(
+        contentType: Headers.jsonContentType,
+        responseType: ResponseType.bytes,
+        headers: {
+          'Accept-Encoding': _acceptEncoding,
+          if (contentEncoding != null) 'Content-Encoding': contentEncoding,
+        },
+      ),
+    );
+    debugPrint('[API_CLIENT] syncOutgoing success');
+    return await _decodeJson(response);
+  }
+
+  /// Decodes a JSON response body, decompressing it if it was sent with zstd
+  Future<Map<String, dynamic>> _decodeJson(Response<List<int>> response) async {
+    var body = Uint8List.fromList(response.data ?? const <int>[]);
+    if (response.headers.value('content-encoding') == 'zstd') {
+      final decoded = await _zstd.decompress(body);
+      if (decoded == null) {
+        throw const FormatException('Invalid zstd response body');
+      }
+      body = decoded;
+    }
+    return jsonDecode(utf8.decode(body)) as Map<String, dynamic>;
+  }
+
   Future<Map<String, dynamic>> getSyncStatus() async {
     debugPrint('[API_CLIENT] getSyncStatus called');
     _ensureConfigured();
@@ -36,23 +36,40 @@ class Users extends Table {
   Set<Column> get primaryKey => {id};
 }
 
+// Rows of synced tables other than messages, as delivered in the `records` of
+// incoming sync pages. Their columns are not known to the app, so each row is
+// kept as its JSON object, keyed by table and id.
+const _createSyncedRecords = '''
+CREATE TABLE IF NOT EXISTS synced_records (
+  table_name TEXT NOT NULL,
+  id TEXT NOT NULL,
+  data TEXT NOT NULL,
+  hlc TEXT,
+  updated_at TEXT NOT NULL,
+  PRIMARY KEY (table_name, id)
+)''';
+
 @DriftDatabase(tables: [Messages, Users])
 class AppDatabase extends _$AppDatabase {
   AppDatabase() : super(_openConnection());
 
   @override
-  int get schemaVersion => 2;
+  int get schemaVersion => 3;
 
   @override
   MigrationStrategy get migration {
     return MigrationStrategy(
       onCreate: (Migrator m) async {
         await m.createAll();
+        await customStatement(_createSyncedRecords);
       },
       onUpgrade: (Migrator m, int from, int to) async {
         if (from < 2) {
           await m.createTable(users);
         }
+        if (from < 3) {
+          await customStatement(_createSyncedRecords);
+        }
       },
     );
   }
@@ -82,6 +99,10 @@ class AppDatabase extends _$AppDatabase {
     return into(messages).insert(message, mode: InsertMode.replace);
   }
 
+  Future<void> deleteMessage(String id) {
+    return (delete(messages)..where((m) => m.id.equals(id))).go();
+  }
+
   Future<void> updateMessageStatus(String id, String status) {
     return (update(messages)..where((m) => m.id.equals(id)))
         .write(MessagesCompanion(status: Value(status)));
@@ -143,6 +164,28 @@ class AppDatabase extends _$AppDatabase {
   Stream<List<User>> watchAllUsers() {
     return (select(users)..orderBy([(u) => OrderingTerm.desc(u.updatedAt)])).watch();
   }
+
+  // Synced record queries
+  Future<void> upsertRecord(String table, String id, String data, String? hlc, DateTime updatedAt) {
+    return customStatement(
+      'INSERT OR REPLACE INTO synced_records (table_name, id, data, hlc, updated_at) VALUES (?, ?, ?, ?, ?)',
+      [table, id, data, hlc, updatedAt.toIso8601String()],
+    );
+  }
+
+  Future<void> deleteRecord(String table, String id) {
+    return customStatement(
+      'DELETE FROM synced_records WHERE table_name = ? AND id = ?',
+      [table, id],
+    );
+  }
+
+  // Discards the server data before a full resync. Messages written on this
+  // device that were not uploaded yet are kept.
+  Future<void> resetSyncedData() async {
+    await (delete(messages)..where((m) => m.status.equals('pending_sync').not())).go();
+    await customStatement('DELETE FROM synced_records');
+  }
 }
 
 LazyDatabase _openConnection() {
@@ -0,0 +1,62 @@
+/// Hybrid logical clock matching the sync engine's timestamps:
+/// "<wall ms:13 digits>-<counter:5 digits>-<node>". The text form sorts in
+/// timestamp order.
+class HybridLogicalClock {
+  static const _maxCounter = 99999;
+
+  final String node;
+  int _wall = 0;
+  int _counter = 0;
+
+  HybridLogicalClock(this.node);
+
+  /// Timestamp for a local event that happened at [physical] (default: now)
+  String tick([DateTime? physical]) {
+    final pt = (physical ?? DateTime.now()).millisecondsSinceEpoch;
+    if (pt > _wall) {
+      _wall = pt;
+      _counter = 0;
+    } else {
+      _advance();
+    }
+    return _format();
+  }
+
+  /// Merges a timestamp received from the server so later local timestamps
+  /// order after it
+  void receive(String? remote) {
+    if (remote == null) return;
+    final parts = remote.split('-');
+    if (parts.length < 3) return;
+    final wall = int.tryParse(parts[0]);
+    final counter = int.tryParse(parts[1]);
+    if (wall == null || counter == null) return;
+
+    final pt = DateTime.now().millisecondsSinceEpoch;
+    if (pt > _wall && pt > wall) {
+      _wall = pt;
+      _counter = 0;
+    } else if (wall > _wall) {
+      _wall = wall;
+      _counter = counter;
+      _advance();
+    } else if (wall == _wall && counter > _counter) {
+      _counter = counter;
+      _advance();
+    } else {
+      _advance();
+    }
+  }
+
+  void _advance() {
+    if (_counter >= _maxCounter) {
+      _wall++;
+      _counter = 0;
+    } else {
+      _counter++;
+    }
+  }
+
+  String _format() =>
+      '${_wall.toString().padLeft(13, '0')}-${_counter.toString().padLeft(5, '0')}-$node';
+}
@@ -1,11 +1,21 @@
+import 'dart:convert';
+
 import 'package:connectivity_plus/connectivity_plus.dart';
+import 'package:dio/dio.dart';
+import 'package:shared_preferences/shared_preferences.dart';
 import '../database/database.dart';
 import '../api/api_client.dart';
+import 'hlc.dart';
 
 class SyncService {
+  // Cursor of the last incoming page stored locally; the next sync resumes from it
+  static const _incomingCursorKey = 'incoming_sync_cursor';
+
   final AppDatabase _database;
   final APIClient _apiClient;
   final Connectivity _connectivity;
+  late final HybridLogicalClock _clock =
+      HybridLogicalClock(_apiClient.deviceId ?? 'device');
 
   SyncService(this._database, this._apiClient, this._connectivity);
 
@@ -29,57 +39,125 @@ class SyncService {
   }
 
   Future<void> _syncIncoming() async {
+    final prefs = await SharedPreferences.getInstance();
     try {
-      final response = await _apiClient.syncIncoming();
-      final messages = response['messages'] as List<dynamic>? ?? [];
-      final users = response['users'] as List<dynamic>? ?? [];
-
-      // Sync messages
-      for (final msgData in messages) {
-        final message = Message(
-          id: msgData['id'],
-          senderId: msgData['sender_id'],
-          recipientId: msgData['recipient_id'],
-          content: msgData['content'],
-          status: 'synced',
-          createdAt: DateTime.parse(msgData['created_at']),
-          updatedAt: DateTime.parse(msgData['updated_at']),
-          syncedAt: DateTime.now(),
+      var hasMore = true;
+      while (hasMore) {
+        final response = await _apiClient.syncIncoming(
+          cursor: prefs.getString(_incomingCursorKey),
         );
-        await _database.insertMessage(message);
-      }
+        _clock.receive(response['hlc'] as String?);
+        await _storeIncoming(response);
 
-      // Sync users with last_message_sent (last-write-wins)
-      if (users.isNotEmpty) {
-        final usersList = users.map((userData) {
-          final remoteUpdatedAt = DateTime.parse(userData['updated_at']);
-          return User(
-            id: userData['id'],
-            username: userData['username'],
-            userType: userData['user_type'],
-            deviceId: userData['device_id'],
-            onlineStatus: userData['online_status'] ?? false,
-            lastSeen: userData['last_seen'] != null 
-                ? DateTime.parse(userData['last_seen']) 
-                : null,
-            lastMessageSent: userData['last_message_sent'],
-            createdAt: DateTime.parse(userData['created_at']),
-            updatedAt: remoteUpdatedAt,
-          );
-        }).toList();
-        await _database.insertUsers(usersList);
+        // Confirm receipt only after everything is stored; unacknowledged
+        // changes are sent again on the next sync
+        final cursor = response['cursor'] as String?;
+        if (cursor != null) {
+          await prefs.setString(_incomingCursorKey, cursor);
+          await _apiClient.ackIncoming(cursor);
+        }
+        hasMore = response['has_more'] as bool? ?? false;
+      }
+    } on DioException catch (e) {
+      // The saved cursor no longer applies, e.g. after a full resync was
+      // requested; the next sync starts from the server's position
+      if (e.response?.statusCode == 409) {
+        await prefs.remove(_incomingCursorKey);
       }
     } catch (e) {
       // Handle error
     }
   }
 
+  // Applies a page in one local transaction, so a page is either stored whole
+  // or fetched again
+  Future<void> _storeIncoming(Map<String, dynamic> response) {
+    return _database.transaction(() => _applyIncoming(response));
+  }
+
+  Future<void> _applyIncoming(Map<String, dynamic> response) async {
+    final messages = response['messages'] as List<dynamic>? ?? [];
+    final records = response['records'] as List<dynamic>? ?? [];
+    final tombstones = response['tombstones'] as List<dynamic>? ?? [];
+    final users = response['users'] as List<dynamic>? ?? [];
+
+    // The first page of a full resync replaces everything received before
+    final snapshot = response['snapshot'] as Map<String, dynamic>?;
+    if (snapshot?['reset'] == true) {
+      await _database.resetSyncedData();
+    }
+
+    // Sync messages
+    for (final msgData in messages) {
+      final message = Message(
+        id: msgData['id'],
+        senderId: msgData['sender_id'],
+        recipientId: msgData['recipient_id'],
+        content: msgData['content'],
+        status: 'synced',
+        createdAt: DateTime.parse(msgData['created_at']),
+        updatedAt: DateTime.parse(msgData['updated_at']),
+        syncedAt: DateTime.now(),
+      );
+      await _database.insertMessage(message);
+    }
+
+    // Rows of the other synced tables
+    for (final record in records) {
+      final data = record['data'] as Map<String, dynamic>? ?? {};
+      final id = data['id'];
+      if (id == null) continue;
+      await _database.upsertRecord(
+        record['table'] as String,
+        id.toString(),
+        jsonEncode(data),
+        record['hlc'] as String?,
+        DateTime.parse(record['updated_at']),
+      );
+    }
+
+    // Rows deleted on the server
+    for (final tombstone in tombstones) {
+      final table = tombstone['table'] as String;
+      final id = tombstone['id'] as String;
+      if (table == 'messages') {
+        await _database.deleteMessage(id);
+      } else {
+        await _database.deleteRecord(table, id);
+      }
+    }
+
+    // Sync users with last_message_sent (last-write-wins)
+    if (users.isNotEmpty) {
+      final usersList = users.map((userData) {
+        final remoteUpdatedAt = DateTime.parse(userData['updated_at']);
+        return User(
+          id: userData['id'],
+          username: userData['username'],
+          userType: userData['user_type'],
+          deviceId: userData['device_id'],
+          onlineStatus: userData['online_status'] ?? false,
+          lastSeen: userData['last_seen'] != null 
+              ? DateTime.parse(userData['last_seen']) 
+              : null,
+          lastMessageSent: userData['last_message_sent'],
+          createdAt: DateTime.parse(userData['created_at']),
+          updatedAt: remoteUpdatedAt,
+        );
+      }).toList();
+      await _database.insertUsers(usersList);
+    }
+  }
+
   Future<void> _syncOutgoing() async {
     try {
       final pendingMessages = await _database.getPendingMessages();
       
       if (pendingMessages.isEmpty) return;
 
+      // Stamp messages in the order they were written; the clock keeps them
+      // after everything this device has seen from the server
+      pendingMessages.sort((a, b) => a.createdAt.compareTo(b.createdAt));
       final messagesData = pendingMessages.map((msg) => {
         'id': msg.id,
         'sender_id': msg.senderId,
@@ -88,15 +166,31 @@ class SyncService {
         'status': msg.status,
         'created_at': msg.createdAt.toIso8601String(),
         'updated_at': msg.updatedAt.toIso8601String(),
+        'hlc': _clock.tick(msg.createdAt),
       }).toList();
 
       final response = await _apiClient.syncOutgoing(messagesData);
+      _clock.receive(response['hlc'] as String?);
       
-      final syncedCount = response['synced_count'] as int? ?? 0;
-      if (syncedCount > 0) {
-        // Update message status to synced
-        for (final msg in pendingMessages.take(syncedCount)) {
-          await _database.updateMessageStatus(msg.id, 'synced');
+      // Uploads are keyed on message IDs, so anything without a final outcome
+      // stays pending and is simply uploaded again
+      final results = response['results'] as List<dynamic>? ?? [];
+      for (final result in results) {
+        final id = result['message_id'] as String;
+        switch (result['outcome']) {
+          case 'created':
+          case 'duplicate':
+          case 'updated':
+            await _database.updateMessageStatus(id, 'synced');
+            break;
+          case 'conflict':
+            await _database.updateMessageStatus(id, 'failed');
+            break;
+          case 'rejected':
+            if (result['reason'] != 'internal_error') {
+              await _database.updateMessageStatus(id, 'failed');
+            }
+            break;
         }
       }
     } catch (e) {
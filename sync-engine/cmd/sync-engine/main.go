@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -14,14 +15,22 @@ import (
 
 	"posduif/sync-engine/internal/api/handlers"
 	"posduif/sync-engine/internal/api/middleware"
+	"posduif/sync-engine/internal/api/sse"
 	"posduif/sync-engine/internal/config"
 	"posduif/sync-engine/internal/database"
 	"posduif/sync-engine/internal/enrollment"
+	"posduif/sync-engine/internal/models"
 	"posduif/sync-engine/internal/redis"
 	"posduif/sync-engine/internal/sync"
 )
 
 func main() {
+	// Subcommands take their own flags
+	if len(os.Args) > 1 && os.Args[1] == "wal" {
+		runWALCommand(os.Args[2:])
+		return
+	}
+
 	configPath := flag.String("config", "config/config.yaml", "Path to configuration file")
 	flag.Parse()
 
@@ -51,43 +60,86 @@ func main() {
 	}
 	defer redisClient.Close()
 
-	// Initialize WAL components if enabled
-	var walService *sync.WALService
-	var changeTracker *sync.ChangeTracker
-	walEnabled := cfg.Sync.WAL.Enabled
+	// Initialize the change source selected for this tenant
+	var changeSource sync.ChangeSource
+	var slotMonitor *sync.SlotMonitor
+	syncRules, err := sync.NewSyncRules(cfg.Sync.Rules)
+	if err != nil {
+		log.Fatalf("Invalid sync rules: %v", err)
+	}
+	// Queued changes are announced to every replica, which push them to their SSE clients
+	changeBus := redis.NewChangeBus(redisClient.GetClient(), cfg)
+	deviceHub := sse.NewDeviceHub()
+	go changeBus.Subscribe(ctx, deviceHub.Publish)
+	changeTracker := sync.NewChangeTracker(db, syncRules, &cfg.Sync.Queue, changeBus)
+	snapshots := sync.NewSnapshotManager(db, syncRules)
 
-	if walEnabled {
+	switch cfg.Sync.ChangeSource {
+	case sync.ChangeSourceWAL:
 		// Create replication slot manager
 		slotManager := database.NewReplicationSlotManager(db.Pool, cfg)
-		
-		// Create replication slot
-		slotName, err := slotManager.CreateReplicationSlot(ctx)
-		if err != nil {
-			log.Fatalf("Failed to create replication slot: %v", err)
+
+		// Fail fast on wal_level or privilege problems instead of streaming nothing
+		if err := slotManager.CheckReplicationPrerequisites(ctx); err != nil {
+			log.Fatalf("Logical replication is not available: %v", err)
 		}
-		log.Printf("Created/verified replication slot: %s", slotName)
 
-		// Initialize change tracker
-		changeTracker = sync.NewChangeTracker(db)
+		// The publication and the slot are set up by the leader when it starts
+		// the change source
+		slotName := slotManager.GetSlotName()
+		walService := sync.NewWALService(db, changeTracker, db.GetPool(), slotManager, slotName, &cfg.Sync.WAL)
+		changeSource = sync.NewWALChangeSource(db, changeTracker, snapshots, walService)
 
-		// Initialize WAL service
-		walService, err = sync.NewWALService(db, changeTracker, db.GetPool(), slotManager, &cfg.Sync.WAL)
+		// Watch retained WAL so an abandoned slot cannot fill the disk
+		slotMonitor, err = sync.NewSlotMonitor(db, slotManager, slotName, &cfg.Sync.WAL.Monitor)
 		if err != nil {
-			log.Fatalf("Failed to create WAL service: %v", err)
+			log.Fatalf("Failed to create replication slot monitor: %v", err)
+		}
+	case sync.ChangeSourceNotify:
+		changeSource = sync.NewNotifyChangeSource(db, changeTracker, snapshots, &cfg.Sync)
+	case sync.ChangeSourcePolling:
+		changeSource = sync.NewPollingChangeSource(db)
+	default:
+		log.Fatalf("Unknown change source %q", cfg.Sync.ChangeSource)
+	}
+
+	// Only the elected replica captures changes; every replica serves devices
+	// from the shared change queues
+	leaderElector := sync.NewLeaderElector(db, &cfg.Sync.Leader)
+	leaderElector.Start(ctx, func(ctx context.Context) {
+		if err := changeSource.Start(ctx); err != nil {
+			log.Printf("Failed to start %s change source: %v", changeSource.Name(), err)
+			return
+		}
+		log.Printf("Change source started: %s", changeSource.Name())
+		if slotMonitor != nil {
+			slotMonitor.Start(ctx)
 		}
 
-		// Start WAL service
-		if err := walService.Start(ctx); err != nil {
-			log.Fatalf("Failed to start WAL service: %v", err)
+		<-ctx.Done()
+		if slotMonitor != nil {
+			slotMonitor.Stop()
 		}
-		log.Println("WAL service started")
-		defer walService.Stop()
-	} else {
-		changeTracker = sync.NewChangeTracker(db)
-	}
+		changeSource.Stop()
+		log.Printf("Change source stopped: %s", changeSource.Name())
+	})
+	defer leaderElector.Stop()
 
 	// Initialize sync manager
-	syncManager := sync.NewManager(db, changeTracker, walEnabled)
+	hlcMaxDrift, err := time.ParseDuration(cfg.Sync.HLCMaxDrift)
+	if err != nil {
+		log.Fatalf("Invalid sync.hlc_max_drift: %v", err)
+	}
+	hlcNode, err := os.Hostname()
+	if err != nil {
+		hlcNode = "server"
+	}
+	clock := sync.NewHLCClock(hlcNode, hlcMaxDrift)
+	conflictResolver, err := sync.NewConflictResolver(db, cfg.Sync.ConflictResolution, clock)
+	if err != nil {
+		log.Fatalf("Failed to create conflict resolver: %v", err)
+	}
+	syncManager := sync.NewManager(db, changeSource, conflictResolver, clock, cfg.Sync.CursorSecret)
 
 	// Initialize services
 	enrollmentService := enrollment.NewService(db, cfg)
@@ -96,9 +148,11 @@ func main() {
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, cfg.Auth.JWTSecret, cfg.Auth.JWTExpiration)
 	enrollmentHandler := handlers.NewEnrollmentHandler(enrollmentService)
-	messagesHandler := handlers.NewMessagesHandler(db, redisPublisher)
-	syncHandler := handlers.NewSyncHandler(db, syncManager)
+	messagesHandler := handlers.NewMessagesHandler(db, redisPublisher, clock)
+	syncHandler := handlers.NewSyncHandler(db, syncManager, &cfg.Sync)
 	usersHandler := handlers.NewUsersHandler(db)
+	conflictsHandler := handlers.NewConflictsHandler(conflictResolver)
+	mobileSSEHandler := sse.NewMobileSSEHandler(db, deviceHub)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(cfg.Auth.JWTSecret)
@@ -114,8 +168,18 @@ func main() {
 
 	// Health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+		health := map[string]interface{}{
+			"status": "OK",
+			"leader": leaderElector.IsLeader(),
+		}
+
+		// Include replication slot lag when this replica consumes WAL
+		if slotMonitor != nil && leaderElector.IsLeader() {
+			health["replication_slot"] = slotMonitor.Stats()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(health)
 	})
 
 	// Public endpoints (no auth required)
@@ -151,16 +215,27 @@ func main() {
 			messagesHandler.GetMessage(w, r)
 		}
 	})
+	protectedMux.HandleFunc("/api/conflicts", conflictsHandler.ListConflicts)
+	protectedMux.HandleFunc("/api/conflicts/", conflictsHandler.ResolveConflict)
 	protectedMux.HandleFunc("/api/users", usersHandler.ListUsers)
-	protectedMux.HandleFunc("/api/users/", usersHandler.GetUser)
+	protectedMux.HandleFunc("/api/users/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if strings.HasSuffix(path, "/devices") {
+			usersHandler.ListDevices(w, r)
+		} else {
+			usersHandler.GetUser(w, r)
+		}
+	})
 
 	// Device-authenticated endpoints (require X-Device-ID header)
 	deviceMux := http.NewServeMux()
 	deviceMux.HandleFunc("/api/sync/incoming", syncHandler.GetIncoming)
+	deviceMux.HandleFunc("/api/sync/incoming/ack", syncHandler.AckIncoming)
 	deviceMux.HandleFunc("/api/sync/outgoing", syncHandler.UploadOutgoing)
 	deviceMux.HandleFunc("/api/sync/status", syncHandler.GetSyncStatus)
 	deviceMux.HandleFunc("/api/users", usersHandler.ListUsers)
 	deviceMux.HandleFunc("/api/users/", usersHandler.GetUser)
+	deviceMux.HandleFunc("/sse/mobile/", mobileSSEHandler.HandleSSE)
 
 	// Apply middleware chain
 	handler := loggingMiddleware.Middleware(
@@ -176,10 +251,11 @@ func main() {
 
 				// Route to appropriate handler based on path
 				if strings.HasPrefix(path, "/api/enrollment/create") ||
-					strings.HasPrefix(path, "/api/messages") {
+					strings.HasPrefix(path, "/api/messages") ||
+					strings.HasPrefix(path, "/api/conflicts") {
 					// Protected routes - require auth
 					authMiddleware.Middleware(protectedMux).ServeHTTP(w, r)
-				} else if strings.HasPrefix(path, "/api/sync/") ||
+				} else if strings.HasPrefix(path, "/api/sync/") || strings.HasPrefix(path, "/sse/mobile/") ||
 					(strings.HasPrefix(path, "/api/users") && r.Header.Get("X-Device-ID") != "") {
 					// Device-authenticated routes - require X-Device-ID
 					log.Printf("[ROUTER] Routing to deviceMux for path: %s", path)
@@ -228,3 +304,75 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// runWALCommand runs the "wal" subcommands used to debug change capture
+func runWALCommand(args []string) {
+	if len(args) == 0 || args[0] != "dump" {
+		fmt.Fprintln(os.Stderr, "usage: sync-engine wal dump [flags]")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("wal dump", flag.ExitOnError)
+	configPath := flags.String("config", "config/config.yaml", "Path to configuration file")
+	peek := flags.Bool("peek", false, "Read from a temporary copy of the engine's replication slot instead of a new slot at the current WAL position")
+	from := flags.String("from", "", "Skip transactions committed before this LSN")
+	tables := flags.String("table", "", "Comma-separated tables to print (\"table\" or \"schema.table\")")
+	operations := flags.String("op", "", "Comma-separated operations to print (INSERT, UPDATE, DELETE)")
+	deviceID := flags.String("device", "", "Only print changes routed to this device")
+	recipientID := flags.String("recipient", "", "Only print changes routed to a device of this user")
+	limit := flags.Int("limit", 0, "Stop after this many changes (0 = until interrupted)")
+	flags.Parse(args[1:])
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	opts := sync.WALDumpOptions{
+		Tables:      splitList(*tables),
+		Operations:  splitList(*operations),
+		DeviceID:    *deviceID,
+		RecipientID: *recipientID,
+		Limit:       *limit,
+	}
+	if *from != "" {
+		if opts.FromLSN, err = models.ParseLSN(*from); err != nil {
+			log.Fatalf("Invalid -from LSN: %v", err)
+		}
+	}
+
+	db, err := database.NewDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Routing only reads the rules and devices; nothing is queued
+	syncRules, err := sync.NewSyncRules(cfg.Sync.Rules)
+	if err != nil {
+		log.Fatalf("Invalid sync rules: %v", err)
+	}
+	changeTracker := sync.NewChangeTracker(db, syncRules, &cfg.Sync.Queue, nil)
+	slotManager := database.NewReplicationSlotManager(db.Pool, cfg)
+	if *peek {
+		opts.Slot = slotManager.GetSlotName()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := sync.DumpWAL(ctx, db, slotManager, changeTracker, &cfg.Sync.WAL, opts, os.Stdout); err != nil {
+		log.Fatalf("WAL dump failed: %v", err)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
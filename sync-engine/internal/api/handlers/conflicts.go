@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/api/middleware"
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+	"posduif/sync-engine/internal/sync"
+)
+
+type ConflictsHandler struct {
+	resolver *sync.ConflictResolver
+}
+
+func NewConflictsHandler(resolver *sync.ConflictResolver) *ConflictsHandler {
+	return &ConflictsHandler{resolver: resolver}
+}
+
+// ListConflicts returns the conflicts of the user's devices, newest first.
+// ?status=open lists the ones awaiting a decision.
+func (h *ConflictsHandler) ListConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter := models.ConflictFilter{
+		UserID: userID,
+		Status: r.URL.Query().Get("status"),
+		Limit:  50,
+		Offset: 0,
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			filter.Limit = limit
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
+			filter.Offset = offset
+		}
+	}
+
+	conflicts, err := h.resolver.ListConflicts(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to get conflicts", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ConflictListResponse{
+		Conflicts: conflicts,
+		Limit:     filter.Limit,
+		Offset:    filter.Offset,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResolveConflict keeps the server's or the device's version of a conflicting
+// edit: POST /api/conflicts/{id}/resolve
+func (h *ConflictsHandler) ResolveConflict(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) != 4 || pathParts[3] != "resolve" {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	conflictID := pathParts[2]
+
+	var req models.ResolveConflictRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Resolution != sync.ResolutionServer && req.Resolution != sync.ResolutionDevice {
+		http.Error(w, `Resolution must be "server" or "device"`, http.StatusBadRequest)
+		return
+	}
+
+	conflict, err := h.resolver.Resolve(r.Context(), conflictID, userID, req.Resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "Conflict not found", http.StatusNotFound)
+		case errors.Is(err, database.ErrConflictResolved):
+			http.Error(w, "Conflict already resolved", http.StatusConflict)
+		case errors.Is(err, database.ErrConflictOutdated):
+			http.Error(w, "Message changed since the conflict was recorded", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to resolve conflict", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conflict)
+}
@@ -10,17 +10,20 @@ import (
 	"posduif/sync-engine/internal/database"
 	"posduif/sync-engine/internal/models"
 	"posduif/sync-engine/internal/redis"
+	"posduif/sync-engine/internal/sync"
 )
 
 type MessagesHandler struct {
 	db        *database.DB
 	publisher *redis.Publisher
+	clock     *sync.HLCClock
 }
 
-func NewMessagesHandler(db *database.DB, publisher *redis.Publisher) *MessagesHandler {
+func NewMessagesHandler(db *database.DB, publisher *redis.Publisher, clock *sync.HLCClock) *MessagesHandler {
 	return &MessagesHandler{
 		db:        db,
 		publisher: publisher,
+		clock:     clock,
 	}
 }
 
@@ -61,6 +64,7 @@ func (h *MessagesHandler) CreateMessage(w http.ResponseWriter, r *http.Request)
 		RecipientID: req.RecipientID,
 		Content:     req.Content,
 		Status:      "pending_sync",
+		HLC:         h.clock.Now().String(),
 	}
 
 	if err := h.db.CreateMessage(r.Context(), msg); err != nil {
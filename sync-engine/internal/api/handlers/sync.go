@@ -2,24 +2,36 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/compression"
+	"posduif/sync-engine/internal/config"
 	"posduif/sync-engine/internal/database"
 	"posduif/sync-engine/internal/models"
+	"posduif/sync-engine/internal/protocol"
 	"posduif/sync-engine/internal/sync"
 )
 
+// maxIncomingLimit is the largest page a device can request
+const maxIncomingLimit = 1000
+
 type SyncHandler struct {
 	db      *database.DB
 	manager *sync.Manager
+	cfg     *config.SyncConfig
 }
 
-func NewSyncHandler(db *database.DB, manager *sync.Manager) *SyncHandler {
+func NewSyncHandler(db *database.DB, manager *sync.Manager, cfg *config.SyncConfig) *SyncHandler {
 	return &SyncHandler{
 		db:      db,
 		manager: manager,
+		cfg:     cfg,
 	}
 }
 
@@ -35,16 +47,28 @@ func (h *SyncHandler) GetIncoming(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.db.TouchDevice(r.Context(), deviceID)
+
 	limit := 100
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
 			limit = l
 		}
 	}
+	if limit > maxIncomingLimit {
+		limit = maxIncomingLimit
+	}
 
-	messages, err := h.manager.SyncIncoming(r.Context(), deviceID, limit)
+	incoming, err := h.manager.SyncIncoming(r.Context(), deviceID, r.URL.Query().Get("cursor"), limit)
 	if err != nil {
-		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, sync.ErrInvalidCursor):
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		case errors.Is(err, sync.ErrStaleCursor):
+			http.Error(w, "Cursor no longer applies, fetch incoming changes without it", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to get messages", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -56,10 +80,70 @@ func (h *SyncHandler) GetIncoming(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := models.SyncIncomingResponse{
-		Messages:      messages,
+		Messages:      incoming.Messages,
+		Records:       incoming.Records,
+		Tombstones:    incoming.Tombstones,
+		Snapshot:      incoming.Snapshot,
+		Cursor:        incoming.Cursor,
+		HasMore:       incoming.HasMore,
 		Users:         users,
 		Compressed:    false,
 		SyncTimestamp: time.Now(),
+		HLC:           h.manager.HLC(),
+	}
+
+	format := protocol.Negotiate(r.Header.Get("Accept"))
+	body, err := protocol.Marshal(format, &response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	encoding := h.responseEncoding(r, body)
+	if encoding != compression.Identity {
+		response.Compressed = true
+		if body, err = protocol.Marshal(format, &response); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+	}
+	h.writeBody(w, body, protocol.ContentType(format, &response), encoding)
+}
+
+// AckIncoming confirms receipt of an incoming page. Until a page is
+// acknowledged, GetIncoming returns it again.
+func (h *SyncHandler) AckIncoming(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := r.Header.Get("X-Device-ID")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SyncAckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Cursor == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.manager.AckIncoming(r.Context(), deviceID, req.Cursor); err != nil {
+		switch {
+		case errors.Is(err, sync.ErrInvalidCursor):
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		case errors.Is(err, sync.ErrStaleCursor):
+			http.Error(w, "Cursor no longer applies, fetch incoming changes again", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to acknowledge changes", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := models.SyncAckResponse{
+		Acknowledged:  true,
+		SyncTimestamp: time.Now(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -78,43 +162,120 @@ func (h *SyncHandler) UploadOutgoing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.db.TouchDevice(r.Context(), deviceID)
+
+	// Uploads may be compressed with any supported Content-Encoding; the
+	// limit applies to the decompressed body
+	body, err := compression.NewReader(r.Header.Get("Content-Encoding"),
+		http.MaxBytesReader(w, r.Body, h.cfg.MaxUploadBytes), h.cfg.MaxUploadBytes)
+	if errors.Is(err, compression.ErrUnsupportedEncoding) {
+		w.Header().Set("Accept-Encoding", strings.Join(compression.Supported(), ", "))
+		http.Error(w, "Unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid compressed body", http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
 	var req models.SyncOutgoingRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	requestFormat, err := protocol.RequestFormat(r.Header.Get("Content-Type"), &req)
+	if err != nil {
+		http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.Is(err, compression.ErrTooLarge) || errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := protocol.Unmarshal(requestFormat, data, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	results, err := h.manager.SyncOutgoing(r.Context(), deviceID, req.Messages)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Device not enrolled", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Failed to upload messages", http.StatusInternalServerError)
+		return
+	}
+
 	syncedCount := 0
 	failedCount := 0
 	var failedMessages []models.FailedMessage
-
-	for _, msg := range req.Messages {
-		if err := h.db.CreateMessage(r.Context(), &msg); err != nil {
+	for _, result := range results {
+		switch result.Outcome {
+		case models.UploadCreated, models.UploadUpdated, models.UploadDuplicate:
+			syncedCount++
+		default:
 			failedCount++
+			reason := result.Reason
+			if result.Outcome == models.UploadConflict {
+				reason = string(models.UploadConflict)
+			}
 			failedMessages = append(failedMessages, models.FailedMessage{
-				MessageID: msg.ID,
-				Error:     err.Error(),
+				MessageID: result.MessageID,
+				Error:     reason,
 			})
-		} else {
-			syncedCount++
-			// Update sender's last_message_sent
-			sender, err := h.db.GetUserByID(r.Context(), msg.SenderID)
-			if err == nil {
-				sender.LastMessageSent = &msg.Content
-				h.db.UpdateUser(r.Context(), sender)
-			}
 		}
 	}
 
 	response := models.SyncOutgoingResponse{
 		SyncedCount:    syncedCount,
 		FailedCount:    failedCount,
+		Results:        results,
 		FailedMessages: failedMessages,
 		SyncTimestamp:  time.Now(),
+		HLC:            h.manager.HLC(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	format := protocol.Negotiate(r.Header.Get("Accept"))
+	responseBody, err := protocol.Marshal(format, &response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	h.writeBody(w, responseBody, protocol.ContentType(format, &response), h.responseEncoding(r, responseBody))
+}
+
+// responseEncoding negotiates the content coding of a sync response body.
+// Bodies up to sync.compression_threshold are sent uncompressed.
+func (h *SyncHandler) responseEncoding(r *http.Request, body []byte) string {
+	if !h.cfg.Compression || !compression.ShouldCompress(body, h.cfg.CompressionThreshold) {
+		return compression.Identity
+	}
+	return compression.Negotiate(r.Header.Get("Accept-Encoding"))
+}
+
+// writeBody writes an encoded response body with the given content coding
+func (h *SyncHandler) writeBody(w http.ResponseWriter, body []byte, contentType, encoding string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if encoding == compression.Identity {
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", encoding)
+	writer, err := compression.NewWriter(encoding, w)
+	if err != nil {
+		// Negotiate only picks supported codings
+		http.Error(w, "Failed to compress response", http.StatusInternalServerError)
+		return
+	}
+	writer.Write(body)
+	writer.Close()
 }
 
 func (h *SyncHandler) GetSyncStatus(w http.ResponseWriter, r *http.Request) {
@@ -145,6 +306,7 @@ func (h *SyncHandler) GetSyncStatus(w http.ResponseWriter, r *http.Request) {
 		LastSyncTimestamp:    sm.LastSyncTimestamp,
 		PendingOutgoingCount: sm.PendingOutgoingCount,
 		SyncStatus:           sm.SyncStatus,
+		NeedsFullResync:      sm.NeedsFullResync,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"posduif/sync-engine/internal/api/middleware"
 	"posduif/sync-engine/internal/database"
@@ -87,3 +88,30 @@ func (h *UsersHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 }
 
 
+
+// ListDevices returns the devices enrolled to a user
+func (h *UsersHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := strings.TrimSuffix(r.URL.Path[len("/api/users/"):], "/devices")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusBadRequest)
+		return
+	}
+
+	devices, err := h.db.GetDevicesByUserID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to get devices", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"devices": devices,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
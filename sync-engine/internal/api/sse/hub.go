@@ -0,0 +1,59 @@
+package sse
+
+import (
+	"sync"
+
+	"posduif/sync-engine/internal/models"
+)
+
+// DeviceHub hands change notifications to the SSE connections of this replica.
+// It is fed from the Redis change bus, so a device is notified no matter which
+// replica queued its changes.
+type DeviceHub struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan *models.ChangeNotification]bool // deviceID -> connections
+}
+
+// NewDeviceHub creates an empty hub
+func NewDeviceHub() *DeviceHub {
+	return &DeviceHub{subscribers: make(map[string]map[chan *models.ChangeNotification]bool)}
+}
+
+// Subscribe registers an SSE connection of a device. The returned function
+// removes the subscription.
+func (h *DeviceHub) Subscribe(deviceID string) (<-chan *models.ChangeNotification, func()) {
+	ch := make(chan *models.ChangeNotification, 16)
+
+	h.lock.Lock()
+	if h.subscribers[deviceID] == nil {
+		h.subscribers[deviceID] = make(map[chan *models.ChangeNotification]bool)
+	}
+	h.subscribers[deviceID][ch] = true
+	h.lock.Unlock()
+
+	return ch, func() {
+		h.lock.Lock()
+		delete(h.subscribers[deviceID], ch)
+		if len(h.subscribers[deviceID]) == 0 {
+			delete(h.subscribers, deviceID)
+		}
+		h.lock.Unlock()
+	}
+}
+
+// Publish delivers a notification to the connected devices it names. A
+// connection that is not keeping up misses the notification; the device still
+// gets the changes on its next sync.
+func (h *DeviceHub) Publish(notification *models.ChangeNotification) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, deviceID := range notification.DeviceIDs {
+		for ch := range h.subscribers[deviceID] {
+			select {
+			case ch <- notification:
+			default:
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package sse
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -9,11 +10,12 @@ import (
 )
 
 type MobileSSEHandler struct {
-	db *database.DB
+	db  *database.DB
+	hub *DeviceHub
 }
 
-func NewMobileSSEHandler(db *database.DB) *MobileSSEHandler {
-	return &MobileSSEHandler{db: db}
+func NewMobileSSEHandler(db *database.DB, hub *DeviceHub) *MobileSSEHandler {
+	return &MobileSSEHandler{db: db, hub: hub}
 }
 
 func (h *MobileSSEHandler) HandleSSE(w http.ResponseWriter, r *http.Request) {
@@ -42,10 +44,18 @@ func (h *MobileSSEHandler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	changes, unsubscribe := h.hub.Subscribe(deviceID)
+	defer unsubscribe()
+
 	ctx := r.Context()
 	ticker := time.NewTicker(15 * time.Second)
 	defer ticker.Stop()
 
+	h.db.TouchDevice(ctx, deviceID)
+
 	// Send initial connection message
 	fmt.Fprintf(w, "event: connected\ndata: {\"device_id\":\"%s\"}\n\n", deviceID)
 	flusher.Flush()
@@ -54,10 +64,20 @@ func (h *MobileSSEHandler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-ctx.Done():
 			return
+		case notification := <-changes:
+			// Changes were queued for this device, possibly by another replica
+			eventData, _ := json.Marshal(map[string]interface{}{
+				"type":   "changes",
+				"lsn":    notification.LSN,
+				"tables": notification.Tables,
+			})
+			fmt.Fprintf(w, "event: changes\ndata: %s\n\n", eventData)
+			flusher.Flush()
 		case <-ticker.C:
 			// Send ping to keep connection alive
 			fmt.Fprintf(w, ": ping\n\n")
 			flusher.Flush()
+			h.db.TouchDevice(ctx, deviceID)
 		case <-time.After(30 * time.Second):
 			// Check for new messages and send events
 			messages, err := h.db.GetPendingMessagesForDevice(ctx, deviceID, 10)
@@ -0,0 +1,168 @@
+package compression
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+)
+
+// zstdMaxWindow bounds the memory a zstd upload can make the decoder allocate
+const zstdMaxWindow = 8 << 20
+
+var (
+	// ErrUnsupportedEncoding is returned for a content coding without a codec
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	// ErrTooLarge is returned when a decompressed body exceeds its limit
+	ErrTooLarge = errors.New("decompressed body too large")
+)
+
+// codec compresses and decompresses one content coding
+type codec struct {
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// codecs holds the supported content codings
+var codecs = map[string]codec{
+	Gzip: {
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+	Zstd: {
+		// One goroutine each: bodies are small and every request has its own
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+}
+
+// preference orders the codings a client accepts with equal quality
+var preference = []string{Zstd, Gzip}
+
+// Supported returns the supported content codings, for Accept-Encoding headers
+func Supported() []string {
+	return append([]string(nil), preference...)
+}
+
+// Negotiate picks the content coding for a response from a request's
+// Accept-Encoding header: the supported coding with the highest quality,
+// or Identity if the client accepts none of them.
+func Negotiate(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+
+	type candidate struct {
+		name string
+		q    float64
+	}
+	var candidates []candidate
+	for _, name := range preference {
+		q, ok := qualities[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{name, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return Identity
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].name
+}
+
+// NewWriter returns a writer that compresses to w with a supported coding
+func NewWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	c, ok := codecs[encoding]
+	if !ok {
+		return nil, ErrUnsupportedEncoding
+	}
+	return c.newWriter(w)
+}
+
+// NewReader returns a reader of a body sent with Content-Encoding encoding. It
+// fails with ErrTooLarge once more than limit bytes have been decompressed.
+func NewReader(encoding string, r io.Reader, limit int64) (io.ReadCloser, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == Identity {
+		return &limitedReader{r: io.NopCloser(r), remaining: limit}, nil
+	}
+
+	c, ok := codecs[encoding]
+	if !ok {
+		return nil, ErrUnsupportedEncoding
+	}
+	reader, err := c.newReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReader{r: reader, remaining: limit}, nil
+}
+
+// limitedReader fails with ErrTooLarge instead of truncating at its limit
+type limitedReader struct {
+	r         io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	// Read one byte past the limit to tell a body of exactly limit bytes from a longer one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedReader) Close() error {
+	return l.r.Close()
+}
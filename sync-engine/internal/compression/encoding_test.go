@@ -0,0 +1,79 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                         Identity,
+		"gzip":                     Gzip,
+		"GZIP;q=0.5":               Gzip,
+		"br, zstd":                 Zstd,
+		"zstd;q=1, gzip;q=0.2":     Zstd,
+		"zstd;q=0.2, gzip":         Gzip,
+		"gzip, zstd":               Zstd,
+		"gzip;q=0":                 Identity,
+		"*":                        Zstd,
+		"*;q=0.1, zstd;q=0":        Gzip,
+		"*;q=0.1, gzip;q=0":        Zstd,
+		"deflate, gzip;q=0.8, br ": Gzip,
+	}
+	for header, want := range tests {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestNewReaderLimit(t *testing.T) {
+	payload := []byte(strings.Repeat("a", 100))
+	for _, encoding := range Supported() {
+		var compressed bytes.Buffer
+		w, err := NewWriter(encoding, &compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(payload)
+		w.Close()
+
+		r, err := NewReader(encoding, bytes.NewReader(compressed.Bytes()), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("%s: read %d bytes, err = %v; want the payload", encoding, len(got), err)
+		}
+		r.Close()
+
+		r, _ = NewReader(encoding, bytes.NewReader(compressed.Bytes()), 99)
+		if _, err := io.ReadAll(r); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s over limit: err = %v, want ErrTooLarge", encoding, err)
+		}
+		r.Close()
+	}
+
+	r, _ := NewReader("", bytes.NewReader(payload), 10)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("identity over limit: err = %v, want ErrTooLarge", err)
+	}
+
+	if _, err := NewReader("br", bytes.NewReader(nil), 10); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("br: err = %v, want ErrUnsupportedEncoding", err)
+	}
+}
+
+func TestZstdReaderRejectsGarbage(t *testing.T) {
+	r, err := NewReader(Zstd, strings.NewReader("not zstd"), 100)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("expected an error for a body that is not zstd")
+	}
+}
@@ -37,11 +37,12 @@ type PostgresConfig struct {
 }
 
 type RedisConfig struct {
-	Host     string        `yaml:"host"`
-	Port     int           `yaml:"port"`
-	Password string        `yaml:"password"`
-	DB       int           `yaml:"db"`
-	Streams  StreamsConfig `yaml:"streams"`
+	Host           string        `yaml:"host"`
+	Port           int           `yaml:"port"`
+	Password       string        `yaml:"password"`
+	DB             int           `yaml:"db"`
+	Streams        StreamsConfig `yaml:"streams"`
+	ChangesChannel string        `yaml:"changes_channel"` // Pub/sub channel that announces queued changes to every replica
 }
 
 type StreamsConfig struct {
@@ -57,20 +58,66 @@ type SSEConfig struct {
 }
 
 type SyncConfig struct {
-	BatchSize            int        `yaml:"batch_size"`
-	Compression          bool       `yaml:"compression"`
-	CompressionThreshold int        `yaml:"compression_threshold"`
-	ConflictResolution   string     `yaml:"conflict_resolution"`
-	RetryAttempts        int        `yaml:"retry_attempts"`
-	RetryBackoff         string     `yaml:"retry_backoff"`
-	WAL                  WALConfig  `yaml:"wal"`
+	BatchSize            int          `yaml:"batch_size"`
+	Compression          bool         `yaml:"compression"`
+	CompressionThreshold int          `yaml:"compression_threshold"`
+	MaxUploadBytes       int64        `yaml:"max_upload_bytes"` // Largest upload body after decompression (default: 10 MiB)
+	ConflictResolution   string       `yaml:"conflict_resolution"`
+	RetryAttempts        int          `yaml:"retry_attempts"`
+	RetryBackoff         string       `yaml:"retry_backoff"`
+	ChangeSource         string       `yaml:"change_source"` // Options: "wal", "notify", "polling"
+	CursorSecret         string       `yaml:"cursor_secret"` // Key that signs incoming sync cursors (default: auth.jwt_secret)
+	HLCMaxDrift          string       `yaml:"hlc_max_drift"` // How far ahead of the server a device's clock is trusted (default: 5m)
+	WAL                  WALConfig    `yaml:"wal"`
+	Notify               NotifyConfig `yaml:"notify"`
+	Queue                QueueConfig  `yaml:"queue"`
+	Rules                []SyncRule   `yaml:"rules"`
+	Leader               LeaderConfig `yaml:"leader"`
+}
+
+// SyncRule describes how rows of one table are routed to devices
+type SyncRule struct {
+	Table         string   `yaml:"table"`          // "table" or "schema.table"; rows are keyed by their id column
+	Mode          string   `yaml:"mode"`           // Options: "column", "join", "broadcast"
+	UserColumns   []string `yaml:"user_columns"`   // column mode: columns holding target user IDs
+	Join          string   `yaml:"join"`           // join mode: query returning target user IDs, $1 is the join_column value
+	JoinColumn    string   `yaml:"join_column"`    // join mode: column passed as $1 (default "id")
+	OriginColumns []string `yaml:"origin_columns"` // Columns holding the authoring user, whose devices skip inserts and updates
 }
 
 type WALConfig struct {
-	Enabled      bool   `yaml:"enabled"`
-	SlotName     string `yaml:"slot_name"`     // If empty, auto-generated from tenant DB name
-	BatchSize    int    `yaml:"batch_size"`    // Number of changes to read per batch
-	ReadInterval string `yaml:"read_interval"` // How often to read WAL changes
+	Enabled             bool              `yaml:"enabled"`
+	SlotName            string            `yaml:"slot_name"`             // If empty, auto-generated from tenant DB name
+	Publication         string            `yaml:"publication"`           // Publication streamed by the pgoutput plugin
+	BatchSize           int               `yaml:"batch_size"`            // Number of changes to read per batch
+	ReadInterval        string            `yaml:"read_interval"`         // How often to read WAL changes
+	StatusInterval      string            `yaml:"status_interval"`       // How often to send standby status updates
+	Tables              []string          `yaml:"tables"`                // Tables in the publication ("table" or "schema.table")
+	SpillDir            string            `yaml:"spill_dir"`             // Directory for large in-progress transactions (default: system temp dir)
+	ReplicaIdentityFull bool              `yaml:"replica_identity_full"` // Set REPLICA IDENTITY FULL on tables whose deletes lack routing columns
+	Monitor             SlotMonitorConfig `yaml:"monitor"`
+}
+
+type SlotMonitorConfig struct {
+	Interval         string `yaml:"interval"`           // How often to check slot lag
+	MaxRetainedBytes int64  `yaml:"max_retained_bytes"` // Retained WAL that triggers the action
+	Action           string `yaml:"action"`             // Options: "warn", "resync_stale", "recreate_slot"
+	StaleDeviceAge   string `yaml:"stale_device_age"`   // Devices not synced or seen for this long are resynced by "resync_stale"
+}
+
+type NotifyConfig struct {
+	Channel string   `yaml:"channel"` // LISTEN/NOTIFY channel used by the change triggers
+	Tables  []string `yaml:"tables"`  // Tables with change triggers ("table" or "schema.table")
+}
+
+type QueueConfig struct {
+	MaxChangesPerDevice int    `yaml:"max_changes_per_device"` // Queue length that overflows a device into a full resync
+	MaxAge              string `yaml:"max_age"`                // Undelivered changes older than this overflow the device
+}
+
+type LeaderConfig struct {
+	LockName      string `yaml:"lock_name"`      // Advisory lock held by the replica that captures changes
+	CheckInterval string `yaml:"check_interval"` // How often standbys retry the lock and the leader checks it still holds it
 }
 
 type AuthConfig struct {
@@ -120,10 +167,93 @@ func LoadConfig(path string) (*Config, error) {
 	if config.Sync.WAL.ReadInterval == "" {
 		config.Sync.WAL.ReadInterval = "1s"
 	}
+	if config.Sync.WAL.StatusInterval == "" {
+		config.Sync.WAL.StatusInterval = "10s"
+	}
+	if config.Sync.WAL.Publication == "" {
+		config.Sync.WAL.Publication = "posduif_sync"
+	}
+	if len(config.Sync.Rules) == 0 {
+		// Route chat messages to the recipient, as before sync rules existed
+		config.Sync.Rules = []SyncRule{{
+			Table:         "messages",
+			Mode:          "column",
+			UserColumns:   []string{"recipient_id"},
+			OriginColumns: []string{"sender_id"},
+		}}
+	}
+	if len(config.Sync.WAL.Tables) == 0 {
+		config.Sync.WAL.Tables = config.Sync.RuleTables()
+	}
+	if config.Sync.WAL.Monitor.Interval == "" {
+		config.Sync.WAL.Monitor.Interval = "30s"
+	}
+	if config.Sync.WAL.Monitor.MaxRetainedBytes == 0 {
+		config.Sync.WAL.Monitor.MaxRetainedBytes = 1 << 30 // 1 GiB
+	}
+	if config.Sync.WAL.Monitor.Action == "" {
+		config.Sync.WAL.Monitor.Action = "warn"
+	}
+	if config.Sync.WAL.Monitor.StaleDeviceAge == "" {
+		config.Sync.WAL.Monitor.StaleDeviceAge = "168h"
+	}
+	if config.Sync.ChangeSource == "" {
+		// Keep the behaviour of configs written before change_source existed
+		if config.Sync.WAL.Enabled {
+			config.Sync.ChangeSource = "wal"
+		} else {
+			config.Sync.ChangeSource = "polling"
+		}
+	}
+	if config.Sync.Notify.Channel == "" {
+		config.Sync.Notify.Channel = "posduif_changes"
+	}
+	if len(config.Sync.Notify.Tables) == 0 {
+		config.Sync.Notify.Tables = config.Sync.RuleTables()
+	}
+	if config.Sync.Queue.MaxChangesPerDevice == 0 {
+		config.Sync.Queue.MaxChangesPerDevice = 10000
+	}
+	if config.Sync.Queue.MaxAge == "" {
+		config.Sync.Queue.MaxAge = "168h"
+	}
 	if config.Auth.JWTExpiration == 0 {
 		config.Auth.JWTExpiration = 3600
 	}
 
+	if config.Redis.ChangesChannel == "" {
+		config.Redis.ChangesChannel = "posduif:changes:" + config.Postgres.DB
+	}
+	if config.Sync.Leader.LockName == "" {
+		config.Sync.Leader.LockName = "posduif_change_source"
+	}
+	if config.Sync.Leader.CheckInterval == "" {
+		config.Sync.Leader.CheckInterval = "5s"
+	}
+	if config.Sync.RetryAttempts == 0 {
+		config.Sync.RetryAttempts = 3
+	}
+	if config.Sync.RetryBackoff == "" {
+		config.Sync.RetryBackoff = "2s"
+	}
+	if config.Sync.ConflictResolution == "" {
+		config.Sync.ConflictResolution = "last_write_wins"
+	}
+	if config.Sync.MaxUploadBytes == 0 {
+		config.Sync.MaxUploadBytes = 10 << 20
+	}
+	if config.Sync.HLCMaxDrift == "" {
+		config.Sync.HLCMaxDrift = "5m"
+	}
+	if config.Sync.CursorSecret == "" {
+		config.Sync.CursorSecret = config.Auth.JWTSecret
+	}
+	for i := range config.Sync.Rules {
+		if config.Sync.Rules[i].Mode == "join" && config.Sync.Rules[i].JoinColumn == "" {
+			config.Sync.Rules[i].JoinColumn = "id"
+		}
+	}
+
 	// Set CORS defaults
 	if len(config.CORS.AllowedMethods) == 0 {
 		config.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
@@ -134,3 +264,12 @@ func LoadConfig(path string) (*Config, error) {
 
 	return &config, nil
 }
+
+// RuleTables returns the tables covered by the sync rules
+func (c *SyncConfig) RuleTables() []string {
+	tables := make([]string, 0, len(c.Rules))
+	for _, rule := range c.Rules {
+		tables = append(tables, rule.Table)
+	}
+	return tables
+}
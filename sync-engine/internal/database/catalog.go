@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetPrimaryKeyColumns returns the primary key columns of a table, given as
+// "table" or "schema.table", in key order. A table without a primary key has none.
+func (db *DB) GetPrimaryKeyColumns(ctx context.Context, table string) ([]string, error) {
+	query := `SELECT a.attname
+	          FROM pg_index i
+	          CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, position)
+	          JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+	          WHERE i.indrelid = $1::regclass AND i.indisprimary
+	          ORDER BY k.position`
+
+	rows, err := db.Pool.Query(ctx, query, parseTableName(table).Sanitize())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary key of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// GetTypeOIDs resolves type names, which may be schema-qualified, to their OIDs.
+// Names of types that do not exist are left out of the result.
+func (db *DB) GetTypeOIDs(ctx context.Context, names []string) (map[string]uint32, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT name, to_regtype(name)::oid FROM unnest($1::text[]) AS name
+	                                 WHERE to_regtype(name) IS NOT NULL`, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	oids := make(map[string]uint32, len(names))
+	for rows.Next() {
+		var name string
+		var oid uint32
+		if err := rows.Scan(&name, &oid); err != nil {
+			return nil, err
+		}
+		oids[name] = oid
+	}
+	return oids, rows.Err()
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/models"
+)
+
+// ChangeQueueWriter queues the changes of one committed transaction in a single
+// database transaction, so a concurrent GetQueuedChanges never observes part of
+// it. A large transaction can be queued in several batches.
+type ChangeQueueWriter struct {
+	tx        pgx.Tx
+	deviceIDs []string
+	seen      map[string]bool
+}
+
+// BeginEnqueue starts queuing the changes of a committed transaction
+func (db *DB) BeginEnqueue(ctx context.Context) (*ChangeQueueWriter, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &ChangeQueueWriter{tx: tx, seen: make(map[string]bool)}, nil
+}
+
+// Enqueue stores routed changes in the device change queues. Changes a device
+// has already synced past, and changes already queued (a transaction replayed
+// after a restart), are skipped. A change's seq is its position in the
+// transaction, so a replay queues it at the same (lsn, seq) again.
+// A device keeps at most one queued change per row key: a later change of the
+// row is merged into the queued one, which moves to the later position. An
+// update on top of an insert or update keeps the earlier operation and old row
+// and adds its columns to the earlier ones, which also fills in unchanged TOAST
+// values that pgoutput leaves out. Deletes, and inserts after a delete, replace
+// the queued change. So a device that was offline receives only the latest
+// state of each row, or a tombstone if it was deleted.
+func (w *ChangeQueueWriter) Enqueue(ctx context.Context, changes []models.QueuedChange) error {
+	insertQuery := `INSERT INTO device_change_queue
+	                (device_id, lsn, seq, xid, schema_name, table_name, operation, columns, old_columns, commit_time)
+	                SELECT $1, $2::pg_lsn, $3, $4, $5, $6, $7, $8, $9, $10
+	                WHERE NOT EXISTS (
+	                    SELECT 1 FROM sync_metadata
+	                    WHERE device_id = $1 AND last_synced_lsn >= $2::pg_lsn
+	                )
+	                ON CONFLICT (device_id, lsn, seq) DO NOTHING`
+
+	// The conflict target is the row: only a change at a later position than
+	// the queued one is merged, so replayed transactions are still skipped
+	upsertQuery := `INSERT INTO device_change_queue AS q
+	                (device_id, lsn, seq, xid, schema_name, table_name, operation, columns, old_columns, commit_time, row_key)
+	                SELECT $1, $2::pg_lsn, $3, $4, $5, $6, $7, $8, $9, $10, $11
+	                WHERE NOT EXISTS (
+	                    SELECT 1 FROM sync_metadata
+	                    WHERE device_id = $1 AND last_synced_lsn >= $2::pg_lsn
+	                )
+	                ON CONFLICT (device_id, schema_name, table_name, row_key) WHERE row_key IS NOT NULL
+	                DO UPDATE SET
+	                lsn = EXCLUDED.lsn, seq = EXCLUDED.seq, xid = EXCLUDED.xid, commit_time = EXCLUDED.commit_time,
+	                operation = CASE WHEN EXCLUDED.operation = 'UPDATE' AND q.operation <> 'DELETE'
+	                                 THEN q.operation ELSE EXCLUDED.operation END,
+	                old_columns = CASE WHEN EXCLUDED.operation = 'UPDATE' AND q.operation <> 'DELETE'
+	                                   THEN q.old_columns ELSE EXCLUDED.old_columns END,
+	                columns = CASE WHEN EXCLUDED.operation = 'UPDATE' AND q.operation <> 'DELETE'
+	                               THEN q.columns || EXCLUDED.columns ELSE EXCLUDED.columns END
+	                WHERE (q.lsn, q.seq) < (EXCLUDED.lsn, EXCLUDED.seq)`
+
+	for _, change := range changes {
+		columns, err := json.Marshal(change.Columns)
+		if err != nil {
+			return fmt.Errorf("failed to encode columns: %w", err)
+		}
+		oldColumns, err := json.Marshal(change.OldColumns)
+		if err != nil {
+			return fmt.Errorf("failed to encode old columns: %w", err)
+		}
+
+		if change.RowKey == "" {
+			_, err = w.tx.Exec(ctx, insertQuery,
+				change.DeviceID, change.LSN.String(), change.Seq, int64(change.XID),
+				change.Schema, change.Table, change.Operation, columns, oldColumns, change.CommitTime,
+			)
+		} else {
+			_, err = w.tx.Exec(ctx, upsertQuery,
+				change.DeviceID, change.LSN.String(), change.Seq, int64(change.XID),
+				change.Schema, change.Table, change.Operation, columns, oldColumns, change.CommitTime,
+				change.RowKey,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to queue change: %w", err)
+		}
+
+		if !w.seen[change.DeviceID] {
+			w.seen[change.DeviceID] = true
+			w.deviceIDs = append(w.deviceIDs, change.DeviceID)
+		}
+	}
+	return nil
+}
+
+// Commit commits the queued changes. Devices whose queue now exceeds
+// maxPerDevice entries or holds an entry older than maxAge are overflowed:
+// their queue is dropped and they are marked for a full resync. The overflowed
+// device IDs are returned.
+func (w *ChangeQueueWriter) Commit(ctx context.Context, maxPerDevice int, maxAge time.Duration) ([]string, error) {
+	overflowQuery := `SELECT device_id FROM device_change_queue
+	                  WHERE device_id = ANY($1)
+	                  GROUP BY device_id
+	                  HAVING COUNT(*) > $2 OR MIN(queued_at) < $3`
+
+	rows, err := w.tx.Query(ctx, overflowQuery, w.deviceIDs, maxPerDevice, time.Now().Add(-maxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check queue retention: %w", err)
+	}
+	var overflowed []string
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		overflowed = append(overflowed, deviceID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(overflowed) > 0 {
+		if _, err := w.tx.Exec(ctx, `DELETE FROM device_change_queue WHERE device_id = ANY($1)`, overflowed); err != nil {
+			return nil, fmt.Errorf("failed to drop overflowed queues: %w", err)
+		}
+
+		resyncQuery := `INSERT INTO sync_metadata (device_id, needs_full_resync, resync_requested_at)
+		                SELECT unnest($1::text[]), true, NOW()
+		                ON CONFLICT (device_id) DO UPDATE SET
+		                needs_full_resync = true, last_synced_lsn = NULL,
+		                resync_requested_at = NOW(), updated_at = NOW()`
+		if _, err := w.tx.Exec(ctx, resyncQuery, overflowed); err != nil {
+			return nil, fmt.Errorf("failed to mark overflowed devices for full resync: %w", err)
+		}
+	}
+
+	if err := w.tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return overflowed, nil
+}
+
+// Rollback abandons the queued changes. It does nothing after Commit.
+func (w *ChangeQueueWriter) Rollback(ctx context.Context) {
+	w.tx.Rollback(ctx)
+}
+
+// GetQueuedChanges returns a device's queued changes committed after afterLSN, in
+// commit order. Every transaction that starts within the first limit changes is
+// returned whole, so the caller can trim without splitting a transaction.
+func (db *DB) GetQueuedChanges(ctx context.Context, deviceID string, afterLSN models.LSN, limit int) ([]models.QueuedChange, error) {
+	query := `SELECT device_id, lsn::text, seq, xid, schema_name, table_name, operation,
+	          columns, old_columns, commit_time
+	          FROM device_change_queue
+	          WHERE device_id = $1 AND lsn > $2::pg_lsn
+	          AND lsn <= (
+	              SELECT MAX(lsn) FROM (
+	                  SELECT lsn FROM device_change_queue
+	                  WHERE device_id = $1 AND lsn > $2::pg_lsn
+	                  ORDER BY lsn, seq
+	                  LIMIT $3
+	              ) first_changes
+	          )
+	          ORDER BY lsn, seq`
+
+	rows, err := db.Pool.Query(ctx, query, deviceID, afterLSN.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []models.QueuedChange
+	for rows.Next() {
+		var change models.QueuedChange
+		var lsn string
+		var xid int64
+		var columns, oldColumns []byte
+		err := rows.Scan(
+			&change.DeviceID, &lsn, &change.Seq, &xid, &change.Schema, &change.Table,
+			&change.Operation, &columns, &oldColumns, &change.CommitTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if change.LSN, err = models.ParseLSN(lsn); err != nil {
+			return nil, err
+		}
+		change.XID = uint32(xid)
+		if change.Columns, err = DecodeColumns(columns); err != nil {
+			return nil, fmt.Errorf("failed to decode columns: %w", err)
+		}
+		if change.OldColumns, err = DecodeColumns(oldColumns); err != nil {
+			return nil, fmt.Errorf("failed to decode old columns: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// HasQueuedChanges reports whether a device has queued changes committed after afterLSN
+func (db *DB) HasQueuedChanges(ctx context.Context, deviceID string, afterLSN models.LSN) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM device_change_queue WHERE device_id = $1 AND lsn > $2::pg_lsn)`
+
+	var exists bool
+	if err := db.Pool.QueryRow(ctx, query, deviceID, afterLSN.String()).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// AcknowledgeChanges records that a device applied its queued changes up to
+// and including lsn: last_synced_lsn is advanced and the changes are removed.
+// It returns false, changing nothing, if the device already acknowledged lsn or
+// is waiting for a full resync.
+func (db *DB) AcknowledgeChanges(ctx context.Context, deviceID string, lsn models.LSN) (bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE sync_metadata
+	          SET last_synced_lsn = $2::pg_lsn, last_sync_timestamp = NOW(), sync_status = 'idle', updated_at = NOW()
+	          WHERE device_id = $1 AND NOT needs_full_resync
+	          AND (last_synced_lsn IS NULL OR last_synced_lsn < $2::pg_lsn)`
+	tag, err := tx.Exec(ctx, query, deviceID, lsn.String())
+	if err != nil {
+		return false, fmt.Errorf("failed to advance last synced LSN: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM device_change_queue WHERE device_id = $1 AND lsn <= $2::pg_lsn`, deviceID, lsn.String()); err != nil {
+		return false, fmt.Errorf("failed to clear queued changes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteQueuedTransaction removes a device's queued changes of the transaction
+// committed at lsn
+func (db *DB) DeleteQueuedTransaction(ctx context.Context, deviceID string, lsn models.LSN) error {
+	query := `DELETE FROM device_change_queue WHERE device_id = $1 AND lsn = $2::pg_lsn`
+	_, err := db.Pool.Exec(ctx, query, deviceID, lsn.String())
+	return err
+}
+
+// DecodeColumns decodes a JSON row. Numbers are kept as json.Number so that
+// bigint and numeric values are not rounded through float64.
+func DecodeColumns(data []byte) (map[string]interface{}, error) {
+	var columns map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&columns); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/models"
+)
+
+var (
+	// ErrConflictResolved is returned when resolving a conflict that was already resolved
+	ErrConflictResolved = errors.New("conflict already resolved")
+	// ErrConflictOutdated is returned when resolving a conflict for the device
+	// after the row changed again on the server
+	ErrConflictOutdated = errors.New("row changed since the conflict was recorded")
+)
+
+const conflictColumns = `id::text, table_name, row_id, device_id, user_id::text, server_data, device_data,
+	          base_hlc, strategy, status, resolution, resolved_by::text, resolved_at, created_at`
+
+// GetMessageByID returns a message, or pgx.ErrNoRows if there is none
+func (db *DB) GetMessageByID(ctx context.Context, messageID string) (*models.Message, error) {
+	var msg models.Message
+	query := `SELECT id::text, sender_id::text, recipient_id::text, content, status,
+	          created_at, updated_at, synced_at, read_at, hlc
+	          FROM messages WHERE id = $1`
+
+	err := db.Pool.QueryRow(ctx, query, messageID).Scan(
+		&msg.ID, &msg.SenderID, &msg.RecipientID, &msg.Content, &msg.Status,
+		&msg.CreatedAt, &msg.UpdatedAt, &msg.SyncedAt, &msg.ReadAt, &msg.HLC,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// UpdateMessageContent applies an edit stamped hlc to a message if its content
+// is still at version baseHLC, recording conflict, if not nil, in the same
+// transaction. It returns false, changing nothing, if the message changed since.
+func (db *DB) UpdateMessageContent(ctx context.Context, messageID, content, hlc, baseHLC string, conflict *models.SyncConflict) (bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE messages SET content = $2, hlc = $3, updated_at = NOW()
+	          WHERE id = $1 AND hlc = $4`
+	tag, err := tx.Exec(ctx, query, messageID, content, hlc, baseHLC)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if conflict != nil {
+		if err := createConflict(ctx, tx, conflict); err != nil {
+			return false, fmt.Errorf("failed to record conflict: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// CreateConflict records a conflict, filling in its ID and creation time
+func (db *DB) CreateConflict(ctx context.Context, c *models.SyncConflict) error {
+	return createConflict(ctx, db.Pool, c)
+}
+
+func createConflict(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}, c *models.SyncConflict) error {
+	query := `INSERT INTO sync_conflicts (table_name, row_id, device_id, user_id, server_data,
+	          device_data, base_hlc, strategy, status, resolution, resolved_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	          RETURNING id::text, created_at`
+
+	return q.QueryRow(ctx, query,
+		c.TableName, c.RowID, c.DeviceID, c.UserID, c.ServerData,
+		c.DeviceData, c.BaseHLC, c.Strategy, c.Status, c.Resolution, c.ResolvedAt,
+	).Scan(&c.ID, &c.CreatedAt)
+}
+
+// ListConflicts returns a user's conflicts, newest first
+func (db *DB) ListConflicts(ctx context.Context, filter models.ConflictFilter) ([]models.SyncConflict, error) {
+	query := `SELECT ` + conflictColumns + `
+	          FROM sync_conflicts
+	          WHERE user_id::text = $1 AND ($2 = '' OR status = $2)
+	          ORDER BY created_at DESC
+	          LIMIT $3 OFFSET $4`
+
+	rows, err := db.Pool.Query(ctx, query, filter.UserID, filter.Status, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := make([]models.SyncConflict, 0)
+	for rows.Next() {
+		c, err := scanConflict(rows)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, *c)
+	}
+	return conflicts, rows.Err()
+}
+
+// ResolveConflict closes one of a user's open conflicts. Resolving it for the
+// device applies the device's version of the message, stamped hlc, unless the
+// message changed since the conflict was recorded. It returns pgx.ErrNoRows if the user
+// has no such conflict, ErrConflictResolved if it is closed and
+// ErrConflictOutdated if the message changed.
+func (db *DB) ResolveConflict(ctx context.Context, conflictID, userID, resolution, hlc string) (*models.SyncConflict, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT ` + conflictColumns + `
+	          FROM sync_conflicts
+	          WHERE id::text = $1 AND user_id::text = $2
+	          FOR UPDATE`
+	c, err := scanConflict(tx.QueryRow(ctx, query, conflictID, userID))
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != "open" {
+		return c, ErrConflictResolved
+	}
+
+	if resolution == "device" {
+		if c.TableName != "messages" {
+			return nil, fmt.Errorf("cannot apply device version of a %s row", c.TableName)
+		}
+		var server models.Message
+		if err := json.Unmarshal(c.ServerData, &server); err != nil {
+			return nil, fmt.Errorf("failed to decode server version: %w", err)
+		}
+		tag, err := tx.Exec(ctx, `UPDATE messages SET content = $2::jsonb->>'content', hlc = $4, updated_at = NOW()
+		          WHERE id::text = $1 AND hlc = $3`,
+			c.RowID, c.DeviceData, server.HLC, hlc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply device version: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return c, ErrConflictOutdated
+		}
+	}
+
+	err = tx.QueryRow(ctx, `UPDATE sync_conflicts
+	          SET status = 'resolved', resolution = $2, resolved_by = $3, resolved_at = NOW()
+	          WHERE id = $1
+	          RETURNING status, resolution, resolved_by::text, resolved_at`,
+		c.ID, resolution, userID,
+	).Scan(&c.Status, &c.Resolution, &c.ResolvedBy, &c.ResolvedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve conflict: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return c, nil
+}
+
+func scanConflict(row pgx.Row) (*models.SyncConflict, error) {
+	var c models.SyncConflict
+	err := row.Scan(
+		&c.ID, &c.TableName, &c.RowID, &c.DeviceID, &c.UserID, &c.ServerData, &c.DeviceData,
+		&c.BaseHLC, &c.Strategy, &c.Status, &c.Resolution, &c.ResolvedBy, &c.ResolvedAt, &c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
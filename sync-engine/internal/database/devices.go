@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+
+	"posduif/sync-engine/internal/models"
+)
+
+// upsertDeviceQuery records an enrolled device. Re-enrolling a device moves it
+// to the enrolling user and refreshes its platform info.
+const upsertDeviceQuery = `INSERT INTO devices (id, user_id, platform, model, os_version, app_version,
+                           device_info, enrolled_at, last_seen, created_at, updated_at)
+                           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $8, $8)
+                           ON CONFLICT (id) DO UPDATE SET
+                           user_id = EXCLUDED.user_id,
+                           platform = EXCLUDED.platform,
+                           model = EXCLUDED.model,
+                           os_version = EXCLUDED.os_version,
+                           app_version = EXCLUDED.app_version,
+                           device_info = EXCLUDED.device_info,
+                           enrolled_at = EXCLUDED.enrolled_at,
+                           last_seen = EXCLUDED.last_seen,
+                           updated_at = EXCLUDED.updated_at`
+
+// GetDevicesByUserID returns a user's enrolled devices, most recently enrolled first
+func (db *DB) GetDevicesByUserID(ctx context.Context, userID string) ([]models.Device, error) {
+	query := `SELECT id, user_id, platform, model, os_version, app_version, device_info,
+	          enrolled_at, last_seen, created_at, updated_at
+	          FROM devices WHERE user_id::text = $1
+	          ORDER BY enrolled_at DESC`
+
+	rows, err := db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make([]models.Device, 0)
+	for rows.Next() {
+		var device models.Device
+		err := rows.Scan(
+			&device.ID, &device.UserID, &device.Platform, &device.Model,
+			&device.OSVersion, &device.AppVersion, &device.DeviceInfo,
+			&device.EnrolledAt, &device.LastSeen, &device.CreatedAt, &device.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
+
+// GetDeviceIDsForUser returns the IDs of a user's enrolled devices
+func (db *DB) GetDeviceIDsForUser(ctx context.Context, userID string) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT id FROM devices WHERE user_id::text = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deviceIDs := make([]string, 0)
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	return deviceIDs, rows.Err()
+}
+
+// GetEnrolledDeviceIDs returns the IDs of all enrolled devices
+func (db *DB) GetEnrolledDeviceIDs(ctx context.Context) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT id FROM devices`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deviceIDs []string
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	return deviceIDs, rows.Err()
+}
+
+// GetDeviceUserID returns the ID of the user a device is enrolled for
+func (db *DB) GetDeviceUserID(ctx context.Context, deviceID string) (string, error) {
+	var userID string
+	err := db.Pool.QueryRow(ctx, `SELECT user_id::text FROM devices WHERE id = $1`, deviceID).Scan(&userID)
+	return userID, err
+}
+
+// TouchDevice records that a device has just contacted the server
+func (db *DB) TouchDevice(ctx context.Context, deviceID string) error {
+	_, err := db.Pool.Exec(ctx, `UPDATE devices SET last_seen = NOW() WHERE id = $1`, deviceID)
+	return err
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LeaderLock is a session-level advisory lock held on a dedicated connection.
+// PostgreSQL releases it when the connection closes, including when the
+// holding process dies, so another replica can take over.
+type LeaderLock struct {
+	conn *pgx.Conn
+}
+
+// TryLeaderLock tries to take the advisory lock identified by name without
+// waiting. It returns nil if another session holds the lock.
+func (db *DB) TryLeaderLock(ctx context.Context, name string) (*LeaderLock, error) {
+	conn, err := pgx.ConnectConfig(ctx, db.Pool.Config().ConnConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open leader lock connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&acquired); err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("failed to try leader lock: %w", err)
+	}
+	if !acquired {
+		conn.Close(ctx)
+		return nil, nil
+	}
+
+	return &LeaderLock{conn: conn}, nil
+}
+
+// Check returns an error if the lock's connection is lost, and with it the lock
+func (l *LeaderLock) Check(ctx context.Context) error {
+	return l.conn.Ping(ctx)
+}
+
+// Release gives up the lock by closing its connection
+func (l *LeaderLock) Release(ctx context.Context) error {
+	return l.conn.Close(ctx)
+}
@@ -17,6 +17,46 @@ func (db *DB) RunMigrations(ctx context.Context) error {
 		return fmt.Errorf("migration 2 failed: %w", err)
 	}
 
+	// Migration 3: Add needs_full_resync column to sync_metadata
+	if err := db.migrationAddFullResyncColumn(ctx); err != nil {
+		return fmt.Errorf("migration 3 failed: %w", err)
+	}
+
+	// Migration 4: Create durable per-device change queue
+	if err := db.migrationCreateChangeQueue(ctx); err != nil {
+		return fmt.Errorf("migration 4 failed: %w", err)
+	}
+
+	// Migration 5: Add snapshot bootstrap columns to sync_metadata
+	if err := db.migrationAddSnapshotColumns(ctx); err != nil {
+		return fmt.Errorf("migration 5 failed: %w", err)
+	}
+
+	// Migration 6: Create devices table for multiple devices per user
+	if err := db.migrationCreateDevices(ctx); err != nil {
+		return fmt.Errorf("migration 6 failed: %w", err)
+	}
+
+	// Migration 7: Create sync_conflicts table for conflicting device edits
+	if err := db.migrationCreateSyncConflicts(ctx); err != nil {
+		return fmt.Errorf("migration 7 failed: %w", err)
+	}
+
+	// Migration 8: Add hybrid logical clock column to messages
+	if err := db.migrationAddMessageHLC(ctx); err != nil {
+		return fmt.Errorf("migration 8 failed: %w", err)
+	}
+
+	// Migration 9: Add snapshot paging position columns to sync_metadata
+	if err := db.migrationAddSnapshotPosition(ctx); err != nil {
+		return fmt.Errorf("migration 9 failed: %w", err)
+	}
+
+	// Migration 10: Key queued changes by row so they coalesce in the queue
+	if err := db.migrationAddQueueRowKey(ctx); err != nil {
+		return fmt.Errorf("migration 10 failed: %w", err)
+	}
+
 	return nil
 }
 
@@ -85,3 +125,310 @@ func (db *DB) migrationCreateLSNIndex(ctx context.Context) error {
 
 	return nil
 }
+
+// migrationAddFullResyncColumn adds the needs_full_resync column to sync_metadata table
+func (db *DB) migrationAddFullResyncColumn(ctx context.Context) error {
+	// Check if column already exists
+	var exists bool
+	checkQuery := `
+		SELECT EXISTS (
+			SELECT 1 
+			FROM information_schema.columns 
+			WHERE table_name = 'sync_metadata' 
+			AND column_name = 'needs_full_resync'
+		)
+	`
+	err := db.Pool.QueryRow(ctx, checkQuery).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if column exists: %w", err)
+	}
+
+	if exists {
+		return nil // Column already exists, skip migration
+	}
+
+	// Add the column
+	alterQuery := `ALTER TABLE sync_metadata ADD COLUMN needs_full_resync BOOLEAN NOT NULL DEFAULT false`
+	_, err = db.Pool.Exec(ctx, alterQuery)
+	if err != nil {
+		return fmt.Errorf("failed to add needs_full_resync column: %w", err)
+	}
+
+	return nil
+}
+
+// migrationCreateChangeQueue creates the device_change_queue table that holds
+// tracked changes until each device has synced them
+func (db *DB) migrationCreateChangeQueue(ctx context.Context) error {
+	createTableQuery := `
+		CREATE TABLE IF NOT EXISTS device_change_queue (
+			id BIGSERIAL PRIMARY KEY,
+			device_id VARCHAR(255) NOT NULL,
+			lsn pg_lsn NOT NULL,
+			seq INTEGER NOT NULL,
+			xid BIGINT NOT NULL,
+			schema_name TEXT NOT NULL,
+			table_name TEXT NOT NULL,
+			operation VARCHAR(10) NOT NULL,
+			columns JSONB,
+			old_columns JSONB,
+			commit_time TIMESTAMPTZ NOT NULL,
+			queued_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			UNIQUE (device_id, lsn, seq)
+		)
+	`
+	_, err := db.Pool.Exec(ctx, createTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create device_change_queue table: %w", err)
+	}
+
+	return nil
+}
+
+// migrationAddSnapshotColumns adds the columns that track a device's initial
+// snapshot to sync_metadata table
+func (db *DB) migrationAddSnapshotColumns(ctx context.Context) error {
+	// Check if columns already exist
+	var exists bool
+	checkQuery := `
+		SELECT EXISTS (
+			SELECT 1 
+			FROM information_schema.columns 
+			WHERE table_name = 'sync_metadata' 
+			AND column_name = 'snapshot'
+		)
+	`
+	err := db.Pool.QueryRow(ctx, checkQuery).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if column exists: %w", err)
+	}
+
+	if exists {
+		return nil // Columns already exist, skip migration
+	}
+
+	// Add the columns
+	alterQuery := `ALTER TABLE sync_metadata
+		ADD COLUMN snapshot TEXT,
+		ADD COLUMN snapshot_lsn pg_lsn,
+		ADD COLUMN resync_requested_at TIMESTAMPTZ`
+	_, err = db.Pool.Exec(ctx, alterQuery)
+	if err != nil {
+		return fmt.Errorf("failed to add snapshot columns: %w", err)
+	}
+
+	return nil
+}
+
+// migrationCreateDevices creates the devices table, one row per enrolled
+// device, and backfills it from users.device_id
+func (db *DB) migrationCreateDevices(ctx context.Context) error {
+	createTableQuery := `
+		CREATE TABLE IF NOT EXISTS devices (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			platform VARCHAR(50),
+			model VARCHAR(255),
+			os_version VARCHAR(50),
+			app_version VARCHAR(50),
+			device_info JSONB,
+			enrolled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_seen TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`
+	_, err := db.Pool.Exec(ctx, createTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create devices table: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id)`)
+	if err != nil {
+		return fmt.Errorf("failed to create devices index: %w", err)
+	}
+
+	// Devices enrolled before this table existed are only recorded on the user
+	backfillQuery := `
+		INSERT INTO devices (id, user_id, enrolled_at, last_seen)
+		SELECT device_id, id, COALESCE(enrolled_at, created_at, NOW()), last_seen
+		FROM users
+		WHERE device_id IS NOT NULL AND device_id <> ''
+		ON CONFLICT (id) DO NOTHING
+	`
+	_, err = db.Pool.Exec(ctx, backfillQuery)
+	if err != nil {
+		return fmt.Errorf("failed to backfill devices: %w", err)
+	}
+
+	return nil
+}
+
+// migrationCreateSyncConflicts creates the sync_conflicts table that records
+// device edits of rows changed on the server since the device last saw them
+func (db *DB) migrationCreateSyncConflicts(ctx context.Context) error {
+	createTableQuery := `
+		CREATE TABLE IF NOT EXISTS sync_conflicts (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			table_name TEXT NOT NULL,
+			row_id TEXT NOT NULL,
+			device_id VARCHAR(255) NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			server_data JSONB NOT NULL,
+			device_data JSONB NOT NULL,
+			base_hlc TEXT NOT NULL,
+			strategy VARCHAR(50) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			resolution VARCHAR(20),
+			resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			resolved_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			CONSTRAINT chk_conflict_status CHECK (status IN ('open', 'resolved')),
+			CONSTRAINT chk_conflict_resolution CHECK (resolution IN ('server', 'device'))
+		)
+	`
+	_, err := db.Pool.Exec(ctx, createTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create sync_conflicts table: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `CREATE INDEX IF NOT EXISTS idx_sync_conflicts_user_status ON sync_conflicts(user_id, status, created_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to create sync_conflicts index: %w", err)
+	}
+
+	return nil
+}
+
+// migrationAddMessageHLC adds the hlc column that orders messages, backfilled
+// from created_at for messages written before it existed
+func (db *DB) migrationAddMessageHLC(ctx context.Context) error {
+	// Check if column already exists
+	var exists bool
+	checkQuery := `
+		SELECT EXISTS (
+			SELECT 1 
+			FROM information_schema.columns 
+			WHERE table_name = 'messages' 
+			AND column_name = 'hlc'
+		)
+	`
+	err := db.Pool.QueryRow(ctx, checkQuery).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if column exists: %w", err)
+	}
+
+	if exists {
+		return nil // Column already exists, skip migration
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := []string{
+		`ALTER TABLE messages ADD COLUMN hlc TEXT`,
+		`UPDATE messages SET hlc = lpad(floor(extract(epoch FROM COALESCE(created_at, NOW())) * 1000)::bigint::text, 13, '0') || '-00000-legacy'`,
+		`ALTER TABLE messages ALTER COLUMN hlc SET DEFAULT ` + hlcNowSQL,
+		`ALTER TABLE messages ALTER COLUMN hlc SET NOT NULL`,
+		`CREATE INDEX idx_messages_hlc ON messages(hlc DESC)`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to add hlc column: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// migrationAddSnapshotPosition adds the columns that record how far a device
+// has paged its snapshot to sync_metadata table, so that any replica can serve
+// the next page
+func (db *DB) migrationAddSnapshotPosition(ctx context.Context) error {
+	// Check if columns already exist
+	var exists bool
+	checkQuery := `
+		SELECT EXISTS (
+			SELECT 1 
+			FROM information_schema.columns 
+			WHERE table_name = 'sync_metadata' 
+			AND column_name = 'snapshot_page'
+		)
+	`
+	err := db.Pool.QueryRow(ctx, checkQuery).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if column exists: %w", err)
+	}
+
+	if exists {
+		return nil // Columns already exist, skip migration
+	}
+
+	// Add the columns
+	alterQuery := `ALTER TABLE sync_metadata
+		ADD COLUMN snapshot_requested_at TIMESTAMPTZ,
+		ADD COLUMN snapshot_taken_at TIMESTAMPTZ,
+		ADD COLUMN snapshot_page INTEGER NOT NULL DEFAULT 0,
+		ADD COLUMN snapshot_rule INTEGER NOT NULL DEFAULT 0,
+		ADD COLUMN snapshot_after TEXT`
+	_, err = db.Pool.Exec(ctx, alterQuery)
+	if err != nil {
+		return fmt.Errorf("failed to add snapshot position columns: %w", err)
+	}
+
+	return nil
+}
+
+// migrationAddQueueRowKey adds the row_key column to device_change_queue table,
+// with a unique index so a device has at most one queued change per row
+func (db *DB) migrationAddQueueRowKey(ctx context.Context) error {
+	// Check if column already exists
+	var exists bool
+	checkQuery := `
+		SELECT EXISTS (
+			SELECT 1 
+			FROM information_schema.columns 
+			WHERE table_name = 'device_change_queue' 
+			AND column_name = 'row_key'
+		)
+	`
+	err := db.Pool.QueryRow(ctx, checkQuery).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if column exists: %w", err)
+	}
+
+	if exists {
+		return nil // Column already exists, skip migration
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Changes queued before the migration keep a NULL key and are not coalesced
+	queries := []string{
+		`ALTER TABLE device_change_queue ADD COLUMN row_key TEXT`,
+		`CREATE UNIQUE INDEX idx_device_change_queue_row
+		 ON device_change_queue(device_id, schema_name, table_name, row_key)
+		 WHERE row_key IS NOT NULL`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to add row_key column: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
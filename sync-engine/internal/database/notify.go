@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// notifyFunctionSQL sends one NOTIFY per row change on the channel given as the
+// first trigger argument. NOTIFY payloads are limited to 8000 bytes, so rows that
+// do not fit are sent as their primary key, named by the remaining trigger
+// arguments, and reloaded by the listener.
+const notifyFunctionSQL = `
+CREATE OR REPLACE FUNCTION posduif_notify_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    payload jsonb;
+    key_row jsonb;
+BEGIN
+    payload := jsonb_build_object(
+        'op', TG_OP,
+        'schema', TG_TABLE_SCHEMA,
+        'table', TG_TABLE_NAME,
+        'xid', pg_current_xact_id()::text,
+        'lsn', pg_current_wal_lsn()::text,
+        'ts', now(),
+        'row', CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END,
+        'old', CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END
+    );
+
+    IF octet_length(payload::text) > 7900 THEN
+        key_row := CASE WHEN TG_OP = 'DELETE' THEN payload->'old' ELSE payload->'row' END;
+        payload := (payload - 'row' - 'old') || jsonb_build_object(
+            'truncated', true,
+            'key', (SELECT jsonb_object_agg(k, key_row->k) FROM unnest(TG_ARGV[1:]) AS k),
+            'old', CASE WHEN TG_OP <> 'INSERT' THEN (
+                SELECT jsonb_object_agg(key, value) FROM jsonb_each(to_jsonb(OLD))
+                WHERE octet_length(value::text) <= 256
+            ) END
+        );
+    END IF;
+
+    PERFORM pg_notify(TG_ARGV[0], payload::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`
+
+// EnsureNotifyTriggers installs the change notification function and a row
+// trigger on each table. Tables are given as "table" or "schema.table" and
+// must have a primary key, which identifies rows too large for a notification.
+func (db *DB) EnsureNotifyTriggers(ctx context.Context, channel string, tables []string) error {
+	if _, err := db.Pool.Exec(ctx, notifyFunctionSQL); err != nil {
+		return fmt.Errorf("failed to create notify function: %w", err)
+	}
+
+	for _, table := range tables {
+		keyColumns, err := db.GetPrimaryKeyColumns(ctx, table)
+		if err != nil {
+			return err
+		}
+		if len(keyColumns) == 0 {
+			return fmt.Errorf("table %s has no primary key; the notify change source needs one to reload large rows", table)
+		}
+
+		args := []string{quoteLiteral(channel)}
+		for _, column := range keyColumns {
+			args = append(args, quoteLiteral(column))
+		}
+		ident := parseTableName(table)
+		triggerQuery := fmt.Sprintf(
+			`CREATE OR REPLACE TRIGGER posduif_notify_change
+			 AFTER INSERT OR UPDATE OR DELETE ON %s
+			 FOR EACH ROW EXECUTE FUNCTION posduif_notify_change(%s)`,
+			ident.Sanitize(), strings.Join(args, ", "),
+		)
+		if _, err := db.Pool.Exec(ctx, triggerQuery); err != nil {
+			return fmt.Errorf("failed to create notify trigger on %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// GetRowJSON loads the current row with the given key columns as a JSON
+// object. The key values are cast to the column types by jsonb_populate_record,
+// so the lookup can use the primary key index.
+func (db *DB) GetRowJSON(ctx context.Context, table string, key map[string]interface{}) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("no key to load a row of %s", table)
+	}
+	names := make([]string, 0, len(key))
+	for column := range key {
+		names = append(names, column)
+	}
+	sort.Strings(names)
+	rowColumns := make([]string, len(names))
+	keyColumns := make([]string, len(names))
+	for i, name := range names {
+		rowColumns[i] = pgx.Identifier{"t", name}.Sanitize()
+		keyColumns[i] = pgx.Identifier{"k", name}.Sanitize()
+	}
+
+	ident := parseTableName(table).Sanitize()
+	query := fmt.Sprintf(
+		`SELECT to_jsonb(t) FROM %s t
+		 WHERE (%s) = (SELECT %s FROM jsonb_populate_record(NULL::%s, $1) k)`,
+		ident, strings.Join(rowColumns, ", "), strings.Join(keyColumns, ", "), ident,
+	)
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	var row []byte
+	if err := db.Pool.QueryRow(ctx, query, keyJSON).Scan(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// ListenConn opens a dedicated connection for LISTEN. It is not part of the pool
+// because listening connections must stay open and must not be shared.
+func (db *DB) ListenConn(ctx context.Context, channel string) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, db.Pool.Config().ConnConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open listen connection: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+	return conn, nil
+}
+
+// quoteLiteral quotes a string as an SQL literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -30,6 +30,26 @@ func (db *DB) GetUserByID(ctx context.Context, userID string) (*models.User, err
 	return &user, nil
 }
 
+// GetUserIDsByQuery runs a sync rule join query that selects user IDs, passing
+// key as $1
+func (db *DB) GetUserIDsByQuery(ctx context.Context, query string, key string) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, query, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
 func (db *DB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
 	query := `SELECT id, username, user_type, device_id, online_status, last_seen,
@@ -47,11 +67,12 @@ func (db *DB) GetUserByUsername(ctx context.Context, username string) (*models.U
 	return &user, nil
 }
 
+// GetUserByDeviceID returns the user a device is enrolled to
 func (db *DB) GetUserByDeviceID(ctx context.Context, deviceID string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, username, user_type, device_id, online_status, last_seen,
-	          enrolled_at, enrollment_token_id, last_message_sent, created_at, updated_at
-	          FROM users WHERE device_id = $1`
+	query := `SELECT u.id, u.username, u.user_type, u.device_id, u.online_status, u.last_seen,
+	          u.enrolled_at, u.enrollment_token_id, u.last_message_sent, u.created_at, u.updated_at
+	          FROM users u JOIN devices d ON d.user_id = u.id WHERE d.id = $1`
 
 	err := db.Pool.QueryRow(ctx, query, deviceID).Scan(
 		&user.ID, &user.Username, &user.UserType, &user.DeviceID,
@@ -153,11 +174,21 @@ func (db *DB) UpdateUser(ctx context.Context, user *models.User) error {
 
 // Message Queries
 
+// hlcNowSQL is the default hybrid logical clock timestamp of messages written
+// directly to the database. It is taken from the database clock, not merged
+// into the server's HLC, so it orders only approximately against other
+// timestamps. The engine stamps every message it writes itself.
+const hlcNowSQL = `lpad(floor(extract(epoch FROM clock_timestamp()) * 1000)::bigint::text, 13, '0') || '-00000-db'`
+
 func (db *DB) CreateMessage(ctx context.Context, msg *models.Message) error {
 	query := `INSERT INTO messages (id, sender_id, recipient_id, content, status, 
-	          created_at, updated_at)
-	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	          created_at, updated_at, hlc)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	          RETURNING hlc`
 
+	if msg.HLC == "" {
+		return fmt.Errorf("message without an HLC timestamp")
+	}
 	now := time.Now()
 	if msg.ID == "" {
 		msg.ID = uuid.New().String()
@@ -170,16 +201,63 @@ func (db *DB) CreateMessage(ctx context.Context, msg *models.Message) error {
 	}
 	msg.UpdatedAt = now
 
-	_, err := db.Pool.Exec(ctx, query,
+	return db.Pool.QueryRow(ctx, query,
 		msg.ID, msg.SenderID, msg.RecipientID, msg.Content,
-		msg.Status, msg.CreatedAt, msg.UpdatedAt,
-	)
-	return err
+		msg.Status, msg.CreatedAt, msg.UpdatedAt, msg.HLC,
+	).Scan(&msg.HLC)
+}
+
+// InsertUploadedMessage stores a message uploaded by a device, keyed on its
+// client-generated ID. A replay of a stored message is reported as a duplicate,
+// and an ID already taken by a different message as a conflict; neither
+// changes the stored row.
+func (db *DB) InsertUploadedMessage(ctx context.Context, msg *models.Message) (models.UploadOutcome, error) {
+	query := `INSERT INTO messages (id, sender_id, recipient_id, content, status,
+	          created_at, updated_at, hlc)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	          ON CONFLICT (id) DO NOTHING
+	          RETURNING hlc`
+
+	if msg.HLC == "" {
+		return "", fmt.Errorf("message without an HLC timestamp")
+	}
+	now := time.Now()
+	if msg.Status == "" {
+		msg.Status = "pending_sync"
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = now
+	}
+	msg.UpdatedAt = now
+
+	err := db.Pool.QueryRow(ctx, query,
+		msg.ID, msg.SenderID, msg.RecipientID, msg.Content,
+		msg.Status, msg.CreatedAt, msg.UpdatedAt, msg.HLC,
+	).Scan(&msg.HLC)
+	if err == nil {
+		return models.UploadCreated, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	// The ID exists: compare with the stored message
+	var senderID, recipientID, content string
+	err = db.Pool.QueryRow(ctx,
+		`SELECT sender_id::text, recipient_id::text, content, hlc FROM messages WHERE id = $1`, msg.ID,
+	).Scan(&senderID, &recipientID, &content, &msg.HLC)
+	if err != nil {
+		return "", fmt.Errorf("failed to get stored message: %w", err)
+	}
+	if senderID == msg.SenderID && recipientID == msg.RecipientID && content == msg.Content {
+		return models.UploadDuplicate, nil
+	}
+	return models.UploadConflict, nil
 }
 
 func (db *DB) GetMessages(ctx context.Context, filter models.MessageFilter) ([]models.Message, error) {
 	query := `SELECT id, sender_id, recipient_id, content, status, created_at, 
-	          updated_at, synced_at, read_at FROM messages WHERE 1=1`
+	          updated_at, synced_at, read_at, hlc FROM messages WHERE 1=1`
 	args := []interface{}{}
 	argPos := 1
 
@@ -195,7 +273,8 @@ func (db *DB) GetMessages(ctx context.Context, filter models.MessageFilter) ([]m
 		argPos++
 	}
 
-	query += " ORDER BY created_at DESC"
+	// Hybrid logical clock order holds across devices with skewed clocks
+	query += " ORDER BY hlc DESC, id DESC"
 
 	if filter.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argPos)
@@ -220,7 +299,7 @@ func (db *DB) GetMessages(ctx context.Context, filter models.MessageFilter) ([]m
 		err := rows.Scan(
 			&msg.ID, &msg.SenderID, &msg.RecipientID, &msg.Content,
 			&msg.Status, &msg.CreatedAt, &msg.UpdatedAt,
-			&msg.SyncedAt, &msg.ReadAt,
+			&msg.SyncedAt, &msg.ReadAt, &msg.HLC,
 		)
 		if err != nil {
 			return nil, err
@@ -296,7 +375,10 @@ func (db *DB) GetEnrollmentToken(ctx context.Context, token string) (*models.Enr
 	return &et, nil
 }
 
-func (db *DB) CompleteEnrollment(ctx context.Context, token, deviceID, username string) (string, error) {
+// CompleteEnrollment marks the token used and enrolls the device to the user with
+// the given username, creating the user if needed. A user can enroll several
+// devices; each one gets its own devices row.
+func (db *DB) CompleteEnrollment(ctx context.Context, token, deviceID, username string, deviceInfo map[string]interface{}) (string, error) {
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return "", err
@@ -323,10 +405,10 @@ func (db *DB) CompleteEnrollment(ctx context.Context, token, deviceID, username
 		return "", err
 	}
 
-	// Check if user with this device_id already exists
+	// Check if this device is already enrolled
 	var userID string
 	var existingUserID string
-	checkQuery := `SELECT id FROM users WHERE device_id = $1`
+	checkQuery := `SELECT user_id FROM devices WHERE id = $1`
 	err = tx.QueryRow(ctx, checkQuery, deviceID).Scan(&existingUserID)
 	
 	now := time.Now()
@@ -364,6 +446,23 @@ func (db *DB) CompleteEnrollment(ctx context.Context, token, deviceID, username
 		return "", fmt.Errorf("failed to check for existing user: %w", err)
 	}
 
+	device := models.NewDevice(deviceID, userID, deviceInfo)
+	_, err = tx.Exec(ctx, upsertDeviceQuery,
+		device.ID, device.UserID, device.Platform, device.Model,
+		device.OSVersion, device.AppVersion, device.DeviceInfo, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to record device: %w", err)
+	}
+
+	// A newly enrolled device starts with a full snapshot of its history
+	if _, err := tx.Exec(ctx, requestFullResyncQuery, deviceID); err != nil {
+		return "", fmt.Errorf("failed to request initial snapshot: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM device_change_queue WHERE device_id = $1`, deviceID); err != nil {
+		return "", fmt.Errorf("failed to clear change queue: %w", err)
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return "", fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -375,11 +474,11 @@ func (db *DB) CompleteEnrollment(ctx context.Context, token, deviceID, username
 
 func (db *DB) GetPendingMessagesForDevice(ctx context.Context, deviceID string, limit int) ([]models.Message, error) {
 	query := `SELECT m.id, m.sender_id, m.recipient_id, m.content, m.status, 
-	          m.created_at, m.updated_at, m.synced_at, m.read_at
+	          m.created_at, m.updated_at, m.synced_at, m.read_at, m.hlc
 	          FROM messages m
-	          JOIN users u ON m.recipient_id = u.id
-	          WHERE u.device_id = $1 AND m.status = 'pending_sync'
-	          ORDER BY m.created_at ASC
+	          JOIN devices d ON m.recipient_id = d.user_id
+	          WHERE d.id = $1 AND m.status = 'pending_sync'
+	          ORDER BY m.hlc ASC, m.id ASC
 	          LIMIT $2`
 
 	rows, err := db.Pool.Query(ctx, query, deviceID, limit)
@@ -394,7 +493,7 @@ func (db *DB) GetPendingMessagesForDevice(ctx context.Context, deviceID string,
 		err := rows.Scan(
 			&msg.ID, &msg.SenderID, &msg.RecipientID, &msg.Content,
 			&msg.Status, &msg.CreatedAt, &msg.UpdatedAt,
-			&msg.SyncedAt, &msg.ReadAt,
+			&msg.SyncedAt, &msg.ReadAt, &msg.HLC,
 		)
 		if err != nil {
 			return nil, err
@@ -405,15 +504,36 @@ func (db *DB) GetPendingMessagesForDevice(ctx context.Context, deviceID string,
 	return messages, rows.Err()
 }
 
+// MarkMessagesSynced marks messages delivered to a device as synced: the
+// pending messages addressed to the device's user up to (hlc, id) in
+// GetPendingMessagesForDevice order, and last updated no later than updatedAt
+func (db *DB) MarkMessagesSynced(ctx context.Context, deviceID string, hlc string, id string, updatedAt time.Time) (int64, error) {
+	query := `UPDATE messages m SET status = 'synced', synced_at = NOW(), updated_at = NOW()
+	          FROM devices d
+	          WHERE d.id = $1 AND m.recipient_id = d.user_id
+	          AND m.status = 'pending_sync' AND (m.hlc, m.id) <= ($2, $3::uuid)
+	          AND m.updated_at <= $4`
+
+	tag, err := db.Pool.Exec(ctx, query, deviceID, hlc, id, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 func (db *DB) GetSyncMetadata(ctx context.Context, deviceID string) (*models.SyncMetadata, error) {
 	var sm models.SyncMetadata
-	query := `SELECT id, device_id, last_sync_timestamp, last_synced_lsn, pending_outgoing_count, 
-	          sync_status, created_at, updated_at
+	query := `SELECT id, device_id, last_sync_timestamp, last_synced_lsn::text, pending_outgoing_count, 
+	          sync_status, needs_full_resync, snapshot, snapshot_lsn::text, resync_requested_at,
+	          snapshot_requested_at, snapshot_taken_at, snapshot_page, snapshot_rule, snapshot_after,
+	          created_at, updated_at
 	          FROM sync_metadata WHERE device_id = $1`
 
 	err := db.Pool.QueryRow(ctx, query, deviceID).Scan(
 		&sm.ID, &sm.DeviceID, &sm.LastSyncTimestamp, &sm.LastSyncedLSN,
-		&sm.PendingOutgoingCount, &sm.SyncStatus,
+		&sm.PendingOutgoingCount, &sm.SyncStatus, &sm.NeedsFullResync,
+		&sm.Snapshot, &sm.SnapshotLSN, &sm.ResyncRequestedAt,
+		&sm.SnapshotRequestedAt, &sm.SnapshotTakenAt, &sm.SnapshotPage, &sm.SnapshotRule, &sm.SnapshotAfter,
 		&sm.CreatedAt, &sm.UpdatedAt,
 	)
 	if err != nil {
@@ -422,10 +542,12 @@ func (db *DB) GetSyncMetadata(ctx context.Context, deviceID string) (*models.Syn
 	return &sm, nil
 }
 
+// UpdateSyncMetadata upserts a device's sync metadata. needs_full_resync is only
+// written for new rows; it is changed by MarkDevicesForFullResync and AdvanceSnapshot.
 func (db *DB) UpdateSyncMetadata(ctx context.Context, sm *models.SyncMetadata) error {
 	query := `INSERT INTO sync_metadata (device_id, last_sync_timestamp, last_synced_lsn,
-	          pending_outgoing_count, sync_status, created_at, updated_at)
-	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+	          pending_outgoing_count, sync_status, needs_full_resync, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	          ON CONFLICT (device_id) DO UPDATE SET
 	          last_sync_timestamp = EXCLUDED.last_sync_timestamp,
 	          last_synced_lsn = EXCLUDED.last_synced_lsn,
@@ -441,7 +563,101 @@ func (db *DB) UpdateSyncMetadata(ctx context.Context, sm *models.SyncMetadata) e
 
 	_, err := db.Pool.Exec(ctx, query,
 		sm.DeviceID, sm.LastSyncTimestamp, sm.LastSyncedLSN, sm.PendingOutgoingCount,
-		sm.SyncStatus, sm.CreatedAt, sm.UpdatedAt,
+		sm.SyncStatus, sm.NeedsFullResync, sm.CreatedAt, sm.UpdatedAt,
 	)
 	return err
 }
+
+// requestFullResyncQuery flags devices as needing a full resync. A device that
+// is already resyncing gets a new request, so its snapshot starts over.
+const requestFullResyncQuery = `INSERT INTO sync_metadata (device_id, needs_full_resync, resync_requested_at)
+                                SELECT unnest($1::text[]), true, NOW()
+                                ON CONFLICT (device_id) DO UPDATE SET
+                                needs_full_resync = true, last_synced_lsn = NULL,
+                                resync_requested_at = NOW(), updated_at = NOW()`
+
+// RequestFullResync flags a device as needing a full resync and drops its queued changes
+func (db *DB) RequestFullResync(ctx context.Context, deviceID string) error {
+	return db.RequestFullResyncs(ctx, []string{deviceID})
+}
+
+// RequestFullResyncs flags devices as needing a full resync and drops their queued changes
+func (db *DB) RequestFullResyncs(ctx context.Context, deviceIDs []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, requestFullResyncQuery, deviceIDs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM device_change_queue WHERE device_id = ANY($1)`, deviceIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MarkDevicesForFullResync flags every device as needing a full resync, clears
+// their LSN and drops their queued changes
+func (db *DB) MarkDevicesForFullResync(ctx context.Context) (int64, error) {
+	query := `WITH marked AS (
+	              UPDATE sync_metadata
+	              SET needs_full_resync = true, last_synced_lsn = NULL,
+	                  resync_requested_at = NOW(), updated_at = NOW()
+	              WHERE needs_full_resync = false
+	              RETURNING device_id
+	          ), dropped AS (
+	              DELETE FROM device_change_queue WHERE device_id IN (SELECT device_id FROM marked)
+	          )
+	          SELECT COUNT(*) FROM marked`
+
+	var count int64
+	if err := db.Pool.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkStaleDevicesForFullResync flags the devices that hold back the
+// replication slot but have not synced or been seen since staleBefore as
+// needing a full resync, clears their LSN and drops their queued changes
+func (db *DB) MarkStaleDevicesForFullResync(ctx context.Context, staleBefore time.Time) (int64, error) {
+	query := `WITH marked AS (
+	              UPDATE sync_metadata sm
+	              SET needs_full_resync = true, last_synced_lsn = NULL,
+	                  resync_requested_at = NOW(), updated_at = NOW()
+	              FROM devices d
+	              WHERE d.id = sm.device_id AND sm.needs_full_resync = false
+	              AND sm.last_synced_lsn IS NOT NULL
+	              AND (sm.last_sync_timestamp IS NULL OR sm.last_sync_timestamp < $1
+	                   OR d.last_seen IS NULL OR d.last_seen < $1)
+	              RETURNING sm.device_id
+	          ), dropped AS (
+	              DELETE FROM device_change_queue WHERE device_id IN (SELECT device_id FROM marked)
+	          )
+	          SELECT COUNT(*) FROM marked`
+
+	var count int64
+	if err := db.Pool.QueryRow(ctx, query, staleBefore).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetMinSyncedLSN returns the lowest last_synced_lsn among active devices:
+// enrolled devices that are not waiting for a full resync. It returns nil if
+// no active device has acknowledged changes yet.
+func (db *DB) GetMinSyncedLSN(ctx context.Context) (*string, error) {
+	query := `SELECT MIN(sm.last_synced_lsn)::text
+	          FROM sync_metadata sm
+	          JOIN devices d ON d.id = sm.device_id
+	          WHERE sm.last_synced_lsn IS NOT NULL AND NOT sm.needs_full_resync`
+
+	var lsn *string
+	if err := db.Pool.QueryRow(ctx, query).Scan(&lsn); err != nil {
+		return nil, err
+	}
+	return lsn, nil
+}
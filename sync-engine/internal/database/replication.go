@@ -2,11 +2,18 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/models"
 )
 
 // ReplicationSlotManager manages PostgreSQL logical replication slots
@@ -58,6 +65,11 @@ func (r *ReplicationSlotManager) CreateReplicationSlot(ctx context.Context) (str
 	var lsnStr string
 	err = r.pool.QueryRow(ctx, createQuery, slotName).Scan(&slotNameResult, &lsnStr)
 	if err != nil {
+		// Another replica starting at the same time created it first
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42710" {
+			return slotName, nil
+		}
 		return "", fmt.Errorf("failed to create replication slot: %w", err)
 	}
 
@@ -81,6 +93,49 @@ func (r *ReplicationSlotManager) SlotExists(ctx context.Context, slotName string
 	return exists, nil
 }
 
+// ConnectReplication opens a logical replication connection to the tenant database.
+// The connection uses the pool's settings with the replication=database runtime parameter,
+// so it can only run replication commands and must be closed by the caller.
+func (r *ReplicationSlotManager) ConnectReplication(ctx context.Context) (*pgconn.PgConn, error) {
+	connConfig := r.pool.Config().ConnConfig.Config.Copy()
+	if connConfig.RuntimeParams == nil {
+		connConfig.RuntimeParams = make(map[string]string)
+	}
+	connConfig.RuntimeParams["replication"] = "database"
+
+	conn, err := pgconn.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replication connection: %w", err)
+	}
+	return conn, nil
+}
+
+// CreateTemporarySlot creates a temporary logical slot on a replication
+// connection, which PostgreSQL drops when the connection closes. The slot is a
+// copy of source, starting at its confirmed flush position, or a new pgoutput
+// slot at the current WAL position if source is empty.
+func (r *ReplicationSlotManager) CreateTemporarySlot(ctx context.Context, conn *pgconn.PgConn, name, source string) error {
+	var query string
+	if source == "" {
+		query = fmt.Sprintf("CREATE_REPLICATION_SLOT %s TEMPORARY LOGICAL pgoutput", name)
+	} else {
+		exists, err := r.SlotExists(ctx, source)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("replication slot %q does not exist", source)
+		}
+		query = fmt.Sprintf("SELECT pg_copy_logical_replication_slot('%s', '%s', true)",
+			strings.ReplaceAll(source, "'", "''"), strings.ReplaceAll(name, "'", "''"))
+	}
+
+	if _, err := conn.Exec(ctx, query).ReadAll(); err != nil {
+		return fmt.Errorf("failed to create temporary replication slot: %w", err)
+	}
+	return nil
+}
+
 // DropReplicationSlot drops a replication slot (use with caution)
 func (r *ReplicationSlotManager) DropReplicationSlot(ctx context.Context, slotName string) error {
 	query := `SELECT pg_drop_replication_slot($1)`
@@ -140,3 +195,301 @@ func (r *ReplicationSlotManager) GetSlotInfo(ctx context.Context, slotName strin
 	}
 	return result, nil
 }
+
+// CheckReplicationPrerequisites verifies the server settings and role privileges
+// that logical replication needs, so misconfiguration fails at startup
+func (r *ReplicationSlotManager) CheckReplicationPrerequisites(ctx context.Context) error {
+	var walLevel string
+	if err := r.pool.QueryRow(ctx, "SHOW wal_level").Scan(&walLevel); err != nil {
+		return fmt.Errorf("failed to read wal_level: %w", err)
+	}
+	if walLevel != "logical" {
+		return fmt.Errorf("wal_level is %q, logical replication requires wal_level = logical in postgresql.conf (restart required)", walLevel)
+	}
+
+	var maxSlots int
+	if err := r.pool.QueryRow(ctx, "SELECT current_setting('max_replication_slots')::int").Scan(&maxSlots); err != nil {
+		return fmt.Errorf("failed to read max_replication_slots: %w", err)
+	}
+	if maxSlots == 0 {
+		return fmt.Errorf("max_replication_slots is 0, set it to at least 1 in postgresql.conf (restart required)")
+	}
+
+	var role string
+	var canReplicate, canCreate bool
+	query := `
+		SELECT current_user,
+		       rolreplication OR rolsuper,
+		       has_database_privilege(current_database(), 'CREATE')
+		FROM pg_roles
+		WHERE rolname = current_user
+	`
+	if err := r.pool.QueryRow(ctx, query).Scan(&role, &canReplicate, &canCreate); err != nil {
+		return fmt.Errorf("failed to check role privileges: %w", err)
+	}
+	if !canReplicate {
+		return fmt.Errorf("role %q lacks the REPLICATION attribute, run: ALTER ROLE %s WITH REPLICATION", role, pgx.Identifier{role}.Sanitize())
+	}
+	if !canCreate {
+		return fmt.Errorf("role %q lacks CREATE on the database, which is needed to manage publication %q", role, r.GetPublicationName())
+	}
+
+	return nil
+}
+
+// GetPublicationName returns the publication streamed by the pgoutput plugin
+func (r *ReplicationSlotManager) GetPublicationName() string {
+	return r.cfg.Sync.WAL.Publication
+}
+
+// EnsurePublication creates the publication if it is missing and reconciles its
+// table list with sync.wal.tables
+func (r *ReplicationSlotManager) EnsurePublication(ctx context.Context) error {
+	name := r.GetPublicationName()
+	wanted := make(map[string]pgx.Identifier)
+	for _, table := range r.cfg.Sync.WAL.Tables {
+		ident := parseTableName(table)
+		wanted[ident.Sanitize()] = ident
+	}
+
+	var allTables, pubInsert, pubUpdate, pubDelete bool
+	query := `SELECT puballtables, pubinsert, pubupdate, pubdelete FROM pg_publication WHERE pubname = $1`
+	err := r.pool.QueryRow(ctx, query, name).Scan(&allTables, &pubInsert, &pubUpdate, &pubDelete)
+	if err == pgx.ErrNoRows {
+		tables := make([]string, 0, len(wanted))
+		for sanitized := range wanted {
+			tables = append(tables, sanitized)
+		}
+		sort.Strings(tables)
+		createQuery := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s",
+			pgx.Identifier{name}.Sanitize(), strings.Join(tables, ", "))
+		if _, err := r.pool.Exec(ctx, createQuery); err != nil {
+			// A previous leader created it first; reconcile its tables instead
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "42710" {
+				return r.EnsurePublication(ctx)
+			}
+			return fmt.Errorf("failed to create publication %q: %w", name, err)
+		}
+		log.Printf("Created publication %s for tables: %s", name, strings.Join(tables, ", "))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check publication %q: %w", name, err)
+	}
+
+	if !pubInsert || !pubUpdate || !pubDelete {
+		return fmt.Errorf("publication %q does not publish all of INSERT, UPDATE and DELETE; recreate it without a publish option", name)
+	}
+	if allTables {
+		// FOR ALL TABLES publications cannot be altered per table
+		log.Printf("Publication %s covers all tables, skipping table reconciliation", name)
+		return nil
+	}
+
+	current, err := r.getPublicationTables(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var toAdd, toDrop []string
+	for sanitized := range wanted {
+		if !current[sanitized] {
+			toAdd = append(toAdd, sanitized)
+		}
+	}
+	for sanitized := range current {
+		if _, ok := wanted[sanitized]; !ok {
+			toDrop = append(toDrop, sanitized)
+		}
+	}
+
+	sort.Strings(toAdd)
+	sort.Strings(toDrop)
+
+	if len(toAdd) > 0 {
+		alterQuery := fmt.Sprintf("ALTER PUBLICATION %s ADD TABLE %s",
+			pgx.Identifier{name}.Sanitize(), strings.Join(toAdd, ", "))
+		if _, err := r.pool.Exec(ctx, alterQuery); err != nil {
+			return fmt.Errorf("failed to add tables to publication %q: %w", name, err)
+		}
+		log.Printf("Added tables to publication %s: %s", name, strings.Join(toAdd, ", "))
+	}
+	if len(toDrop) > 0 {
+		alterQuery := fmt.Sprintf("ALTER PUBLICATION %s DROP TABLE %s",
+			pgx.Identifier{name}.Sanitize(), strings.Join(toDrop, ", "))
+		if _, err := r.pool.Exec(ctx, alterQuery); err != nil {
+			return fmt.Errorf("failed to drop tables from publication %q: %w", name, err)
+		}
+		log.Printf("Dropped tables from publication %s: %s", name, strings.Join(toDrop, ", "))
+	}
+
+	return nil
+}
+
+// EnsureReplicaIdentity checks that DELETE changes of the published tables
+// carry the old columns needed to route tombstones: the sync rule's user, join
+// and origin columns. With sync.wal.replica_identity_full it sets REPLICA
+// IDENTITY FULL on tables that lack them instead of failing.
+func (r *ReplicationSlotManager) EnsureReplicaIdentity(ctx context.Context) error {
+	for _, table := range r.cfg.Sync.WAL.Tables {
+		ident := parseTableName(table)
+
+		identity, identityColumns, err := r.getReplicaIdentity(ctx, ident)
+		if err != nil {
+			return fmt.Errorf("failed to check replica identity of %s: %w", table, err)
+		}
+		if identity == "f" {
+			continue
+		}
+
+		var missing []string
+		for _, column := range r.routingColumns(ident) {
+			if !identityColumns[column] {
+				missing = append(missing, column)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		if !r.cfg.Sync.WAL.ReplicaIdentityFull {
+			return fmt.Errorf("deletes on %s do not carry the routing columns %s; set REPLICA IDENTITY FULL on the table "+
+				"(or USING INDEX on an index with those columns), or enable sync.wal.replica_identity_full",
+				table, strings.Join(missing, ", "))
+		}
+
+		alterQuery := fmt.Sprintf("ALTER TABLE %s REPLICA IDENTITY FULL", ident.Sanitize())
+		if _, err := r.pool.Exec(ctx, alterQuery); err != nil {
+			return fmt.Errorf("failed to set replica identity of %s: %w", table, err)
+		}
+		log.Printf("Set REPLICA IDENTITY FULL on %s", ident.Sanitize())
+	}
+
+	return nil
+}
+
+// getReplicaIdentity returns a table's replica identity setting ("d", "n",
+// "f" or "i") and the columns of its identity index
+func (r *ReplicationSlotManager) getReplicaIdentity(ctx context.Context, ident pgx.Identifier) (string, map[string]bool, error) {
+	query := `SELECT c.relreplident::text,
+	                 COALESCE(array_agg(a.attname::text) FILTER (WHERE a.attname IS NOT NULL), '{}')
+	          FROM pg_class c
+	          LEFT JOIN pg_index i ON i.indrelid = c.oid
+	               AND ((c.relreplident = 'd' AND i.indisprimary) OR (c.relreplident = 'i' AND i.indisreplident))
+	          LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(i.indkey)
+	          WHERE c.oid = $1::regclass
+	          GROUP BY c.relreplident`
+
+	var identity string
+	var columns []string
+	if err := r.pool.QueryRow(ctx, query, ident.Sanitize()).Scan(&identity, &columns); err != nil {
+		return "", nil, err
+	}
+	identityColumns := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		identityColumns[column] = true
+	}
+	return identity, identityColumns, nil
+}
+
+// routingColumns returns the columns the sync rules read from a deleted row to
+// route its tombstone
+func (r *ReplicationSlotManager) routingColumns(ident pgx.Identifier) []string {
+	var columns []string
+	for _, rule := range r.cfg.Sync.Rules {
+		if parseTableName(rule.Table).Sanitize() != ident.Sanitize() {
+			continue
+		}
+		switch rule.Mode {
+		case "column":
+			columns = append(columns, rule.UserColumns...)
+		case "join":
+			columns = append(columns, rule.JoinColumn)
+		}
+		columns = append(columns, rule.OriginColumns...)
+	}
+	return columns
+}
+
+// getPublicationTables returns the sanitized names of the tables in a publication
+func (r *ReplicationSlotManager) getPublicationTables(ctx context.Context, name string) (map[string]bool, error) {
+	query := `SELECT schemaname, tablename FROM pg_publication_tables WHERE pubname = $1`
+	rows, err := r.pool.Query(ctx, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list publication tables: %w", err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var schema, table string
+		if err := rows.Scan(&schema, &table); err != nil {
+			return nil, fmt.Errorf("failed to scan publication table: %w", err)
+		}
+		tables[pgx.Identifier{schema, table}.Sanitize()] = true
+	}
+	return tables, rows.Err()
+}
+
+// parseTableName splits "schema.table" into an identifier, defaulting to the public schema
+func parseTableName(name string) pgx.Identifier {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return pgx.Identifier{schema, table}
+	}
+	return pgx.Identifier{"public", name}
+}
+
+// GetSlotStats returns how much WAL the slot retains and how far its confirmed flush position lags
+func (r *ReplicationSlotManager) GetSlotStats(ctx context.Context, slotName string) (*models.ReplicationSlotStats, error) {
+	query := `
+		SELECT
+			active,
+			COALESCE(wal_status, ''),
+			COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint,
+			COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn), 0)::bigint
+		FROM pg_replication_slots
+		WHERE slot_name = $1
+	`
+	stats := &models.ReplicationSlotStats{SlotName: slotName, CheckedAt: time.Now()}
+	err := r.pool.QueryRow(ctx, query, slotName).Scan(
+		&stats.Active,
+		&stats.WALStatus,
+		&stats.RetainedBytes,
+		&stats.FlushLagBytes,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slot stats: %w", err)
+	}
+	return stats, nil
+}
+
+// RecreateReplicationSlot terminates the slot's consumer, drops the slot and creates it again
+// at the current WAL position. All WAL retained by the old slot is released.
+func (r *ReplicationSlotManager) RecreateReplicationSlot(ctx context.Context, slotName string) error {
+	terminateQuery := `
+		SELECT pg_terminate_backend(active_pid)
+		FROM pg_replication_slots
+		WHERE slot_name = $1 AND active_pid IS NOT NULL
+	`
+
+	// The consumer may reconnect between terminate and drop, so retry a few times
+	var dropErr error
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := r.pool.Exec(ctx, terminateQuery, slotName); err != nil {
+			return fmt.Errorf("failed to terminate slot consumer: %w", err)
+		}
+		if dropErr = r.DropReplicationSlot(ctx, slotName); dropErr == nil {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if dropErr != nil {
+		return dropErr
+	}
+
+	if _, err := r.CreateReplicationSlot(ctx); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/config"
+)
+
+// BeginSnapshot takes the snapshot a device is bootstrapped from and resets its
+// paging position. The snapshot and the WAL position read right after it are
+// kept in sync_metadata, so every transaction visible in the snapshot committed
+// before snapshot_lsn. It returns false if the device does not need a full
+// resync or a snapshot was already started for the current request.
+func (db *DB) BeginSnapshot(ctx context.Context, deviceID string) (bool, error) {
+	query := `UPDATE sync_metadata
+	          SET snapshot = pg_current_snapshot()::text, snapshot_lsn = pg_current_wal_lsn(),
+	              snapshot_requested_at = resync_requested_at, snapshot_taken_at = NOW(),
+	              snapshot_page = 0, snapshot_rule = 0, snapshot_after = NULL, updated_at = NOW()
+	          WHERE device_id = $1 AND needs_full_resync
+	          AND (snapshot_taken_at IS NULL OR snapshot_requested_at IS DISTINCT FROM resync_requested_at)`
+
+	result, err := db.Pool.Exec(ctx, query, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to take snapshot: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// SnapshotRow is a row read for a device's snapshot
+type SnapshotRow struct {
+	ID     string
+	XMin   uint32 // Transaction that wrote the row's current version
+	Origin bool   // The user originated the row
+	Data   []byte // Row as a JSON object
+}
+
+// ReadSnapshotRows returns up to limit rows of a sync rule's table that belong
+// to a user, ordered by id. Rows are returned after afterID when it is set. A
+// user owns the rows routed to them by the rule and the rows they originated.
+// Each page is a fresh query reading the current row versions, so callers
+// filter them by XMin against the device's snapshot. It also returns the next
+// transaction ID to be assigned, as a bound on the XIDs the rows can carry.
+func (db *DB) ReadSnapshotRows(ctx context.Context, rule *config.SyncRule, userID string, afterID *string, limit int) ([]SnapshotRow, uint64, error) {
+	origin := "false"
+	var originConditions []string
+	for _, column := range rule.OriginColumns {
+		originConditions = append(originConditions, fmt.Sprintf("t.%s::text = $1", pgx.Identifier{column}.Sanitize()))
+	}
+	if len(originConditions) > 0 {
+		origin = "COALESCE(" + strings.Join(originConditions, " OR ") + ", false)"
+	}
+
+	var conditions []string
+	switch rule.Mode {
+	case "column":
+		for _, column := range append(append([]string{}, rule.UserColumns...), rule.OriginColumns...) {
+			conditions = append(conditions, fmt.Sprintf("t.%s::text = $1", pgx.Identifier{column}.Sanitize()))
+		}
+	case "join":
+		join := strings.ReplaceAll(rule.Join, "$1", "t."+pgx.Identifier{rule.JoinColumn}.Sanitize())
+		conditions = append(conditions, fmt.Sprintf("$1 IN (%s)", join))
+		for _, column := range rule.OriginColumns {
+			conditions = append(conditions, fmt.Sprintf("t.%s::text = $1", pgx.Identifier{column}.Sanitize()))
+		}
+	case "broadcast":
+		conditions = append(conditions, "$1::text IS NOT NULL")
+	default:
+		return nil, 0, fmt.Errorf("unknown sync rule mode %q", rule.Mode)
+	}
+
+	query := fmt.Sprintf(`SELECT t.id::text, t.xmin::text, %s, to_jsonb(t), pg_snapshot_xmax(pg_current_snapshot())::text
+	                      FROM %s t
+	                      WHERE (%s) AND ($2::text IS NULL OR t.id::text > $2)
+	                      ORDER BY t.id::text
+	                      LIMIT $3`,
+		origin, parseTableName(rule.Table).Sanitize(), strings.Join(conditions, " OR "))
+
+	rows, err := db.Pool.Query(ctx, query, userID, afterID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var result []SnapshotRow
+	var nextXID uint64
+	for rows.Next() {
+		var row SnapshotRow
+		var xmin, next string
+		if err := rows.Scan(&row.ID, &xmin, &row.Origin, &row.Data, &next); err != nil {
+			return nil, 0, err
+		}
+		x, err := strconv.ParseUint(xmin, 10, 32)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid xmin %q: %w", xmin, err)
+		}
+		row.XMin = uint32(x)
+		if nextXID, err = strconv.ParseUint(next, 10, 64); err != nil {
+			return nil, 0, fmt.Errorf("invalid next transaction ID %q: %w", next, err)
+		}
+		result = append(result, row)
+	}
+
+	return result, nextXID, rows.Err()
+}
+
+// AdvanceSnapshot records that a device has applied page of the snapshot taken
+// at lsn, and where the next page starts. When done, it also clears
+// needs_full_resync, handing the device over to its change queue. It returns
+// false if page does not follow the last acknowledged page of the device's
+// current snapshot, including when another full resync was requested since.
+func (db *DB) AdvanceSnapshot(ctx context.Context, deviceID, lsn string, page, rule int, afterID *string, done bool) (bool, error) {
+	query := `UPDATE sync_metadata
+	          SET snapshot_page = $3, snapshot_rule = $4, snapshot_after = $5,
+	              needs_full_resync = NOT $6,
+	              last_synced_lsn = CASE WHEN $6 THEN NULL ELSE last_synced_lsn END,
+	              updated_at = NOW()
+	          WHERE device_id = $1 AND needs_full_resync
+	          AND snapshot_lsn = $2::pg_lsn AND snapshot_page = $3 - 1
+	          AND snapshot_requested_at IS NOT DISTINCT FROM resync_requested_at`
+
+	result, err := db.Pool.Exec(ctx, query, deviceID, lsn, page, rule, afterID, done)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
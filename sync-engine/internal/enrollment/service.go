@@ -84,7 +84,7 @@ func (s *Service) CompleteEnrollment(ctx context.Context, req *models.CompleteEn
 	}
 
 	// Complete enrollment (creates user and marks token as used)
-	userID, err := s.db.CompleteEnrollment(ctx, req.Token, req.DeviceID, req.Username)
+	userID, err := s.db.CompleteEnrollment(ctx, req.Token, req.DeviceID, req.Username, req.DeviceInfo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to complete enrollment: %w", err)
 	}
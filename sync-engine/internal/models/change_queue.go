@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// QueuedChange is a row change waiting in a device's durable change queue
+type QueuedChange struct {
+	DeviceID   string
+	LSN        LSN // Commit LSN of the transaction
+	Seq        int // Position of the change within the transaction
+	XID        uint32
+	Schema     string
+	Table      string
+	RowKey     string // Primary key values of the row as a JSON array, "" if unknown
+	Operation  string
+	Columns    map[string]interface{}
+	OldColumns map[string]interface{}
+	CommitTime time.Time
+}
+
+// ChangeNotification announces that a committed transaction was queued for
+// devices. It is published to every sync-engine replica so any of them can
+// push an SSE event to the devices; the changes themselves stay in the queue.
+type ChangeNotification struct {
+	LSN       string   `json:"lsn"`
+	DeviceIDs []string `json:"device_ids"`
+	Tables    []string `json:"tables"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SyncConflict is a device edit of a row that changed on the server after the
+// device last saw it
+type SyncConflict struct {
+	ID         string          `json:"id" db:"id"`
+	TableName  string          `json:"table" db:"table_name"`
+	RowID      string          `json:"row_id" db:"row_id"`
+	DeviceID   string          `json:"device_id" db:"device_id"`
+	UserID     string          `json:"user_id" db:"user_id"`         // User of the device
+	ServerData json.RawMessage `json:"server_data" db:"server_data"` // Row as stored when the edit arrived
+	DeviceData json.RawMessage `json:"device_data" db:"device_data"` // Row as edited by the device
+	BaseHLC    string          `json:"base_hlc" db:"base_hlc"`       // Version the device edited
+	Strategy   string          `json:"strategy" db:"strategy"`
+	Status     string          `json:"status" db:"status"`                     // "open" or "resolved"
+	Resolution *string         `json:"resolution,omitempty" db:"resolution"`   // "server" or "device"
+	ResolvedBy *string         `json:"resolved_by,omitempty" db:"resolved_by"` // User who resolved a manual conflict
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty" db:"resolved_at"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+type ConflictFilter struct {
+	UserID string
+	Status string // Empty = any status
+	Limit  int
+	Offset int
+}
+
+type ConflictListResponse struct {
+	Conflicts []SyncConflict `json:"conflicts"`
+	Limit     int            `json:"limit"`
+	Offset    int            `json:"offset"`
+}
+
+// ResolveConflictRequest picks the version of a manual conflict to keep
+type ResolveConflictRequest struct {
+	Resolution string `json:"resolution"` // "server" or "device"
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// Device is an enrolled device. A user can have several devices, and each one
+// syncs and receives changes independently.
+type Device struct {
+	ID         string                 `json:"id" db:"id"`
+	UserID     string                 `json:"user_id" db:"user_id"`
+	Platform   *string                `json:"platform,omitempty" db:"platform"`
+	Model      *string                `json:"model,omitempty" db:"model"`
+	OSVersion  *string                `json:"os_version,omitempty" db:"os_version"`
+	AppVersion *string                `json:"app_version,omitempty" db:"app_version"`
+	DeviceInfo map[string]interface{} `json:"device_info,omitempty" db:"device_info"`
+	EnrolledAt time.Time              `json:"enrolled_at" db:"enrolled_at"`
+	LastSeen   *time.Time             `json:"last_seen,omitempty" db:"last_seen"`
+	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// NewDevice builds a device from the device_info sent at enrollment, picking out
+// the well-known platform fields
+func NewDevice(deviceID, userID string, info map[string]interface{}) *Device {
+	device := &Device{ID: deviceID, UserID: userID, DeviceInfo: info}
+	field := func(key string) *string {
+		if v, ok := info[key].(string); ok && v != "" {
+			return &v
+		}
+		return nil
+	}
+	device.Platform = field("platform")
+	device.Model = field("model")
+	device.OSVersion = field("os_version")
+	device.AppVersion = field("app_version")
+	return device
+}
@@ -14,6 +14,10 @@ type Message struct {
 	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
 	SyncedAt    *time.Time `json:"synced_at,omitempty" db:"synced_at"`
 	ReadAt      *time.Time `json:"read_at,omitempty" db:"read_at"`
+	HLC         string     `json:"hlc" db:"hlc"` // Hybrid logical clock timestamp; orders messages across devices
+	// Uploads only: hlc of the server version a device edited. Set, the upload
+	// is an edit of a stored message rather than a new one.
+	BaseHLC string `json:"base_hlc,omitempty" db:"-"`
 }
 
 type CreateMessageRequest struct {
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// ReplicationSlotStats reports how much WAL a replication slot is holding back
+type ReplicationSlotStats struct {
+	SlotName      string    `json:"slot_name"`
+	Active        bool      `json:"active"`
+	WALStatus     string    `json:"wal_status,omitempty"`
+	RetainedBytes int64     `json:"retained_bytes"`  // WAL kept since restart_lsn
+	FlushLagBytes int64     `json:"flush_lag_bytes"` // WAL written since confirmed_flush_lsn
+	OverThreshold bool      `json:"over_threshold"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
@@ -11,6 +11,15 @@ type SyncMetadata struct {
 	LastSyncedLSN        *string    `json:"last_synced_lsn,omitempty" db:"last_synced_lsn"`
 	PendingOutgoingCount int        `json:"pending_outgoing_count" db:"pending_outgoing_count"`
 	SyncStatus           string     `json:"sync_status" db:"sync_status"`
+	NeedsFullResync      bool       `json:"needs_full_resync" db:"needs_full_resync"`
+	Snapshot             *string    `json:"-" db:"snapshot"`              // pg_snapshot the device was bootstrapped from
+	SnapshotLSN          *string    `json:"-" db:"snapshot_lsn"`          // WAL position read right after the snapshot was taken
+	ResyncRequestedAt    *time.Time `json:"-" db:"resync_requested_at"`   // When the current full resync was requested
+	SnapshotRequestedAt  *time.Time `json:"-" db:"snapshot_requested_at"` // resync_requested_at of the resync the snapshot serves
+	SnapshotTakenAt      *time.Time `json:"-" db:"snapshot_taken_at"`     // When the snapshot was taken
+	SnapshotPage         int        `json:"-" db:"snapshot_page"`         // Snapshot pages acknowledged
+	SnapshotRule         int        `json:"-" db:"snapshot_rule"`         // Sync rule the next page starts in
+	SnapshotAfter        *string    `json:"-" db:"snapshot_after"`        // Last id acknowledged in that rule
 	CreatedAt            time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt            time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -20,12 +29,62 @@ type SyncStatus struct {
 	LastSyncTimestamp    *time.Time `json:"last_sync_timestamp,omitempty"`
 	PendingOutgoingCount int        `json:"pending_outgoing_count"`
 	SyncStatus           string     `json:"sync_status"`
+	NeedsFullResync      bool       `json:"needs_full_resync"`
 }
 
 type SyncIncomingResponse struct {
-	Messages      []Message `json:"messages"`
-	Users         []User    `json:"users,omitempty"`
-	Compressed    bool      `json:"compressed"`
+	Messages      []Message     `json:"messages"`
+	Records       []Record      `json:"records,omitempty"`
+	Tombstones    []Tombstone   `json:"tombstones,omitempty"`
+	Snapshot      *SnapshotPage `json:"snapshot,omitempty"`
+	Cursor        string        `json:"cursor"`   // Signed position after this page; acknowledges it and resumes from it
+	HasMore       bool          `json:"has_more"` // Another page is already waiting
+	Users         []User        `json:"users,omitempty"`
+	Compressed    bool          `json:"compressed"`
+	SyncTimestamp time.Time     `json:"sync_timestamp"`
+	HLC           string        `json:"hlc"` // Server clock; devices merge it into their own
+}
+
+// Record is a row of a synced table other than messages, tagged with its table
+type Record struct {
+	Table     string                 `json:"table"`
+	Operation string                 `json:"operation"` // "INSERT" or "UPDATE"
+	Data      map[string]interface{} `json:"data"`
+	UpdatedAt time.Time              `json:"updated_at"` // Commit time of the change
+	HLC       string                 `json:"hlc"`        // Hybrid logical clock timestamp of the change
+}
+
+// Tombstone tells a device to delete a row that was deleted on the server
+type Tombstone struct {
+	Table     string    `json:"table"`
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	HLC       string    `json:"hlc"`
+}
+
+// SnapshotPage marks an incoming response as a page of a device's initial snapshot
+type SnapshotPage struct {
+	Reset bool `json:"reset"` // First page: discard local data before applying it
+	Done  bool `json:"done"`  // Last page: later responses carry live changes
+}
+
+// IncomingChanges holds the server changes delivered to a device in one sync
+type IncomingChanges struct {
+	Messages   []Message
+	Records    []Record
+	Tombstones []Tombstone
+	Snapshot   *SnapshotPage // Set while the device is being bootstrapped
+	Cursor     string        // Acknowledges the page once the device has applied it
+	HasMore    bool          // More changes are pending after this page
+}
+
+// SyncAckRequest acknowledges a page of incoming changes
+type SyncAckRequest struct {
+	Cursor string `json:"cursor"`
+}
+
+type SyncAckResponse struct {
+	Acknowledged  bool      `json:"acknowledged"`
 	SyncTimestamp time.Time `json:"sync_timestamp"`
 }
 
@@ -35,15 +94,56 @@ type SyncOutgoingRequest struct {
 }
 
 type SyncOutgoingResponse struct {
-	SyncedCount    int             `json:"synced_count"`
-	FailedCount    int             `json:"failed_count"`
-	FailedMessages []FailedMessage `json:"failed_messages,omitempty"`
-	SyncTimestamp  time.Time       `json:"sync_timestamp"`
+	SyncedCount    int                   `json:"synced_count"` // Created, updated or duplicate
+	FailedCount    int                   `json:"failed_count"` // Conflict or rejected
+	Results        []MessageUploadResult `json:"results"`      // One per uploaded message, in request order
+	FailedMessages []FailedMessage       `json:"failed_messages,omitempty"`
+	SyncTimestamp  time.Time             `json:"sync_timestamp"`
+	HLC            string                `json:"hlc"` // Server clock; devices merge it into their own
 }
 
 type FailedMessage struct {
 	MessageID string `json:"message_id"`
-	Error     string `json:"error"`
+	Error     string `json:"error"` // Reason code, or "conflict"
+}
+
+// UploadOutcome is what happened to an uploaded message
+type UploadOutcome string
+
+// Outcomes of an uploaded message. The device can mark created and duplicate
+// messages as synced; conflict and rejected ones will never be accepted as sent.
+const (
+	UploadCreated   UploadOutcome = "created"   // Stored now
+	UploadUpdated   UploadOutcome = "updated"   // The device's edit was applied
+	UploadDuplicate UploadOutcome = "duplicate" // Already stored by an earlier upload
+	UploadConflict  UploadOutcome = "conflict"  // The ID belongs to a different message, or the edit lost a conflict
+	UploadRejected  UploadOutcome = "rejected"  // Not stored; see the reason code
+)
+
+// Reason codes of rejected uploads
+const (
+	RejectMissingID        = "missing_id"        // The message has no client-generated ID
+	RejectInvalidID        = "invalid_id"        // The ID is not a UUID
+	RejectSenderMismatch   = "sender_mismatch"   // The sender is not the device's user
+	RejectInvalidRecipient = "invalid_recipient" // The recipient is missing or not a UUID
+	RejectUnknownRecipient = "unknown_recipient" // No user has the recipient ID
+	RejectEmptyContent     = "empty_content"     // The message has no content
+	RejectUnknownMessage   = "unknown_message"   // An edit of a message the server does not have
+	RejectInvalidStatus    = "invalid_status"    // The status is not a message status
+	RejectInvalidHLC       = "invalid_hlc"       // The hlc is not a hybrid logical clock timestamp
+	RejectInternalError    = "internal_error"    // The server failed to store it; retry later
+)
+
+// MessageUploadResult is the outcome of one uploaded message
+type MessageUploadResult struct {
+	MessageID string        `json:"message_id"`
+	Outcome   UploadOutcome `json:"outcome"`
+	Reason    string        `json:"reason,omitempty"` // Set when rejected
+	// Set when an edit conflicted with a server change: "device" or "server" for
+	// the version kept by last_write_wins, "manual" while it awaits a decision
+	Resolution string `json:"resolution,omitempty"`
+	ConflictID string `json:"conflict_id,omitempty"`
+	HLC        string `json:"hlc,omitempty"` // HLC the message is stored with, when it was stored now or before
 }
 
 
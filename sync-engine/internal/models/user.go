@@ -8,7 +8,7 @@ type User struct {
 	ID                string     `json:"id" db:"id"`
 	Username          string     `json:"username" db:"username"`
 	UserType          string     `json:"user_type" db:"user_type"`
-	DeviceID          *string    `json:"device_id,omitempty" db:"device_id"`
+	DeviceID          *string    `json:"device_id,omitempty" db:"device_id"` // Most recently enrolled device, see Device
 	OnlineStatus      bool       `json:"online_status" db:"online_status"`
 	LastSeen          *time.Time `json:"last_seen,omitempty" db:"last_seen"`
 	EnrolledAt        *time.Time `json:"enrolled_at,omitempty" db:"enrolled_at"`
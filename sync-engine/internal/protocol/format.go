@@ -0,0 +1,186 @@
+// Package protocol encodes the sync payloads in their wire formats: JSON, the
+// default, and Protocol Buffers (sync.proto), for clients that send
+// Accept: application/x-protobuf. Both formats encode the models types;
+// protobuf bodies go through the types generated into syncpb.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"posduif/sync-engine/internal/models"
+	"posduif/sync-engine/internal/protocol/syncpb"
+)
+
+// Media types of the wire formats
+const (
+	JSON     = "application/json"
+	Protobuf = "application/x-protobuf"
+)
+
+// Package is the protobuf package of the current schema version
+const Package = "posduif.sync.v1"
+
+var (
+	// ErrUnsupportedMediaType is returned for a request body in a format or
+	// schema version the engine cannot decode
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// ErrUnsupportedType is returned for a value without a protobuf message
+	ErrUnsupportedType = errors.New("no protobuf message for type")
+)
+
+// Negotiate picks the format of a response from a request's Accept header.
+// Protobuf is only picked when the client names it and prefers it at least
+// as much as JSON; wildcards and missing headers get JSON.
+func Negotiate(accept string) string {
+	jsonQ, protobufQ := -1.0, -1.0
+	applicationQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch name {
+		case JSON:
+			jsonQ = q
+		case Protobuf:
+			protobufQ = q
+		case "application/*":
+			applicationQ = q
+		case "*/*":
+			anyQ = q
+		}
+	}
+
+	if jsonQ < 0 {
+		jsonQ = applicationQ
+	}
+	if jsonQ < 0 {
+		jsonQ = anyQ
+	}
+	if protobufQ > 0 && protobufQ >= jsonQ {
+		return Protobuf
+	}
+	return JSON
+}
+
+// RequestFormat returns the format of a request body from its Content-Type.
+// Bodies that are not protobuf are decoded as JSON, as they always were. A
+// protobuf body of another schema version fails with ErrUnsupportedMediaType.
+func RequestFormat(contentType string, v interface{}) (string, error) {
+	if contentType == "" {
+		return JSON, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != Protobuf {
+		return JSON, nil
+	}
+	if name, ok := params["proto"]; ok {
+		want, err := messageName(v)
+		if err != nil {
+			return "", err
+		}
+		if name != want {
+			return "", fmt.Errorf("%w: %s, want %s", ErrUnsupportedMediaType, name, want)
+		}
+	}
+	return Protobuf, nil
+}
+
+// ContentType returns the Content-Type of v encoded in format. Protobuf
+// bodies name their message, which carries the schema version.
+func ContentType(format string, v interface{}) string {
+	if format != Protobuf {
+		return JSON
+	}
+	name, err := messageName(v)
+	if err != nil {
+		return Protobuf
+	}
+	return mime.FormatMediaType(Protobuf, map[string]string{"proto": name})
+}
+
+// Marshal encodes v in format
+func Marshal(format string, v interface{}) ([]byte, error) {
+	if format != Protobuf {
+		return json.Marshal(v)
+	}
+
+	var m proto.Message
+	switch v := v.(type) {
+	case *models.SyncIncomingResponse:
+		var err error
+		if m, err = incomingResponseToProto(v); err != nil {
+			return nil, err
+		}
+	case *models.SyncOutgoingRequest:
+		m = outgoingRequestToProto(v)
+	case *models.SyncOutgoingResponse:
+		m = outgoingResponseToProto(v)
+	default:
+		return nil, fmt.Errorf("%w %T", ErrUnsupportedType, v)
+	}
+	return marshalOptions.Marshal(m)
+}
+
+// Unmarshal decodes data in format into v. Numbers in record data decode to
+// json.Number in both formats.
+func Unmarshal(format string, data []byte, v interface{}) error {
+	if format != Protobuf {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		return decoder.Decode(v)
+	}
+
+	var err error
+	switch m := v.(type) {
+	case *models.SyncIncomingResponse:
+		var pb syncpb.SyncIncomingResponse
+		if err = unmarshalOptions.Unmarshal(data, &pb); err == nil {
+			err = incomingResponseFromProto(&pb, m)
+		}
+	case *models.SyncOutgoingRequest:
+		var pb syncpb.SyncOutgoingRequest
+		if err = unmarshalOptions.Unmarshal(data, &pb); err == nil {
+			err = outgoingRequestFromProto(&pb, m)
+		}
+	case *models.SyncOutgoingResponse:
+		var pb syncpb.SyncOutgoingResponse
+		if err = unmarshalOptions.Unmarshal(data, &pb); err == nil {
+			err = outgoingResponseFromProto(&pb, m)
+		}
+	default:
+		return fmt.Errorf("%w %T", ErrUnsupportedType, v)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode protobuf: %w", err)
+	}
+	return nil
+}
+
+// messageName returns the fully qualified protobuf message name of v
+func messageName(v interface{}) (string, error) {
+	switch v.(type) {
+	case *models.SyncIncomingResponse:
+		return Package + ".SyncIncomingResponse", nil
+	case *models.SyncOutgoingRequest:
+		return Package + ".SyncOutgoingRequest", nil
+	case *models.SyncOutgoingResponse:
+		return Package + ".SyncOutgoingResponse", nil
+	}
+	return "", fmt.Errorf("%w %T", ErrUnsupportedType, v)
+}
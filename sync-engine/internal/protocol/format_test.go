@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"posduif/sync-engine/internal/models"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                                  JSON,
+		"*/*":                               JSON,
+		"application/json":                  JSON,
+		"application/x-protobuf":            Protobuf,
+		"Application/X-Protobuf; q=0.5":     Protobuf,
+		"application/x-protobuf, */*;q=0.1": Protobuf,
+		"application/json, application/x-protobuf;q=0.9": JSON,
+		"application/json;q=0.5, application/x-protobuf": Protobuf,
+		"application/x-protobuf;q=0":                     JSON,
+		"text/html":                                      JSON,
+	}
+	for header, want := range tests {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestRequestFormat(t *testing.T) {
+	req := &models.SyncOutgoingRequest{}
+	tests := []struct {
+		contentType string
+		want        string
+		err         error
+	}{
+		{"", JSON, nil},
+		{"application/json; charset=utf-8", JSON, nil},
+		{"text/plain", JSON, nil},
+		{"application/x-protobuf", Protobuf, nil},
+		{"application/x-protobuf; proto=posduif.sync.v1.SyncOutgoingRequest", Protobuf, nil},
+		{"application/x-protobuf; proto=posduif.sync.v2.SyncOutgoingRequest", "", ErrUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		got, err := RequestFormat(tt.contentType, req)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("RequestFormat(%q) = %q, %v, want %q, %v", tt.contentType, got, err, tt.want, tt.err)
+		}
+	}
+
+	if got := ContentType(Protobuf, &models.SyncIncomingResponse{}); got != "application/x-protobuf; proto=posduif.sync.v1.SyncIncomingResponse" {
+		t.Errorf("ContentType = %q", got)
+	}
+}
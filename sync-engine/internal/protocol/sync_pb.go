@@ -0,0 +1,415 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"posduif/sync-engine/internal/models"
+	"posduif/sync-engine/internal/protocol/syncpb"
+)
+
+//go:generate protoc --go_out=syncpb --go_opt=paths=source_relative sync.proto
+
+// Conversions between the models types and the posduif.sync.v1 messages
+// generated from sync.proto.
+
+// maxDepth bounds the nesting of decoded messages, so a crafted body cannot
+// exhaust the stack through deeply nested record values
+const maxDepth = 64
+
+var (
+	// Map entries are sorted by key, so equal data always encodes to the same bytes
+	marshalOptions   = proto.MarshalOptions{Deterministic: true}
+	unmarshalOptions = proto.UnmarshalOptions{RecursionLimit: maxDepth}
+)
+
+func incomingResponseToProto(r *models.SyncIncomingResponse) (*syncpb.SyncIncomingResponse, error) {
+	pb := &syncpb.SyncIncomingResponse{
+		Cursor:        r.Cursor,
+		HasMore:       r.HasMore,
+		Compressed:    r.Compressed,
+		SyncTimestamp: timestamppb.New(r.SyncTimestamp),
+		Hlc:           r.HLC,
+	}
+	for i := range r.Messages {
+		pb.Messages = append(pb.Messages, messageToProto(&r.Messages[i]))
+	}
+	for i := range r.Records {
+		record, err := recordToProto(&r.Records[i])
+		if err != nil {
+			return nil, err
+		}
+		pb.Records = append(pb.Records, record)
+	}
+	for i := range r.Tombstones {
+		t := &r.Tombstones[i]
+		pb.Tombstones = append(pb.Tombstones, &syncpb.Tombstone{
+			Table:     t.Table,
+			Id:        t.ID,
+			DeletedAt: timestamppb.New(t.DeletedAt),
+			Hlc:       t.HLC,
+		})
+	}
+	if r.Snapshot != nil {
+		pb.Snapshot = &syncpb.SnapshotPage{Reset_: r.Snapshot.Reset, Done: r.Snapshot.Done}
+	}
+	for i := range r.Users {
+		pb.Users = append(pb.Users, userToProto(&r.Users[i]))
+	}
+	return pb, nil
+}
+
+func incomingResponseFromProto(pb *syncpb.SyncIncomingResponse, r *models.SyncIncomingResponse) error {
+	var err error
+	r.Cursor = pb.Cursor
+	r.HasMore = pb.HasMore
+	r.Compressed = pb.Compressed
+	r.HLC = pb.Hlc
+	if r.SyncTimestamp, err = timeFromProto(pb.SyncTimestamp); err != nil {
+		return err
+	}
+	for _, m := range pb.Messages {
+		msg, err := messageFromProto(m)
+		if err != nil {
+			return err
+		}
+		r.Messages = append(r.Messages, *msg)
+	}
+	for _, rec := range pb.Records {
+		record, err := recordFromProto(rec)
+		if err != nil {
+			return err
+		}
+		r.Records = append(r.Records, *record)
+	}
+	for _, t := range pb.Tombstones {
+		tombstone := models.Tombstone{Table: t.Table, ID: t.Id, HLC: t.Hlc}
+		if tombstone.DeletedAt, err = timeFromProto(t.DeletedAt); err != nil {
+			return err
+		}
+		r.Tombstones = append(r.Tombstones, tombstone)
+	}
+	if pb.Snapshot != nil {
+		r.Snapshot = &models.SnapshotPage{Reset: pb.Snapshot.Reset_, Done: pb.Snapshot.Done}
+	}
+	for _, u := range pb.Users {
+		user, err := userFromProto(u)
+		if err != nil {
+			return err
+		}
+		r.Users = append(r.Users, *user)
+	}
+	return nil
+}
+
+func outgoingRequestToProto(r *models.SyncOutgoingRequest) *syncpb.SyncOutgoingRequest {
+	pb := &syncpb.SyncOutgoingRequest{Compressed: r.Compressed}
+	for i := range r.Messages {
+		pb.Messages = append(pb.Messages, messageToProto(&r.Messages[i]))
+	}
+	return pb
+}
+
+func outgoingRequestFromProto(pb *syncpb.SyncOutgoingRequest, r *models.SyncOutgoingRequest) error {
+	r.Compressed = pb.Compressed
+	for _, m := range pb.Messages {
+		msg, err := messageFromProto(m)
+		if err != nil {
+			return err
+		}
+		r.Messages = append(r.Messages, *msg)
+	}
+	return nil
+}
+
+func outgoingResponseToProto(r *models.SyncOutgoingResponse) *syncpb.SyncOutgoingResponse {
+	pb := &syncpb.SyncOutgoingResponse{
+		SyncedCount:   int64(r.SyncedCount),
+		FailedCount:   int64(r.FailedCount),
+		SyncTimestamp: timestamppb.New(r.SyncTimestamp),
+		Hlc:           r.HLC,
+	}
+	for i := range r.Results {
+		result := &r.Results[i]
+		pb.Results = append(pb.Results, &syncpb.MessageUploadResult{
+			MessageId:  result.MessageID,
+			Outcome:    string(result.Outcome),
+			Reason:     result.Reason,
+			Resolution: result.Resolution,
+			ConflictId: result.ConflictID,
+			Hlc:        result.HLC,
+		})
+	}
+	for i := range r.FailedMessages {
+		failed := &r.FailedMessages[i]
+		pb.FailedMessages = append(pb.FailedMessages, &syncpb.FailedMessage{MessageId: failed.MessageID, Error: failed.Error})
+	}
+	return pb
+}
+
+func outgoingResponseFromProto(pb *syncpb.SyncOutgoingResponse, r *models.SyncOutgoingResponse) error {
+	var err error
+	r.SyncedCount = int(pb.SyncedCount)
+	r.FailedCount = int(pb.FailedCount)
+	r.HLC = pb.Hlc
+	if r.SyncTimestamp, err = timeFromProto(pb.SyncTimestamp); err != nil {
+		return err
+	}
+	for _, result := range pb.Results {
+		r.Results = append(r.Results, models.MessageUploadResult{
+			MessageID:  result.MessageId,
+			Outcome:    models.UploadOutcome(result.Outcome),
+			Reason:     result.Reason,
+			Resolution: result.Resolution,
+			ConflictID: result.ConflictId,
+			HLC:        result.Hlc,
+		})
+	}
+	for _, failed := range pb.FailedMessages {
+		r.FailedMessages = append(r.FailedMessages, models.FailedMessage{MessageID: failed.MessageId, Error: failed.Error})
+	}
+	return nil
+}
+
+func messageToProto(m *models.Message) *syncpb.Message {
+	return &syncpb.Message{
+		Id:          m.ID,
+		SenderId:    m.SenderID,
+		RecipientId: m.RecipientID,
+		Content:     m.Content,
+		Status:      m.Status,
+		CreatedAt:   timestamppb.New(m.CreatedAt),
+		UpdatedAt:   timestamppb.New(m.UpdatedAt),
+		SyncedAt:    optionalTimeToProto(m.SyncedAt),
+		ReadAt:      optionalTimeToProto(m.ReadAt),
+		Hlc:         m.HLC,
+		BaseHlc:     m.BaseHLC,
+	}
+}
+
+func messageFromProto(pb *syncpb.Message) (*models.Message, error) {
+	m := &models.Message{
+		ID:          pb.Id,
+		SenderID:    pb.SenderId,
+		RecipientID: pb.RecipientId,
+		Content:     pb.Content,
+		Status:      pb.Status,
+		HLC:         pb.Hlc,
+		BaseHLC:     pb.BaseHlc,
+	}
+	var err error
+	if m.CreatedAt, err = timeFromProto(pb.CreatedAt); err != nil {
+		return nil, err
+	}
+	if m.UpdatedAt, err = timeFromProto(pb.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if m.SyncedAt, err = optionalTimeFromProto(pb.SyncedAt); err != nil {
+		return nil, err
+	}
+	if m.ReadAt, err = optionalTimeFromProto(pb.ReadAt); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func recordToProto(r *models.Record) (*syncpb.Record, error) {
+	pb := &syncpb.Record{
+		Table:     r.Table,
+		Operation: r.Operation,
+		UpdatedAt: timestamppb.New(r.UpdatedAt),
+		Hlc:       r.HLC,
+	}
+	if r.Data != nil {
+		data, err := normalizeData(r.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s record: %w", r.Table, err)
+		}
+		pb.Data = structToProto(data)
+	}
+	return pb, nil
+}
+
+func recordFromProto(pb *syncpb.Record) (*models.Record, error) {
+	r := &models.Record{Table: pb.Table, Operation: pb.Operation, HLC: pb.Hlc}
+	var err error
+	if r.UpdatedAt, err = timeFromProto(pb.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if pb.Data != nil {
+		if r.Data, err = structFromProto(pb.Data); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func userToProto(u *models.User) *syncpb.User {
+	return &syncpb.User{
+		Id:                u.ID,
+		Username:          u.Username,
+		UserType:          u.UserType,
+		DeviceId:          u.DeviceID,
+		OnlineStatus:      u.OnlineStatus,
+		LastSeen:          optionalTimeToProto(u.LastSeen),
+		EnrolledAt:        optionalTimeToProto(u.EnrolledAt),
+		EnrollmentTokenId: u.EnrollmentTokenID,
+		LastMessageSent:   u.LastMessageSent,
+		CreatedAt:         timestamppb.New(u.CreatedAt),
+		UpdatedAt:         timestamppb.New(u.UpdatedAt),
+	}
+}
+
+func userFromProto(pb *syncpb.User) (*models.User, error) {
+	u := &models.User{
+		ID:                pb.Id,
+		Username:          pb.Username,
+		UserType:          pb.UserType,
+		DeviceID:          pb.DeviceId,
+		OnlineStatus:      pb.OnlineStatus,
+		EnrollmentTokenID: pb.EnrollmentTokenId,
+		LastMessageSent:   pb.LastMessageSent,
+	}
+	var err error
+	if u.LastSeen, err = optionalTimeFromProto(pb.LastSeen); err != nil {
+		return nil, err
+	}
+	if u.EnrolledAt, err = optionalTimeFromProto(pb.EnrolledAt); err != nil {
+		return nil, err
+	}
+	if u.CreatedAt, err = timeFromProto(pb.CreatedAt); err != nil {
+		return nil, err
+	}
+	if u.UpdatedAt, err = timeFromProto(pb.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// timeFromProto converts a timestamp; a missing one is the zero time
+func timeFromProto(ts *timestamppb.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, err
+	}
+	return ts.AsTime(), nil
+}
+
+func optionalTimeToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func optionalTimeFromProto(ts *timestamppb.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	t, err := timeFromProto(ts)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// normalizeData converts record data to the values its JSON form decodes to,
+// with numbers as json.Number. Record values are times, raw JSON and other
+// types whose JSON encoding is their wire form, so both formats carry the
+// same data.
+func normalizeData(data map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var normalized map[string]interface{}
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func structToProto(fields map[string]interface{}) *syncpb.Struct {
+	pb := &syncpb.Struct{Fields: make(map[string]*syncpb.Value, len(fields))}
+	for key, value := range fields {
+		pb.Fields[key] = valueToProto(value)
+	}
+	return pb
+}
+
+// valueToProto converts a normalized JSON value
+func valueToProto(value interface{}) *syncpb.Value {
+	switch v := value.(type) {
+	case json.Number:
+		return &syncpb.Value{Kind: &syncpb.Value_NumberValue{NumberValue: string(v)}}
+	case string:
+		return &syncpb.Value{Kind: &syncpb.Value_StringValue{StringValue: v}}
+	case bool:
+		return &syncpb.Value{Kind: &syncpb.Value_BoolValue{BoolValue: v}}
+	case map[string]interface{}:
+		return &syncpb.Value{Kind: &syncpb.Value_StructValue{StructValue: structToProto(v)}}
+	case []interface{}:
+		list := &syncpb.ListValue{Values: make([]*syncpb.Value, 0, len(v))}
+		for _, element := range v {
+			list.Values = append(list.Values, valueToProto(element))
+		}
+		return &syncpb.Value{Kind: &syncpb.Value_ListValue{ListValue: list}}
+	}
+	return &syncpb.Value{Kind: &syncpb.Value_NullValue{}}
+}
+
+// isJSONNumber reports whether s is a number in JSON syntax
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+func structFromProto(pb *syncpb.Struct) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(pb.GetFields()))
+	for key, value := range pb.GetFields() {
+		v, err := valueFromProto(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = v
+	}
+	return fields, nil
+}
+
+func valueFromProto(pb *syncpb.Value) (interface{}, error) {
+	switch kind := pb.GetKind().(type) {
+	case *syncpb.Value_NumberValue:
+		if !isJSONNumber(kind.NumberValue) {
+			return nil, fmt.Errorf("invalid number %q", kind.NumberValue)
+		}
+		return json.Number(kind.NumberValue), nil
+	case *syncpb.Value_StringValue:
+		return kind.StringValue, nil
+	case *syncpb.Value_BoolValue:
+		return kind.BoolValue, nil
+	case *syncpb.Value_StructValue:
+		return structFromProto(kind.StructValue)
+	case *syncpb.Value_ListValue:
+		list := make([]interface{}, 0, len(kind.ListValue.GetValues()))
+		for _, element := range kind.ListValue.GetValues() {
+			v, err := valueFromProto(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	// A null, or a kind added by a newer schema
+	return nil, nil
+}
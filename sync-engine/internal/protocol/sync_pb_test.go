@@ -0,0 +1,256 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"posduif/sync-engine/internal/models"
+	"posduif/sync-engine/internal/protocol/syncpb"
+)
+
+// roundTrip encodes v in format and decodes it into a new value of its type
+func roundTrip(t *testing.T, format string, v interface{}) interface{} {
+	t.Helper()
+	data, err := Marshal(format, v)
+	if err != nil {
+		t.Fatalf("Marshal(%s): %v", format, err)
+	}
+	decoded := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+	if err := Unmarshal(format, data, decoded); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", format, err)
+	}
+	return decoded
+}
+
+// checkConformance checks that v survives both formats unchanged, as want
+func checkConformance(t *testing.T, v, want interface{}) {
+	t.Helper()
+	for _, format := range []string{JSON, Protobuf} {
+		if got := roundTrip(t, format, v); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s round trip:\n got  %+v\n want %+v", format, got, want)
+		}
+	}
+}
+
+func TestIncomingResponseConformance(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	read := created.Add(time.Minute)
+	empty := ""
+	deviceID := "device-1"
+
+	response := &models.SyncIncomingResponse{
+		Messages: []models.Message{
+			{ID: "m1", SenderID: "u1", RecipientID: "u2", Content: "hello", Status: "pending_sync",
+				CreatedAt: created, UpdatedAt: created, HLC: "1709296200123-00000-node"},
+			{ID: "m2", Content: "read", Status: "read", CreatedAt: created, UpdatedAt: read,
+				SyncedAt: &created, ReadAt: &read},
+		},
+		Records: []models.Record{{
+			Table:     "orders",
+			Operation: "UPDATE",
+			Data: map[string]interface{}{
+				"id":       "o1",
+				"total":    json.Number("12345678901234567890.50"),
+				"quantity": 3,
+				"ratio":    0.25,
+				"paid":     true,
+				"note":     nil,
+				"placed":   created,
+				"extra":    json.RawMessage(`{"tags":["a",null,[]],"meta":{}}`),
+			},
+			UpdatedAt: created,
+			HLC:       "1709296200123-00001-commit",
+		}},
+		Tombstones: []models.Tombstone{{Table: "orders", ID: "o2", DeletedAt: created, HLC: "1709296200123-00002-commit"}},
+		Snapshot:   &models.SnapshotPage{Reset: true},
+		Cursor:     "c2lnbmVk.c2ln",
+		HasMore:    true,
+		Users: []models.User{
+			{ID: "u1", Username: "alice", UserType: "mobile", DeviceID: &deviceID, OnlineStatus: true,
+				LastSeen: &read, LastMessageSent: &empty, CreatedAt: created, UpdatedAt: created},
+		},
+		Compressed:    true,
+		SyncTimestamp: read,
+		HLC:           "1709296260000-00000-server",
+	}
+
+	want := *response
+	want.Records = []models.Record{response.Records[0]}
+	want.Records[0].Data = map[string]interface{}{
+		"id":       "o1",
+		"total":    json.Number("12345678901234567890.50"),
+		"quantity": json.Number("3"),
+		"ratio":    json.Number("0.25"),
+		"paid":     true,
+		"note":     nil,
+		"placed":   "2024-03-01T12:30:00.123456789Z",
+		"extra": map[string]interface{}{
+			"tags": []interface{}{"a", nil, []interface{}{}},
+			"meta": map[string]interface{}{},
+		},
+	}
+	checkConformance(t, response, &want)
+
+	checkConformance(t, &models.SyncIncomingResponse{}, &models.SyncIncomingResponse{})
+}
+
+func TestOutgoingConformance(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	request := &models.SyncOutgoingRequest{
+		Messages: []models.Message{{ID: "m1", RecipientID: "u2", Content: "edited", Status: "pending_sync",
+			CreatedAt: created, UpdatedAt: created, BaseHLC: "1709296200000-00001-server", HLC: "1709296200000-00003-device"}},
+	}
+	checkConformance(t, request, request)
+
+	response := &models.SyncOutgoingResponse{
+		SyncedCount: 1,
+		FailedCount: 1,
+		Results: []models.MessageUploadResult{
+			{MessageID: "m1", Outcome: models.UploadUpdated, Resolution: "device", ConflictID: "c1", HLC: "1709296200000-00005-server"},
+			{MessageID: "m2", Outcome: models.UploadRejected, Reason: models.RejectEmptyContent},
+		},
+		FailedMessages: []models.FailedMessage{{MessageID: "m2", Error: models.RejectEmptyContent}},
+		SyncTimestamp:  created,
+		HLC:            "1709296200000-00004-server",
+	}
+	checkConformance(t, response, response)
+}
+
+func TestProtobufCompatibility(t *testing.T) {
+	request := &models.SyncOutgoingRequest{Messages: []models.Message{{ID: "m1", Content: "hi"}}}
+	data, err := Marshal(Protobuf, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields added by a newer schema are skipped
+	future := protowire.AppendTag(nil, 99, protowire.BytesType)
+	future = protowire.AppendString(future, "from the future")
+	future = protowire.AppendTag(future, 100, protowire.VarintType)
+	future = protowire.AppendVarint(future, 7)
+	var decoded models.SyncOutgoingRequest
+	if err := Unmarshal(Protobuf, append(append([]byte(nil), data...), future...), &decoded); err != nil {
+		t.Fatalf("unknown fields: %v", err)
+	}
+	if len(decoded.Messages) != 1 || decoded.Messages[0].Content != "hi" {
+		t.Errorf("decoded %+v", decoded)
+	}
+
+	// Truncated bodies fail instead of decoding partially
+	for n := 1; n < len(data); n++ {
+		var partial models.SyncOutgoingRequest
+		if err := Unmarshal(Protobuf, data[:n], &partial); err == nil {
+			t.Errorf("Unmarshal of %d of %d bytes succeeded", n, len(data))
+		}
+	}
+
+	// A field with the wrong wire type is skipped as unknown, as by every protobuf decoder
+	wrong := protowire.AppendTag(nil, 1, protowire.VarintType)
+	wrong = protowire.AppendVarint(wrong, 1)
+	decoded = models.SyncOutgoingRequest{}
+	if err := Unmarshal(Protobuf, wrong, &decoded); err != nil || len(decoded.Messages) != 0 {
+		t.Errorf("Unmarshal of a varint messages field = %+v, %v", decoded, err)
+	}
+
+	// A number that is not a number fails
+	bad := &syncpb.Record{Data: &syncpb.Struct{Fields: map[string]*syncpb.Value{
+		"total": {Kind: &syncpb.Value_NumberValue{NumberValue: "12,50"}},
+	}}}
+	badData, err := proto.Marshal(&syncpb.SyncIncomingResponse{Records: []*syncpb.Record{bad}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response models.SyncIncomingResponse
+	if err := Unmarshal(Protobuf, badData, &response); err == nil {
+		t.Error("Unmarshal of an invalid number succeeded")
+	}
+}
+
+// compileSchema compiles sync.proto the way protoc does
+func compileSchema(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"."}}),
+	}
+	files, err := compiler.Compile(context.Background(), "sync.proto")
+	if err != nil {
+		t.Fatalf("compile sync.proto: %v", err)
+	}
+	return files[0]
+}
+
+func TestGeneratedTypesMatchSchema(t *testing.T) {
+	compiled := protodesc.ToFileDescriptorProto(compileSchema(t))
+	generated := protodesc.ToFileDescriptorProto(syncpb.File_sync_proto)
+	compiled.SourceCodeInfo = nil
+	if !proto.Equal(compiled, generated) {
+		t.Error("syncpb is out of date with sync.proto; run go generate ./internal/protocol")
+	}
+}
+
+func TestProtobufMatchesSchema(t *testing.T) {
+	schema := compileSchema(t)
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	response := &models.SyncIncomingResponse{
+		Messages: []models.Message{{ID: "m1", Content: "hello", CreatedAt: created, HLC: "1709296200000-00000-node"}},
+		Records: []models.Record{{Table: "orders", Operation: "INSERT",
+			Data: map[string]interface{}{"total": json.Number("12.50"), "tags": []interface{}{"a"}}}},
+		Snapshot: &models.SnapshotPage{Reset: true},
+		Cursor:   "c",
+	}
+	data, err := Marshal(Protobuf, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode the bytes with the schema alone, as a client generated from sync.proto would
+	desc := schema.Messages().ByName("SyncIncomingResponse")
+	decoded := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("decode with sync.proto: %v", err)
+	}
+	fields := desc.Fields()
+	message := decoded.Get(fields.ByName("messages")).List().Get(0).Message()
+	messageFields := message.Descriptor().Fields()
+	if got := message.Get(messageFields.ByName("hlc")).String(); got != "1709296200000-00000-node" {
+		t.Errorf("messages[0].hlc = %q", got)
+	}
+	createdAt := message.Get(messageFields.ByName("created_at")).Message()
+	if got := createdAt.Get(createdAt.Descriptor().Fields().ByName("seconds")).Int(); got != created.Unix() {
+		t.Errorf("messages[0].created_at.seconds = %d, want %d", got, created.Unix())
+	}
+	snapshot := decoded.Get(fields.ByName("snapshot")).Message()
+	if !snapshot.Get(snapshot.Descriptor().Fields().ByName("reset")).Bool() {
+		t.Error("snapshot.reset is not set")
+	}
+	record := decoded.Get(fields.ByName("records")).List().Get(0).Message()
+	recordData := record.Get(record.Descriptor().Fields().ByName("data")).Message()
+	entries := recordData.Get(recordData.Descriptor().Fields().ByName("fields")).Map()
+	total := entries.Get(protoreflect.ValueOfString("total").MapKey()).Message()
+	if got := total.Get(total.Descriptor().Fields().ByName("number_value")).String(); got != "12.50" {
+		t.Errorf("records[0].data.total = %q, want number_value 12.50", got)
+	}
+
+	// And the other way round: bytes written from the schema decode into the models
+	encoded, err := proto.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back models.SyncIncomingResponse
+	if err := Unmarshal(Protobuf, encoded, &back); err != nil {
+		t.Fatalf("Unmarshal of schema-encoded bytes: %v", err)
+	}
+	if len(back.Messages) != 1 || back.Messages[0].HLC != "1709296200000-00000-node" || !back.Messages[0].CreatedAt.Equal(created) ||
+		back.Records[0].Data["total"] != json.Number("12.50") || back.Snapshot == nil || !back.Snapshot.Reset || back.Cursor != "c" {
+		t.Errorf("decoded %+v", back)
+	}
+}
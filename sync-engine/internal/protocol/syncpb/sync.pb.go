@@ -0,0 +1,1371 @@
+// Binary wire format of the sync endpoints, served for
+// Accept: application/x-protobuf. It carries the same fields as the JSON
+// format; internal/protocol converts between the models types and the Go
+// types generated into internal/protocol/syncpb (go generate).
+//
+// Fields may be added to a message, but field numbers are never reused or
+// renumbered. A change that breaks existing clients needs a new package
+// version (posduif.sync.v2), which is announced in the proto parameter of
+// the Content-Type.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: sync.proto
+
+package syncpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type NullValue int32
+
+const (
+	NullValue_NULL_VALUE NullValue = 0
+)
+
+// Enum value maps for NullValue.
+var (
+	NullValue_name = map[int32]string{
+		0: "NULL_VALUE",
+	}
+	NullValue_value = map[string]int32{
+		"NULL_VALUE": 0,
+	}
+)
+
+func (x NullValue) Enum() *NullValue {
+	p := new(NullValue)
+	*p = x
+	return p
+}
+
+func (x NullValue) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (NullValue) Descriptor() protoreflect.EnumDescriptor {
+	return file_sync_proto_enumTypes[0].Descriptor()
+}
+
+func (NullValue) Type() protoreflect.EnumType {
+	return &file_sync_proto_enumTypes[0]
+}
+
+func (x NullValue) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use NullValue.Descriptor instead.
+func (NullValue) EnumDescriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{0}
+}
+
+// GET /api/sync/incoming
+type SyncIncomingResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*Message             `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	Records       []*Record              `protobuf:"bytes,2,rep,name=records,proto3" json:"records,omitempty"`
+	Tombstones    []*Tombstone           `protobuf:"bytes,3,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+	Snapshot      *SnapshotPage          `protobuf:"bytes,4,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	Cursor        string                 `protobuf:"bytes,5,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	HasMore       bool                   `protobuf:"varint,6,opt,name=has_more,json=hasMore,proto3" json:"has_more,omitempty"`
+	Users         []*User                `protobuf:"bytes,7,rep,name=users,proto3" json:"users,omitempty"`
+	Compressed    bool                   `protobuf:"varint,8,opt,name=compressed,proto3" json:"compressed,omitempty"`
+	SyncTimestamp *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=sync_timestamp,json=syncTimestamp,proto3" json:"sync_timestamp,omitempty"`
+	Hlc           string                 `protobuf:"bytes,10,opt,name=hlc,proto3" json:"hlc,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncIncomingResponse) Reset() {
+	*x = SyncIncomingResponse{}
+	mi := &file_sync_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncIncomingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncIncomingResponse) ProtoMessage() {}
+
+func (x *SyncIncomingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncIncomingResponse.ProtoReflect.Descriptor instead.
+func (*SyncIncomingResponse) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SyncIncomingResponse) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *SyncIncomingResponse) GetRecords() []*Record {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+func (x *SyncIncomingResponse) GetTombstones() []*Tombstone {
+	if x != nil {
+		return x.Tombstones
+	}
+	return nil
+}
+
+func (x *SyncIncomingResponse) GetSnapshot() *SnapshotPage {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (x *SyncIncomingResponse) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *SyncIncomingResponse) GetHasMore() bool {
+	if x != nil {
+		return x.HasMore
+	}
+	return false
+}
+
+func (x *SyncIncomingResponse) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+func (x *SyncIncomingResponse) GetCompressed() bool {
+	if x != nil {
+		return x.Compressed
+	}
+	return false
+}
+
+func (x *SyncIncomingResponse) GetSyncTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SyncTimestamp
+	}
+	return nil
+}
+
+func (x *SyncIncomingResponse) GetHlc() string {
+	if x != nil {
+		return x.Hlc
+	}
+	return ""
+}
+
+// POST /api/sync/outgoing request body
+type SyncOutgoingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*Message             `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	Compressed    bool                   `protobuf:"varint,2,opt,name=compressed,proto3" json:"compressed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncOutgoingRequest) Reset() {
+	*x = SyncOutgoingRequest{}
+	mi := &file_sync_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncOutgoingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncOutgoingRequest) ProtoMessage() {}
+
+func (x *SyncOutgoingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncOutgoingRequest.ProtoReflect.Descriptor instead.
+func (*SyncOutgoingRequest) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SyncOutgoingRequest) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *SyncOutgoingRequest) GetCompressed() bool {
+	if x != nil {
+		return x.Compressed
+	}
+	return false
+}
+
+// POST /api/sync/outgoing response
+type SyncOutgoingResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SyncedCount    int64                  `protobuf:"varint,1,opt,name=synced_count,json=syncedCount,proto3" json:"synced_count,omitempty"`
+	FailedCount    int64                  `protobuf:"varint,2,opt,name=failed_count,json=failedCount,proto3" json:"failed_count,omitempty"`
+	Results        []*MessageUploadResult `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	FailedMessages []*FailedMessage       `protobuf:"bytes,4,rep,name=failed_messages,json=failedMessages,proto3" json:"failed_messages,omitempty"`
+	SyncTimestamp  *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=sync_timestamp,json=syncTimestamp,proto3" json:"sync_timestamp,omitempty"`
+	Hlc            string                 `protobuf:"bytes,6,opt,name=hlc,proto3" json:"hlc,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SyncOutgoingResponse) Reset() {
+	*x = SyncOutgoingResponse{}
+	mi := &file_sync_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncOutgoingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncOutgoingResponse) ProtoMessage() {}
+
+func (x *SyncOutgoingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncOutgoingResponse.ProtoReflect.Descriptor instead.
+func (*SyncOutgoingResponse) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SyncOutgoingResponse) GetSyncedCount() int64 {
+	if x != nil {
+		return x.SyncedCount
+	}
+	return 0
+}
+
+func (x *SyncOutgoingResponse) GetFailedCount() int64 {
+	if x != nil {
+		return x.FailedCount
+	}
+	return 0
+}
+
+func (x *SyncOutgoingResponse) GetResults() []*MessageUploadResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *SyncOutgoingResponse) GetFailedMessages() []*FailedMessage {
+	if x != nil {
+		return x.FailedMessages
+	}
+	return nil
+}
+
+func (x *SyncOutgoingResponse) GetSyncTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SyncTimestamp
+	}
+	return nil
+}
+
+func (x *SyncOutgoingResponse) GetHlc() string {
+	if x != nil {
+		return x.Hlc
+	}
+	return ""
+}
+
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SenderId      string                 `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	RecipientId   string                 `protobuf:"bytes,3,opt,name=recipient_id,json=recipientId,proto3" json:"recipient_id,omitempty"`
+	Content       string                 `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	Status        string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	SyncedAt      *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=synced_at,json=syncedAt,proto3" json:"synced_at,omitempty"`
+	ReadAt        *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=read_at,json=readAt,proto3" json:"read_at,omitempty"`
+	Hlc           string                 `protobuf:"bytes,10,opt,name=hlc,proto3" json:"hlc,omitempty"`
+	BaseHlc       string                 `protobuf:"bytes,11,opt,name=base_hlc,json=baseHlc,proto3" json:"base_hlc,omitempty"` // Uploads only
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_sync_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Message) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Message) GetSenderId() string {
+	if x != nil {
+		return x.SenderId
+	}
+	return ""
+}
+
+func (x *Message) GetRecipientId() string {
+	if x != nil {
+		return x.RecipientId
+	}
+	return ""
+}
+
+func (x *Message) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Message) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Message) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Message) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Message) GetSyncedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SyncedAt
+	}
+	return nil
+}
+
+func (x *Message) GetReadAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReadAt
+	}
+	return nil
+}
+
+func (x *Message) GetHlc() string {
+	if x != nil {
+		return x.Hlc
+	}
+	return ""
+}
+
+func (x *Message) GetBaseHlc() string {
+	if x != nil {
+		return x.BaseHlc
+	}
+	return ""
+}
+
+type Record struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Table         string                 `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Operation     string                 `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"` // "INSERT" or "UPDATE"
+	Data          *Struct                `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Hlc           string                 `protobuf:"bytes,5,opt,name=hlc,proto3" json:"hlc,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_sync_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Record) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *Record) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *Record) GetData() *Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Record) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Record) GetHlc() string {
+	if x != nil {
+		return x.Hlc
+	}
+	return ""
+}
+
+type Tombstone struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Table         string                 `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	DeletedAt     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
+	Hlc           string                 `protobuf:"bytes,4,opt,name=hlc,proto3" json:"hlc,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Tombstone) Reset() {
+	*x = Tombstone{}
+	mi := &file_sync_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tombstone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tombstone) ProtoMessage() {}
+
+func (x *Tombstone) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tombstone.ProtoReflect.Descriptor instead.
+func (*Tombstone) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Tombstone) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *Tombstone) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Tombstone) GetDeletedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DeletedAt
+	}
+	return nil
+}
+
+func (x *Tombstone) GetHlc() string {
+	if x != nil {
+		return x.Hlc
+	}
+	return ""
+}
+
+type SnapshotPage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reset_        bool                   `protobuf:"varint,1,opt,name=reset,proto3" json:"reset,omitempty"`
+	Done          bool                   `protobuf:"varint,2,opt,name=done,proto3" json:"done,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotPage) Reset() {
+	*x = SnapshotPage{}
+	mi := &file_sync_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotPage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotPage) ProtoMessage() {}
+
+func (x *SnapshotPage) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotPage.ProtoReflect.Descriptor instead.
+func (*SnapshotPage) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SnapshotPage) GetReset_() bool {
+	if x != nil {
+		return x.Reset_
+	}
+	return false
+}
+
+func (x *SnapshotPage) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+type User struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Id                string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Username          string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	UserType          string                 `protobuf:"bytes,3,opt,name=user_type,json=userType,proto3" json:"user_type,omitempty"`
+	DeviceId          *string                `protobuf:"bytes,4,opt,name=device_id,json=deviceId,proto3,oneof" json:"device_id,omitempty"`
+	OnlineStatus      bool                   `protobuf:"varint,5,opt,name=online_status,json=onlineStatus,proto3" json:"online_status,omitempty"`
+	LastSeen          *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	EnrolledAt        *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=enrolled_at,json=enrolledAt,proto3" json:"enrolled_at,omitempty"`
+	EnrollmentTokenId *string                `protobuf:"bytes,8,opt,name=enrollment_token_id,json=enrollmentTokenId,proto3,oneof" json:"enrollment_token_id,omitempty"`
+	LastMessageSent   *string                `protobuf:"bytes,9,opt,name=last_message_sent,json=lastMessageSent,proto3,oneof" json:"last_message_sent,omitempty"`
+	CreatedAt         *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt         *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_sync_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *User) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *User) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *User) GetUserType() string {
+	if x != nil {
+		return x.UserType
+	}
+	return ""
+}
+
+func (x *User) GetDeviceId() string {
+	if x != nil && x.DeviceId != nil {
+		return *x.DeviceId
+	}
+	return ""
+}
+
+func (x *User) GetOnlineStatus() bool {
+	if x != nil {
+		return x.OnlineStatus
+	}
+	return false
+}
+
+func (x *User) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *User) GetEnrolledAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EnrolledAt
+	}
+	return nil
+}
+
+func (x *User) GetEnrollmentTokenId() string {
+	if x != nil && x.EnrollmentTokenId != nil {
+		return *x.EnrollmentTokenId
+	}
+	return ""
+}
+
+func (x *User) GetLastMessageSent() string {
+	if x != nil && x.LastMessageSent != nil {
+		return *x.LastMessageSent
+	}
+	return ""
+}
+
+func (x *User) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *User) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type MessageUploadResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     string                 `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Outcome       string                 `protobuf:"bytes,2,opt,name=outcome,proto3" json:"outcome,omitempty"` // "created", "updated", "duplicate", "conflict" or "rejected"
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	Resolution    string                 `protobuf:"bytes,4,opt,name=resolution,proto3" json:"resolution,omitempty"`
+	ConflictId    string                 `protobuf:"bytes,5,opt,name=conflict_id,json=conflictId,proto3" json:"conflict_id,omitempty"`
+	Hlc           string                 `protobuf:"bytes,6,opt,name=hlc,proto3" json:"hlc,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageUploadResult) Reset() {
+	*x = MessageUploadResult{}
+	mi := &file_sync_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageUploadResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageUploadResult) ProtoMessage() {}
+
+func (x *MessageUploadResult) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageUploadResult.ProtoReflect.Descriptor instead.
+func (*MessageUploadResult) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *MessageUploadResult) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *MessageUploadResult) GetOutcome() string {
+	if x != nil {
+		return x.Outcome
+	}
+	return ""
+}
+
+func (x *MessageUploadResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *MessageUploadResult) GetResolution() string {
+	if x != nil {
+		return x.Resolution
+	}
+	return ""
+}
+
+func (x *MessageUploadResult) GetConflictId() string {
+	if x != nil {
+		return x.ConflictId
+	}
+	return ""
+}
+
+func (x *MessageUploadResult) GetHlc() string {
+	if x != nil {
+		return x.Hlc
+	}
+	return ""
+}
+
+type FailedMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     string                 `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailedMessage) Reset() {
+	*x = FailedMessage{}
+	mi := &file_sync_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailedMessage) ProtoMessage() {}
+
+func (x *FailedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailedMessage.ProtoReflect.Descriptor instead.
+func (*FailedMessage) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *FailedMessage) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *FailedMessage) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Struct, ListValue and Value hold the row data of a Record, as
+// google.protobuf.Struct does, except that numbers are kept in their exact
+// decimal form: synced numeric columns may not fit a double.
+type Struct struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Fields        map[string]*Value      `protobuf:"bytes,1,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Struct) Reset() {
+	*x = Struct{}
+	mi := &file_sync_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Struct) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Struct) ProtoMessage() {}
+
+func (x *Struct) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Struct.ProtoReflect.Descriptor instead.
+func (*Struct) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Struct) GetFields() map[string]*Value {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type ListValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []*Value               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListValue) Reset() {
+	*x = ListValue{}
+	mi := &file_sync_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListValue) ProtoMessage() {}
+
+func (x *ListValue) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListValue.ProtoReflect.Descriptor instead.
+func (*ListValue) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListValue) GetValues() []*Value {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type Value struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Kind:
+	//
+	//	*Value_NullValue
+	//	*Value_NumberValue
+	//	*Value_StringValue
+	//	*Value_BoolValue
+	//	*Value_StructValue
+	//	*Value_ListValue
+	Kind          isValue_Kind `protobuf_oneof:"kind"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Value) Reset() {
+	*x = Value{}
+	mi := &file_sync_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Value) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Value) ProtoMessage() {}
+
+func (x *Value) ProtoReflect() protoreflect.Message {
+	mi := &file_sync_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Value.ProtoReflect.Descriptor instead.
+func (*Value) Descriptor() ([]byte, []int) {
+	return file_sync_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Value) GetKind() isValue_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return nil
+}
+
+func (x *Value) GetNullValue() NullValue {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_NullValue); ok {
+			return x.NullValue
+		}
+	}
+	return NullValue_NULL_VALUE
+}
+
+func (x *Value) GetNumberValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_NumberValue); ok {
+			return x.NumberValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetStringValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_StringValue); ok {
+			return x.StringValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetBoolValue() bool {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_BoolValue); ok {
+			return x.BoolValue
+		}
+	}
+	return false
+}
+
+func (x *Value) GetStructValue() *Struct {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_StructValue); ok {
+			return x.StructValue
+		}
+	}
+	return nil
+}
+
+func (x *Value) GetListValue() *ListValue {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_ListValue); ok {
+			return x.ListValue
+		}
+	}
+	return nil
+}
+
+type isValue_Kind interface {
+	isValue_Kind()
+}
+
+type Value_NullValue struct {
+	NullValue NullValue `protobuf:"varint,1,opt,name=null_value,json=nullValue,proto3,enum=posduif.sync.v1.NullValue,oneof"`
+}
+
+type Value_NumberValue struct {
+	NumberValue string `protobuf:"bytes,2,opt,name=number_value,json=numberValue,proto3,oneof"`
+}
+
+type Value_StringValue struct {
+	StringValue string `protobuf:"bytes,3,opt,name=string_value,json=stringValue,proto3,oneof"`
+}
+
+type Value_BoolValue struct {
+	BoolValue bool `protobuf:"varint,4,opt,name=bool_value,json=boolValue,proto3,oneof"`
+}
+
+type Value_StructValue struct {
+	StructValue *Struct `protobuf:"bytes,5,opt,name=struct_value,json=structValue,proto3,oneof"`
+}
+
+type Value_ListValue struct {
+	ListValue *ListValue `protobuf:"bytes,6,opt,name=list_value,json=listValue,proto3,oneof"`
+}
+
+func (*Value_NullValue) isValue_Kind() {}
+
+func (*Value_NumberValue) isValue_Kind() {}
+
+func (*Value_StringValue) isValue_Kind() {}
+
+func (*Value_BoolValue) isValue_Kind() {}
+
+func (*Value_StructValue) isValue_Kind() {}
+
+func (*Value_ListValue) isValue_Kind() {}
+
+var File_sync_proto protoreflect.FileDescriptor
+
+const file_sync_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"sync.proto\x12\x0fposduif.sync.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xcb\x03\n" +
+	"\x14SyncIncomingResponse\x124\n" +
+	"\bmessages\x18\x01 \x03(\v2\x18.posduif.sync.v1.MessageR\bmessages\x121\n" +
+	"\arecords\x18\x02 \x03(\v2\x17.posduif.sync.v1.RecordR\arecords\x12:\n" +
+	"\n" +
+	"tombstones\x18\x03 \x03(\v2\x1a.posduif.sync.v1.TombstoneR\n" +
+	"tombstones\x129\n" +
+	"\bsnapshot\x18\x04 \x01(\v2\x1d.posduif.sync.v1.SnapshotPageR\bsnapshot\x12\x16\n" +
+	"\x06cursor\x18\x05 \x01(\tR\x06cursor\x12\x19\n" +
+	"\bhas_more\x18\x06 \x01(\bR\ahasMore\x12+\n" +
+	"\x05users\x18\a \x03(\v2\x15.posduif.sync.v1.UserR\x05users\x12\x1e\n" +
+	"\n" +
+	"compressed\x18\b \x01(\bR\n" +
+	"compressed\x12A\n" +
+	"\x0esync_timestamp\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\rsyncTimestamp\x12\x10\n" +
+	"\x03hlc\x18\n" +
+	" \x01(\tR\x03hlc\"k\n" +
+	"\x13SyncOutgoingRequest\x124\n" +
+	"\bmessages\x18\x01 \x03(\v2\x18.posduif.sync.v1.MessageR\bmessages\x12\x1e\n" +
+	"\n" +
+	"compressed\x18\x02 \x01(\bR\n" +
+	"compressed\"\xba\x02\n" +
+	"\x14SyncOutgoingResponse\x12!\n" +
+	"\fsynced_count\x18\x01 \x01(\x03R\vsyncedCount\x12!\n" +
+	"\ffailed_count\x18\x02 \x01(\x03R\vfailedCount\x12>\n" +
+	"\aresults\x18\x03 \x03(\v2$.posduif.sync.v1.MessageUploadResultR\aresults\x12G\n" +
+	"\x0ffailed_messages\x18\x04 \x03(\v2\x1e.posduif.sync.v1.FailedMessageR\x0efailedMessages\x12A\n" +
+	"\x0esync_timestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\rsyncTimestamp\x12\x10\n" +
+	"\x03hlc\x18\x06 \x01(\tR\x03hlc\"\x9c\x03\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tsender_id\x18\x02 \x01(\tR\bsenderId\x12!\n" +
+	"\frecipient_id\x18\x03 \x01(\tR\vrecipientId\x12\x18\n" +
+	"\acontent\x18\x04 \x01(\tR\acontent\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x127\n" +
+	"\tsynced_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\bsyncedAt\x123\n" +
+	"\aread_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\x06readAt\x12\x10\n" +
+	"\x03hlc\x18\n" +
+	" \x01(\tR\x03hlc\x12\x19\n" +
+	"\bbase_hlc\x18\v \x01(\tR\abaseHlc\"\xb6\x01\n" +
+	"\x06Record\x12\x14\n" +
+	"\x05table\x18\x01 \x01(\tR\x05table\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x12+\n" +
+	"\x04data\x18\x03 \x01(\v2\x17.posduif.sync.v1.StructR\x04data\x129\n" +
+	"\n" +
+	"updated_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x10\n" +
+	"\x03hlc\x18\x05 \x01(\tR\x03hlc\"~\n" +
+	"\tTombstone\x12\x14\n" +
+	"\x05table\x18\x01 \x01(\tR\x05table\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x129\n" +
+	"\n" +
+	"deleted_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tdeletedAt\x12\x10\n" +
+	"\x03hlc\x18\x04 \x01(\tR\x03hlc\"8\n" +
+	"\fSnapshotPage\x12\x14\n" +
+	"\x05reset\x18\x01 \x01(\bR\x05reset\x12\x12\n" +
+	"\x04done\x18\x02 \x01(\bR\x04done\"\xa4\x04\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x1b\n" +
+	"\tuser_type\x18\x03 \x01(\tR\buserType\x12 \n" +
+	"\tdevice_id\x18\x04 \x01(\tH\x00R\bdeviceId\x88\x01\x01\x12#\n" +
+	"\ronline_status\x18\x05 \x01(\bR\fonlineStatus\x127\n" +
+	"\tlast_seen\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\blastSeen\x12;\n" +
+	"\venrolled_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"enrolledAt\x123\n" +
+	"\x13enrollment_token_id\x18\b \x01(\tH\x01R\x11enrollmentTokenId\x88\x01\x01\x12/\n" +
+	"\x11last_message_sent\x18\t \x01(\tH\x02R\x0flastMessageSent\x88\x01\x01\x129\n" +
+	"\n" +
+	"created_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAtB\f\n" +
+	"\n" +
+	"_device_idB\x16\n" +
+	"\x14_enrollment_token_idB\x14\n" +
+	"\x12_last_message_sent\"\xb9\x01\n" +
+	"\x13MessageUploadResult\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\tR\tmessageId\x12\x18\n" +
+	"\aoutcome\x18\x02 \x01(\tR\aoutcome\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x1e\n" +
+	"\n" +
+	"resolution\x18\x04 \x01(\tR\n" +
+	"resolution\x12\x1f\n" +
+	"\vconflict_id\x18\x05 \x01(\tR\n" +
+	"conflictId\x12\x10\n" +
+	"\x03hlc\x18\x06 \x01(\tR\x03hlc\"D\n" +
+	"\rFailedMessage\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\tR\tmessageId\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x98\x01\n" +
+	"\x06Struct\x12;\n" +
+	"\x06fields\x18\x01 \x03(\v2#.posduif.sync.v1.Struct.FieldsEntryR\x06fields\x1aQ\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12,\n" +
+	"\x05value\x18\x02 \x01(\v2\x16.posduif.sync.v1.ValueR\x05value:\x028\x01\";\n" +
+	"\tListValue\x12.\n" +
+	"\x06values\x18\x01 \x03(\v2\x16.posduif.sync.v1.ValueR\x06values\"\xb2\x02\n" +
+	"\x05Value\x12;\n" +
+	"\n" +
+	"null_value\x18\x01 \x01(\x0e2\x1a.posduif.sync.v1.NullValueH\x00R\tnullValue\x12#\n" +
+	"\fnumber_value\x18\x02 \x01(\tH\x00R\vnumberValue\x12#\n" +
+	"\fstring_value\x18\x03 \x01(\tH\x00R\vstringValue\x12\x1f\n" +
+	"\n" +
+	"bool_value\x18\x04 \x01(\bH\x00R\tboolValue\x12<\n" +
+	"\fstruct_value\x18\x05 \x01(\v2\x17.posduif.sync.v1.StructH\x00R\vstructValue\x12;\n" +
+	"\n" +
+	"list_value\x18\x06 \x01(\v2\x1a.posduif.sync.v1.ListValueH\x00R\tlistValueB\x06\n" +
+	"\x04kind*\x1b\n" +
+	"\tNullValue\x12\x0e\n" +
+	"\n" +
+	"NULL_VALUE\x10\x00B.Z,posduif/sync-engine/internal/protocol/syncpbb\x06proto3"
+
+var (
+	file_sync_proto_rawDescOnce sync.Once
+	file_sync_proto_rawDescData []byte
+)
+
+func file_sync_proto_rawDescGZIP() []byte {
+	file_sync_proto_rawDescOnce.Do(func() {
+		file_sync_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sync_proto_rawDesc), len(file_sync_proto_rawDesc)))
+	})
+	return file_sync_proto_rawDescData
+}
+
+var file_sync_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_sync_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_sync_proto_goTypes = []any{
+	(NullValue)(0),                // 0: posduif.sync.v1.NullValue
+	(*SyncIncomingResponse)(nil),  // 1: posduif.sync.v1.SyncIncomingResponse
+	(*SyncOutgoingRequest)(nil),   // 2: posduif.sync.v1.SyncOutgoingRequest
+	(*SyncOutgoingResponse)(nil),  // 3: posduif.sync.v1.SyncOutgoingResponse
+	(*Message)(nil),               // 4: posduif.sync.v1.Message
+	(*Record)(nil),                // 5: posduif.sync.v1.Record
+	(*Tombstone)(nil),             // 6: posduif.sync.v1.Tombstone
+	(*SnapshotPage)(nil),          // 7: posduif.sync.v1.SnapshotPage
+	(*User)(nil),                  // 8: posduif.sync.v1.User
+	(*MessageUploadResult)(nil),   // 9: posduif.sync.v1.MessageUploadResult
+	(*FailedMessage)(nil),         // 10: posduif.sync.v1.FailedMessage
+	(*Struct)(nil),                // 11: posduif.sync.v1.Struct
+	(*ListValue)(nil),             // 12: posduif.sync.v1.ListValue
+	(*Value)(nil),                 // 13: posduif.sync.v1.Value
+	nil,                           // 14: posduif.sync.v1.Struct.FieldsEntry
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_sync_proto_depIdxs = []int32{
+	4,  // 0: posduif.sync.v1.SyncIncomingResponse.messages:type_name -> posduif.sync.v1.Message
+	5,  // 1: posduif.sync.v1.SyncIncomingResponse.records:type_name -> posduif.sync.v1.Record
+	6,  // 2: posduif.sync.v1.SyncIncomingResponse.tombstones:type_name -> posduif.sync.v1.Tombstone
+	7,  // 3: posduif.sync.v1.SyncIncomingResponse.snapshot:type_name -> posduif.sync.v1.SnapshotPage
+	8,  // 4: posduif.sync.v1.SyncIncomingResponse.users:type_name -> posduif.sync.v1.User
+	15, // 5: posduif.sync.v1.SyncIncomingResponse.sync_timestamp:type_name -> google.protobuf.Timestamp
+	4,  // 6: posduif.sync.v1.SyncOutgoingRequest.messages:type_name -> posduif.sync.v1.Message
+	9,  // 7: posduif.sync.v1.SyncOutgoingResponse.results:type_name -> posduif.sync.v1.MessageUploadResult
+	10, // 8: posduif.sync.v1.SyncOutgoingResponse.failed_messages:type_name -> posduif.sync.v1.FailedMessage
+	15, // 9: posduif.sync.v1.SyncOutgoingResponse.sync_timestamp:type_name -> google.protobuf.Timestamp
+	15, // 10: posduif.sync.v1.Message.created_at:type_name -> google.protobuf.Timestamp
+	15, // 11: posduif.sync.v1.Message.updated_at:type_name -> google.protobuf.Timestamp
+	15, // 12: posduif.sync.v1.Message.synced_at:type_name -> google.protobuf.Timestamp
+	15, // 13: posduif.sync.v1.Message.read_at:type_name -> google.protobuf.Timestamp
+	11, // 14: posduif.sync.v1.Record.data:type_name -> posduif.sync.v1.Struct
+	15, // 15: posduif.sync.v1.Record.updated_at:type_name -> google.protobuf.Timestamp
+	15, // 16: posduif.sync.v1.Tombstone.deleted_at:type_name -> google.protobuf.Timestamp
+	15, // 17: posduif.sync.v1.User.last_seen:type_name -> google.protobuf.Timestamp
+	15, // 18: posduif.sync.v1.User.enrolled_at:type_name -> google.protobuf.Timestamp
+	15, // 19: posduif.sync.v1.User.created_at:type_name -> google.protobuf.Timestamp
+	15, // 20: posduif.sync.v1.User.updated_at:type_name -> google.protobuf.Timestamp
+	14, // 21: posduif.sync.v1.Struct.fields:type_name -> posduif.sync.v1.Struct.FieldsEntry
+	13, // 22: posduif.sync.v1.ListValue.values:type_name -> posduif.sync.v1.Value
+	0,  // 23: posduif.sync.v1.Value.null_value:type_name -> posduif.sync.v1.NullValue
+	11, // 24: posduif.sync.v1.Value.struct_value:type_name -> posduif.sync.v1.Struct
+	12, // 25: posduif.sync.v1.Value.list_value:type_name -> posduif.sync.v1.ListValue
+	13, // 26: posduif.sync.v1.Struct.FieldsEntry.value:type_name -> posduif.sync.v1.Value
+	27, // [27:27] is the sub-list for method output_type
+	27, // [27:27] is the sub-list for method input_type
+	27, // [27:27] is the sub-list for extension type_name
+	27, // [27:27] is the sub-list for extension extendee
+	0,  // [0:27] is the sub-list for field type_name
+}
+
+func init() { file_sync_proto_init() }
+func file_sync_proto_init() {
+	if File_sync_proto != nil {
+		return
+	}
+	file_sync_proto_msgTypes[7].OneofWrappers = []any{}
+	file_sync_proto_msgTypes[12].OneofWrappers = []any{
+		(*Value_NullValue)(nil),
+		(*Value_NumberValue)(nil),
+		(*Value_StringValue)(nil),
+		(*Value_BoolValue)(nil),
+		(*Value_StructValue)(nil),
+		(*Value_ListValue)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sync_proto_rawDesc), len(file_sync_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_sync_proto_goTypes,
+		DependencyIndexes: file_sync_proto_depIdxs,
+		EnumInfos:         file_sync_proto_enumTypes,
+		MessageInfos:      file_sync_proto_msgTypes,
+	}.Build()
+	File_sync_proto = out.File
+	file_sync_proto_goTypes = nil
+	file_sync_proto_depIdxs = nil
+}
@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/models"
+)
+
+// ChangeBus announces queued changes to every sync-engine replica over Redis
+// pub/sub. Notifications are best effort: the changes themselves are durable in
+// the device change queues, so a missed notification only delays a push.
+type ChangeBus struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewChangeBus creates a change bus on the configured channel
+func NewChangeBus(client *redis.Client, cfg *config.Config) *ChangeBus {
+	return &ChangeBus{
+		client:  client,
+		channel: cfg.Redis.ChangesChannel,
+	}
+}
+
+// PublishChanges announces a queued transaction to all replicas
+func (b *ChangeBus) PublishChanges(ctx context.Context, notification *models.ChangeNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal change notification: %w", err)
+	}
+
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+// Subscribe calls handle for every change notification until ctx is cancelled.
+// The subscription reconnects on its own after connection failures.
+func (b *ChangeBus) Subscribe(ctx context.Context, handle func(*models.ChangeNotification)) {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var notification models.ChangeNotification
+			if err := json.Unmarshal([]byte(msg.Payload), &notification); err != nil {
+				log.Printf("Ignoring malformed change notification: %v", err)
+				continue
+			}
+			handle(&notification)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+)
+
+// Change source names accepted by sync.change_source
+const (
+	ChangeSourceWAL     = "wal"
+	ChangeSourceNotify  = "notify"
+	ChangeSourcePolling = "polling"
+)
+
+// ChangeSource detects server-side changes and hands out the incoming
+// messages for each device. Manager consumes exactly one source per tenant.
+type ChangeSource interface {
+	// Name returns the configured source name
+	Name() string
+	// Start begins capturing changes in the background
+	Start(ctx context.Context) error
+	// Stop stops capturing changes
+	Stop()
+	// IncomingChanges returns the next page of changes pending for a device with
+	// the cursor that acknowledges it, even when the page is empty. It does not
+	// change any state, so until the page is acknowledged the same changes are
+	// returned again.
+	IncomingChanges(ctx context.Context, deviceID string, limit int) (*models.IncomingChanges, error)
+	// Acknowledge records the page identified by cursor as applied by the device.
+	// Acknowledging a page again has no effect; a cursor behind the device's
+	// acknowledged position returns ErrStaleCursor.
+	Acknowledge(ctx context.Context, deviceID string, cursor string) error
+}
+
+// trackedIncoming serves incoming messages from a ChangeTracker fed by a
+// streaming source. Acknowledgements advance the device's last_synced_lsn.
+// Devices that need a full resync are served their snapshot first.
+type trackedIncoming struct {
+	db            *database.DB
+	changeTracker *ChangeTracker
+	snapshots     *SnapshotManager
+}
+
+// IncomingChanges converts the device's tracked changes to messages, records and tombstones
+func (t *trackedIncoming) IncomingChanges(ctx context.Context, deviceID string, limit int) (*models.IncomingChanges, error) {
+	sm, err := t.db.GetSyncMetadata(ctx, deviceID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get sync metadata: %w", err)
+	}
+	if sm == nil || sm.NeedsFullResync {
+		return t.snapshots.NextPage(ctx, deviceID, sm, limit)
+	}
+
+	// Get tracked changes for this device
+	changes, err := t.changeTracker.GetChangesForDevice(ctx, deviceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracked changes: %w", err)
+	}
+
+	// An empty page is acknowledged at the device's current position
+	maxLSN, err := lastSyncedLSN(sm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert changes to messages or records, and deletes to tombstones
+	incoming := &models.IncomingChanges{Messages: make([]models.Message, 0, len(changes))}
+
+	for _, change := range changes {
+		// Changes that cannot be converted are acknowledged with the page
+		if change.LSN > maxLSN {
+			maxLSN = change.LSN
+		}
+
+		if change.Operation == "DELETE" {
+			tombstone, err := ConvertWALChangeToTombstone(change)
+			if err != nil {
+				// Skip invalid changes
+				continue
+			}
+			incoming.Tombstones = append(incoming.Tombstones, *tombstone)
+		} else if change.Table == "messages" {
+			msg, err := ConvertWALChangeToMessage(change)
+			if err != nil {
+				// Skip invalid changes
+				continue
+			}
+			incoming.Messages = append(incoming.Messages, *msg)
+		} else {
+			record, err := ConvertWALChangeToRecord(change)
+			if err != nil {
+				// Skip invalid changes
+				continue
+			}
+			incoming.Records = append(incoming.Records, *record)
+		}
+	}
+
+	incoming.Cursor = (&incomingCursor{Kind: cursorChanges, LSN: maxLSN}).String()
+	if incoming.HasMore, err = t.db.HasQueuedChanges(ctx, deviceID, maxLSN); err != nil {
+		return nil, fmt.Errorf("failed to check for queued changes: %w", err)
+	}
+
+	return incoming, nil
+}
+
+// Acknowledge advances the device's last_synced_lsn to the cursor's LSN and
+// clears the acknowledged changes, or moves its snapshot on to the next page.
+// Acknowledging a page again has no effect.
+func (t *trackedIncoming) Acknowledge(ctx context.Context, deviceID string, cursor string) error {
+	c, err := parseIncomingCursor(cursor)
+	if err != nil {
+		return err
+	}
+
+	switch c.Kind {
+	case cursorSnapshot:
+		return t.snapshots.Acknowledge(ctx, deviceID, c)
+	case cursorChanges:
+		advanced, err := t.db.AcknowledgeChanges(ctx, deviceID, c.LSN)
+		if err != nil {
+			return fmt.Errorf("failed to acknowledge changes: %w", err)
+		}
+		if advanced {
+			return nil
+		}
+		return t.acknowledgedBefore(ctx, deviceID, c)
+	}
+	return ErrInvalidCursor
+}
+
+// acknowledgedBefore accepts a changes cursor at the device's current position
+// and rejects one behind it, or one issued before a full resync was requested
+func (t *trackedIncoming) acknowledgedBefore(ctx context.Context, deviceID string, cursor *incomingCursor) error {
+	sm, err := t.db.GetSyncMetadata(ctx, deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrStaleCursor
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get sync metadata: %w", err)
+	}
+	if sm.NeedsFullResync {
+		return ErrStaleCursor
+	}
+
+	lsn, err := lastSyncedLSN(sm)
+	if err != nil {
+		return err
+	}
+	if lsn > cursor.LSN {
+		return ErrStaleCursor
+	}
+	return nil
+}
+
+// lastSyncedLSN returns the position up to which a device has acknowledged its changes
+func lastSyncedLSN(sm *models.SyncMetadata) (models.LSN, error) {
+	if sm.LastSyncedLSN == nil || *sm.LastSyncedLSN == "" {
+		return 0, nil
+	}
+	lsn, err := models.ParseLSN(*sm.LastSyncedLSN)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last synced LSN: %w", err)
+	}
+	return lsn, nil
+}
+
+// WALChangeSource detects changes with PostgreSQL logical replication
+type WALChangeSource struct {
+	trackedIncoming
+	service *WALService
+}
+
+// NewWALChangeSource creates a change source backed by a WAL service
+func NewWALChangeSource(db *database.DB, changeTracker *ChangeTracker, snapshots *SnapshotManager, service *WALService) *WALChangeSource {
+	return &WALChangeSource{
+		trackedIncoming: trackedIncoming{db: db, changeTracker: changeTracker, snapshots: snapshots},
+		service:         service,
+	}
+}
+
+func (s *WALChangeSource) Name() string {
+	return ChangeSourceWAL
+}
+
+func (s *WALChangeSource) Start(ctx context.Context) error {
+	return s.service.Start(ctx)
+}
+
+func (s *WALChangeSource) Stop() {
+	s.service.Stop()
+}
+
+// PollingChangeSource finds incoming messages by querying their sync status.
+// It needs no replication or trigger privileges.
+type PollingChangeSource struct {
+	db *database.DB
+}
+
+// NewPollingChangeSource creates a status polling change source
+func NewPollingChangeSource(db *database.DB) *PollingChangeSource {
+	return &PollingChangeSource{db: db}
+}
+
+func (s *PollingChangeSource) Name() string {
+	return ChangeSourcePolling
+}
+
+func (s *PollingChangeSource) Start(ctx context.Context) error {
+	return nil
+}
+
+func (s *PollingChangeSource) Stop() {}
+
+// IncomingChanges returns pending messages; they stay pending until acknowledged.
+// Deleted rows cannot be seen by polling, so no tombstones are returned.
+func (s *PollingChangeSource) IncomingChanges(ctx context.Context, deviceID string, limit int) (*models.IncomingChanges, error) {
+	// One extra message tells whether another page follows
+	messages, err := s.db.GetPendingMessagesForDevice(ctx, deviceID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending messages: %w", err)
+	}
+
+	incoming := &models.IncomingChanges{Messages: messages}
+	if len(messages) > limit {
+		incoming.Messages = messages[:limit]
+		incoming.HasMore = true
+	}
+
+	// The page ends at its last message in (hlc, id) order
+	cursor := &incomingCursor{Kind: cursorMessages}
+	if n := len(incoming.Messages); n > 0 {
+		last := incoming.Messages[n-1]
+		cursor.HLC, cursor.After = last.HLC, &last.ID
+		for _, msg := range incoming.Messages {
+			if msg.UpdatedAt.After(cursor.UpdatedAt) {
+				cursor.UpdatedAt = msg.UpdatedAt
+			}
+		}
+	}
+	incoming.Cursor = cursor.String()
+	return incoming, nil
+}
+
+// Acknowledge marks the pending messages up to the end of the page synced.
+// Messages written after the page was read are left pending, even if their
+// device-assigned hlc sorts before the page's end.
+func (s *PollingChangeSource) Acknowledge(ctx context.Context, deviceID string, cursor string) error {
+	c, err := parseIncomingCursor(cursor)
+	if err != nil {
+		return err
+	}
+	if c.Kind != cursorMessages {
+		return ErrInvalidCursor
+	}
+	if c.After == nil {
+		return nil
+	}
+
+	if _, err := s.db.MarkMessagesSynced(ctx, deviceID, c.HLC, *c.After, c.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to mark messages synced: %w", err)
+	}
+	return nil
+}
@@ -2,143 +2,311 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/config"
 	"posduif/sync-engine/internal/database"
 	"posduif/sync-engine/internal/models"
 )
 
-// ChangeTracker tracks WAL changes per device and filters them by recipient
+// ChangeNotifier announces queued transactions to every sync-engine replica
+type ChangeNotifier interface {
+	PublishChanges(ctx context.Context, notification *models.ChangeNotification) error
+}
+
+// deviceDirectory resolves the users and devices a change is routed to
+type deviceDirectory interface {
+	GetDeviceIDsForUser(ctx context.Context, userID string) ([]string, error)
+	GetUserIDsByQuery(ctx context.Context, query string, key string) ([]string, error)
+	GetEnrolledDeviceIDs(ctx context.Context) ([]string, error)
+}
+
+// ChangeTracker routes changes to devices and keeps them in durable per-device
+// queues until each device has synced them
 type ChangeTracker struct {
-	db          *database.DB
-	changes     map[string][]*WALChange // deviceID -> changes
-	changesLock sync.RWMutex
+	db           *database.DB
+	directory    deviceDirectory // db, except in tests
+	rules        *SyncRules
+	notifier     ChangeNotifier
+	maxPerDevice int
+	maxAge       time.Duration
+
+	keysLock    sync.Mutex
+	primaryKeys map[string][]string // "schema.table" -> primary key columns
 }
 
-// NewChangeTracker creates a new change tracker
-func NewChangeTracker(db *database.DB) *ChangeTracker {
+// NewChangeTracker creates a new change tracker. notifier may be nil.
+func NewChangeTracker(db *database.DB, rules *SyncRules, cfg *config.QueueConfig, notifier ChangeNotifier) *ChangeTracker {
+	maxAge, err := time.ParseDuration(cfg.MaxAge)
+	if err != nil || maxAge <= 0 {
+		maxAge = 168 * time.Hour
+	}
+
 	return &ChangeTracker{
-		db:      db,
-		changes: make(map[string][]*WALChange),
+		db:           db,
+		directory:    db,
+		rules:        rules,
+		notifier:     notifier,
+		maxPerDevice: cfg.MaxChangesPerDevice,
+		maxAge:       maxAge,
+		primaryKeys:  make(map[string][]string),
 	}
 }
 
-// AddChange adds a WAL change to the tracker, filtering by recipient
-// and excluding sender devices to prevent sync loops
+// AddChange adds a single WAL change to the tracker
 func (ct *ChangeTracker) AddChange(ctx context.Context, change *WALChange) error {
-	// Only process changes for the messages table
-	if change.Table != "messages" {
-		return nil
+	return ct.AddTransaction(ctx, []*WALChange{change})
+}
+
+// AddTransaction adds the changes of one committed transaction to the tracker
+func (ct *ChangeTracker) AddTransaction(ctx context.Context, changes []*WALChange) error {
+	return ct.AddTransactionBatches(ctx, &Transaction{changes: changes})
+}
+
+// AddTransactionBatches adds a committed transaction to the tracker, reading
+// its changes one batch at a time. Each batch is routed and then queued, and
+// all batches are queued in a single database transaction, so a concurrent
+// GetChangesForDevice never observes part of a transaction.
+func (ct *ChangeTracker) AddTransactionBatches(ctx context.Context, txn *Transaction) error {
+	var queue *database.ChangeQueueWriter
+	defer func() {
+		if queue != nil {
+			queue.Rollback(context.Background())
+		}
+	}()
+
+	var summary []models.QueuedChange // First change of each device and table, for the notification
+	summarized := make(map[[2]string]bool)
+	position := 0
+	for {
+		changes, err := txn.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read transaction: %w", err)
+		}
+		if len(changes) == 0 {
+			break
+		}
+
+		queued, err := ct.routeChanges(ctx, changes, &position)
+		if err != nil {
+			return err
+		}
+		if len(queued) == 0 {
+			continue
+		}
+
+		if queue == nil {
+			if queue, err = ct.db.BeginEnqueue(ctx); err != nil {
+				return fmt.Errorf("failed to queue changes: %w", err)
+			}
+		}
+		if err := queue.Enqueue(ctx, queued); err != nil {
+			return fmt.Errorf("failed to queue changes: %w", err)
+		}
+		for _, change := range queued {
+			if key := [2]string{change.DeviceID, change.Table}; !summarized[key] {
+				summarized[key] = true
+				summary = append(summary, models.QueuedChange{DeviceID: change.DeviceID, LSN: change.LSN, Table: change.Table})
+			}
+		}
 	}
 
-	// Only process INSERT and UPDATE operations
-	if change.Operation != "INSERT" && change.Operation != "UPDATE" {
+	if queue == nil {
 		return nil
 	}
 
-	// Extract recipient_id from the change columns
-	recipientID, ok := change.Columns["recipient_id"]
-	if !ok {
-		// For UPDATE operations, check old columns if new columns don't have it
-		if change.Operation == "UPDATE" {
-			recipientID, ok = change.OldColumns["recipient_id"]
+	overflowed, err := queue.Commit(ctx, ct.maxPerDevice, ct.maxAge)
+	if err != nil {
+		return fmt.Errorf("failed to queue changes: %w", err)
+	}
+	for _, deviceID := range overflowed {
+		log.Printf("Change queue for device %s exceeded its retention limits, device marked for full resync", deviceID)
+	}
+
+	if ct.notifier != nil {
+		// The queue is the source of truth, so a lost notification only delays a push
+		if err := ct.notifier.PublishChanges(ctx, newChangeNotification(summary)); err != nil {
+			log.Printf("Failed to publish change notification: %v", err)
 		}
-		if !ok {
-			return nil // No recipient_id, skip
+	}
+
+	return nil
+}
+
+// routeChanges routes a batch of changes and returns them queued for each
+// target device. position holds the position of the batch's first change in
+// the transaction. A change is queued at its position for every device, so a
+// replayed transaction queues each change at the same position again, even if
+// it is routed differently.
+func (ct *ChangeTracker) routeChanges(ctx context.Context, changes []*WALChange, position *int) ([]models.QueuedChange, error) {
+	var queued []models.QueuedChange
+	for _, change := range changes {
+		seq := *position
+		*position++
+		deviceIDs, err := ct.routeChange(ctx, change)
+		if err != nil {
+			return nil, err
+		}
+		if len(deviceIDs) == 0 {
+			continue
+		}
+		key, err := ct.rowKey(ctx, change)
+		if err != nil {
+			return nil, err
+		}
+		for _, deviceID := range deviceIDs {
+			queued = append(queued, models.QueuedChange{
+				DeviceID:   deviceID,
+				LSN:        change.LSN,
+				Seq:        seq,
+				XID:        change.XID,
+				Schema:     change.Schema,
+				Table:      change.Table,
+				RowKey:     key,
+				Operation:  change.Operation,
+				Columns:    change.Columns,
+				OldColumns: change.OldColumns,
+				CommitTime: change.CommitTime,
+			})
 		}
 	}
+	return queued, nil
+}
 
-	recipientIDStr, ok := recipientID.(string)
-	if !ok {
-		return nil // Invalid recipient_id type
-	}
-
-	// Extract sender_id from the change columns to prevent sync loops
-	// For INSERT: sender_id is in Columns
-	// For UPDATE: check both Columns (new) and OldColumns (old) to handle sender changes
-	var senderIDStr string
-	var oldSenderIDStr string
-	
-	// Get new sender_id (for INSERT and UPDATE)
-	senderID, ok := change.Columns["sender_id"]
-	if ok {
-		if sid, ok := senderID.(string); ok {
-			senderIDStr = sid
-		}
-	}
-	
-	// For UPDATE operations, also get old sender_id to handle sender changes
-	if change.Operation == "UPDATE" {
-		if oldSenderID, ok := change.OldColumns["sender_id"]; ok {
-			if sid, ok := oldSenderID.(string); ok {
-				oldSenderIDStr = sid
-			}
+// RouteDevices returns the devices that any of a transaction's changes are routed to
+func (ct *ChangeTracker) RouteDevices(ctx context.Context, changes []*WALChange) ([]string, error) {
+	var deviceIDs []string
+	for _, change := range changes {
+		devices, err := ct.routeChange(ctx, change)
+		if err != nil {
+			return nil, err
 		}
+		deviceIDs = append(deviceIDs, devices...)
 	}
-	
-	// If no sender_id found in either location, skip this change
-	if senderIDStr == "" && oldSenderIDStr == "" {
-		return nil
+	return uniqueStrings(deviceIDs), nil
+}
+
+// newChangeNotification summarises the devices and tables of a queued transaction
+func newChangeNotification(queued []models.QueuedChange) *models.ChangeNotification {
+	notification := &models.ChangeNotification{LSN: queued[0].LSN.String()}
+	devices := make(map[string]bool)
+	tables := make(map[string]bool)
+	for _, change := range queued {
+		if !devices[change.DeviceID] {
+			devices[change.DeviceID] = true
+			notification.DeviceIDs = append(notification.DeviceIDs, change.DeviceID)
+		}
+		if !tables[change.Table] {
+			tables[change.Table] = true
+			notification.Tables = append(notification.Tables, change.Table)
+		}
+	}
+	return notification
+}
+
+// routeChange returns the devices that should receive a change according to the
+// table's sync rule. Devices of the row's origin users are excluded from inserts
+// and updates to prevent sync loops, but receive deletes like every other target.
+func (ct *ChangeTracker) routeChange(ctx context.Context, change *WALChange) ([]string, error) {
+	rule := ct.rules.Match(change.Schema, change.Table)
+	if rule == nil {
+		return nil, nil
 	}
 
-	// Find all devices for this recipient
-	recipientDevices, err := ct.getDevicesForRecipient(ctx, recipientIDStr)
-	if err != nil {
-		return fmt.Errorf("failed to get devices for recipient: %w", err)
+	if change.Operation != "INSERT" && change.Operation != "UPDATE" && change.Operation != "DELETE" {
+		return nil, nil
 	}
 
-	// Find all devices for the sender(s) to exclude them from receiving their own messages
-	// For UPDATE operations, exclude devices for both old and new sender (if different)
-	senderDeviceMap := make(map[string]bool)
-	
-	// Add devices for new sender
-	if senderIDStr != "" {
-		senderDevices, err := ct.getDevicesForSender(ctx, senderIDStr)
+	origins := originUserIDs(change, rule.OriginColumns)
+
+	var targets []string
+	switch rule.Mode {
+	case SyncRuleColumn:
+		for _, userID := range columnUserIDs(change, rule.UserColumns) {
+			devices, err := ct.getDevicesForUser(ctx, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get devices for user: %w", err)
+			}
+			targets = append(targets, devices...)
+		}
+	case SyncRuleJoin:
+		key, ok := rowValue(change, rule.JoinColumn)
+		if !ok {
+			break
+		}
+		userIDs, err := ct.directory.GetUserIDsByQuery(ctx, rule.Join, key)
 		if err != nil {
-			return fmt.Errorf("failed to get devices for sender: %w", err)
+			return nil, fmt.Errorf("failed to run join for %s: %w", change.Table, err)
 		}
-		for _, deviceID := range senderDevices {
-			senderDeviceMap[deviceID] = true
+		for _, userID := range userIDs {
+			devices, err := ct.getDevicesForUser(ctx, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get devices for user: %w", err)
+			}
+			targets = append(targets, devices...)
+		}
+	case SyncRuleBroadcast:
+		devices, err := ct.directory.GetEnrolledDeviceIDs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get enrolled devices: %w", err)
 		}
+		targets = devices
 	}
-	
-	// Add devices for old sender (if different from new sender)
-	if oldSenderIDStr != "" && oldSenderIDStr != senderIDStr {
-		oldSenderDevices, err := ct.getDevicesForSender(ctx, oldSenderIDStr)
+
+	originDevices := make(map[string]bool)
+	for _, userID := range origins {
+		devices, err := ct.getDevicesForUser(ctx, userID)
 		if err != nil {
-			return fmt.Errorf("failed to get devices for old sender: %w", err)
+			return nil, fmt.Errorf("failed to get devices for origin user: %w", err)
 		}
-		for _, deviceID := range oldSenderDevices {
-			senderDeviceMap[deviceID] = true
+		for _, deviceID := range devices {
+			originDevices[deviceID] = true
 		}
 	}
 
-	// Filter out sender devices from recipient devices to prevent sync loops
-	filteredDevices := make([]string, 0)
-	for _, deviceID := range recipientDevices {
-		if !senderDeviceMap[deviceID] {
+	// Deletes are sent as tombstones to every device holding the row, the
+	// origin's included. The old row comes from the replica identity.
+	if change.Operation == "DELETE" {
+		if len(targets) == 0 && len(originDevices) == 0 && rule.Mode != SyncRuleBroadcast {
+			log.Printf("Skipping DELETE on %s.%s without routing columns; set REPLICA IDENTITY FULL on the table", change.Schema, change.Table)
+			return nil, nil
+		}
+		for deviceID := range originDevices {
+			targets = append(targets, deviceID)
+		}
+		return uniqueStrings(targets), nil
+	}
+
+	// Filter out origin devices to prevent sync loops
+	filteredDevices := make([]string, 0, len(targets))
+	for _, deviceID := range uniqueStrings(targets) {
+		if !originDevices[deviceID] {
 			filteredDevices = append(filteredDevices, deviceID)
 		}
 	}
 
-	// Add change to each filtered device's queue
-	ct.changesLock.Lock()
-	defer ct.changesLock.Unlock()
+	return filteredDevices, nil
+}
 
-	for _, deviceID := range filteredDevices {
-		if ct.changes[deviceID] == nil {
-			ct.changes[deviceID] = make([]*WALChange, 0)
+// uniqueStrings returns values without duplicates, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
 		}
-		ct.changes[deviceID] = append(ct.changes[deviceID], change)
 	}
-
-	return nil
+	return unique
 }
 
-// GetChangesForDevice returns all pending changes for a device since the last synced LSN
+// GetChangesForDevice returns pending changes for a device since the last synced LSN.
+// The limit never splits a transaction: a transaction larger than the limit is returned whole.
 func (ct *ChangeTracker) GetChangesForDevice(ctx context.Context, deviceID string, limit int) ([]*WALChange, error) {
 	// Get device's last synced LSN
 	sm, err := ct.db.GetSyncMetadata(ctx, deviceID)
@@ -146,106 +314,162 @@ func (ct *ChangeTracker) GetChangesForDevice(ctx context.Context, deviceID strin
 		return nil, fmt.Errorf("failed to get sync metadata: %w", err)
 	}
 
-	ct.changesLock.RLock()
-	defer ct.changesLock.RUnlock()
-
-	deviceChanges := ct.changes[deviceID]
-	if deviceChanges == nil {
-		return []*WALChange{}, nil
+	// Changes at or before the device's last synced LSN were already delivered
+	var lastLSN models.LSN
+	if sm.LastSyncedLSN != nil && *sm.LastSyncedLSN != "" {
+		if lastLSN, err = models.ParseLSN(*sm.LastSyncedLSN); err != nil {
+			return nil, fmt.Errorf("invalid last synced LSN: %w", err)
+		}
 	}
 
-	// Filter changes that are newer than last synced LSN
-	filteredChanges := make([]*WALChange, 0)
-	for _, change := range deviceChanges {
-		// If no LSN is set, include all changes
-		if sm.LastSyncedLSN == nil || *sm.LastSyncedLSN == "" {
-			filteredChanges = append(filteredChanges, change)
-			continue
+	// A bootstrapped device already has the transactions visible in its snapshot
+	var snap *pgSnapshot
+	var snapshotLSN models.LSN
+	if sm.Snapshot != nil && sm.SnapshotLSN != nil {
+		if snap, err = parsePgSnapshot(*sm.Snapshot); err != nil {
+			return nil, err
+		}
+		if snapshotLSN, err = models.ParseLSN(*sm.SnapshotLSN); err != nil {
+			return nil, fmt.Errorf("invalid snapshot LSN: %w", err)
 		}
+	}
 
-		// Compare LSNs
-		// Convert string to models.LSN
-		lastLSN, err := models.ParseLSN(*sm.LastSyncedLSN)
+	var filteredChanges []*WALChange
+	for {
+		queued, err := ct.db.GetQueuedChanges(ctx, deviceID, lastLSN, limit)
 		if err != nil {
-			// If conversion fails, include the change
-			filteredChanges = append(filteredChanges, change)
-			continue
+			return nil, fmt.Errorf("failed to get queued changes: %w", err)
 		}
-		
-		if change.LSN > lastLSN {
-			filteredChanges = append(filteredChanges, change)
+
+		filteredChanges = make([]*WALChange, 0, len(queued))
+		for _, q := range queued {
+			filteredChanges = append(filteredChanges, &WALChange{
+				LSN:        q.LSN,
+				XID:        q.XID,
+				Schema:     q.Schema,
+				Table:      q.Table,
+				Operation:  q.Operation,
+				Columns:    q.Columns,
+				OldColumns: q.OldColumns,
+				CommitTime: q.CommitTime,
+			})
+		}
+		if snap == nil || len(filteredChanges) == 0 {
+			break
 		}
-	}
 
-	// Limit results
-	if limit > 0 && len(filteredChanges) > limit {
-		filteredChanges = filteredChanges[:limit]
+		var dropped []models.LSN
+		filteredChanges, dropped = dropSnapshotChanges(filteredChanges, snap, snapshotLSN)
+		for _, lsn := range dropped {
+			if err := ct.db.DeleteQueuedTransaction(ctx, deviceID, lsn); err != nil {
+				return nil, fmt.Errorf("failed to drop snapshot transaction: %w", err)
+			}
+		}
+		if len(filteredChanges) > 0 || len(dropped) == 0 {
+			break
+		}
+		// The whole page was in the snapshot; read on
 	}
 
-	return filteredChanges, nil
+	return limitToTransactions(filteredChanges, limit), nil
 }
 
-// ClearChangesForDevice clears changes for a device after successful sync
-func (ct *ChangeTracker) ClearChangesForDevice(ctx context.Context, deviceID string, syncedLSN models.LSN) error {
-	ct.changesLock.Lock()
-	defer ct.changesLock.Unlock()
-
-	// Remove changes up to and including the synced LSN
-	deviceChanges := ct.changes[deviceID]
-	if deviceChanges == nil {
-		return nil
+// limitToTransactions trims changes to at most limit entries without splitting a
+// transaction. Changes of one transaction share a commit LSN and are adjacent.
+func limitToTransactions(changes []*WALChange, limit int) []*WALChange {
+	if limit <= 0 || len(changes) <= limit {
+		return changes
 	}
 
-	filteredChanges := make([]*WALChange, 0)
-	for _, change := range deviceChanges {
-		if change.LSN > syncedLSN {
-			filteredChanges = append(filteredChanges, change)
-		}
+	end := limit
+	// Back up to the start of the transaction that crosses the limit
+	for end > 0 && changes[end].LSN == changes[end-1].LSN {
+		end--
+	}
+	if end > 0 {
+		return changes[:end]
 	}
 
-	ct.changes[deviceID] = filteredChanges
-	return nil
+	// The first transaction alone exceeds the limit; return all of it
+	end = limit
+	for end < len(changes) && changes[end].LSN == changes[0].LSN {
+		end++
+	}
+	return changes[:end]
 }
 
-// getDevicesForRecipient gets all device IDs for a recipient user
-func (ct *ChangeTracker) getDevicesForRecipient(ctx context.Context, recipientID string) ([]string, error) {
-	// Query users table to find device_id for the recipient
-	// We need to access the pool through a method or add a method to DB
-	// For now, let's add a helper method to database.DB
-	user, err := ct.db.GetUserByID(ctx, recipientID)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			// No device found for this recipient (might be a web user)
-			return []string{}, nil
+// rowKey returns the key that identifies a change's row in the device queues:
+// the values of the columns the relation flags as its key, or of the table's
+// primary key when the relation does not name one (REPLICA IDENTITY FULL, or
+// changes from the notify source). It is "" if the key values are unknown.
+func (ct *ChangeTracker) rowKey(ctx context.Context, change *WALChange) (string, error) {
+	columns := change.Key
+	if len(columns) == 0 {
+		var err error
+		if columns, err = ct.primaryKey(ctx, change.Schema, change.Table); err != nil {
+			return "", err
 		}
-		return nil, err
 	}
+	return rowKeyValues(change, columns), nil
+}
 
-	if user.DeviceID == nil || *user.DeviceID == "" {
-		return []string{}, nil
-	}
+// primaryKey returns a table's primary key columns, looked up once per table
+func (ct *ChangeTracker) primaryKey(ctx context.Context, schema, table string) ([]string, error) {
+	name := schema + "." + table
+	ct.keysLock.Lock()
+	defer ct.keysLock.Unlock()
 
-	return []string{*user.DeviceID}, nil
+	if columns, ok := ct.primaryKeys[name]; ok {
+		return columns, nil
+	}
+	columns, err := ct.db.GetPrimaryKeyColumns(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ct.primaryKeys[name] = columns
+	return columns, nil
 }
 
-// getDevicesForSender gets all device IDs for a sender user
-// This is used to exclude the sender's device(s) from receiving their own messages
-func (ct *ChangeTracker) getDevicesForSender(ctx context.Context, senderID string) ([]string, error) {
-	user, err := ct.db.GetUserByID(ctx, senderID)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			// No user found (shouldn't happen, but handle gracefully)
-			return []string{}, nil
+// rowKeyValues encodes the values of a row's key columns as a JSON array, or
+// returns "" if there are no key columns or a value is missing
+func rowKeyValues(change *WALChange, columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, ok := rowValue(change, column)
+		if !ok {
+			return ""
 		}
-		return nil, err
+		values[i] = value
 	}
+	key, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(key)
+}
+
+// getDevicesForUser gets all enrolled device IDs for a user. Web users and
+// unknown users have no devices.
+func (ct *ChangeTracker) getDevicesForUser(ctx context.Context, userID string) ([]string, error) {
+	return ct.directory.GetDeviceIDsForUser(ctx, userID)
+}
 
-	// If sender is a web user (no device_id), return empty list
-	if user.DeviceID == nil || *user.DeviceID == "" {
-		return []string{}, nil
+// ConvertWALChangeToRecord converts an INSERT or UPDATE of a non-message table to a Record
+func ConvertWALChangeToRecord(change *WALChange) (*models.Record, error) {
+	if change.Operation != "INSERT" && change.Operation != "UPDATE" {
+		return nil, fmt.Errorf("unsupported operation: %s", change.Operation)
 	}
 
-	return []string{*user.DeviceID}, nil
+	return &models.Record{
+		Table:     change.Table,
+		Operation: change.Operation,
+		Data:      change.Columns,
+		UpdatedAt: change.CommitTime,
+		HLC:       changeHLC(change),
+	}, nil
 }
 
 // ConvertWALChangeToMessage converts a WAL change to a Message model
@@ -276,24 +500,93 @@ func ConvertWALChangeToMessage(change *WALChange) (*models.Message, error) {
 	}
 
 	// Extract timestamps
-	if createdAt, ok := change.Columns["created_at"].(time.Time); ok {
+	if createdAt, ok := timestampValue(change.Columns["created_at"]); ok {
 		msg.CreatedAt = createdAt
 	} else {
 		msg.CreatedAt = change.CommitTime
 	}
 
-	if updatedAt, ok := change.Columns["updated_at"].(time.Time); ok {
+	if updatedAt, ok := timestampValue(change.Columns["updated_at"]); ok {
 		msg.UpdatedAt = updatedAt
 	} else {
 		msg.UpdatedAt = change.CommitTime
 	}
 
-	if syncedAt, ok := change.Columns["synced_at"].(time.Time); ok {
+	if syncedAt, ok := timestampValue(change.Columns["synced_at"]); ok {
 		msg.SyncedAt = &syncedAt
 	}
-	if readAt, ok := change.Columns["read_at"].(time.Time); ok {
+	if readAt, ok := timestampValue(change.Columns["read_at"]); ok {
 		msg.ReadAt = &readAt
 	}
+	msg.HLC = changeHLC(change)
 
 	return msg, nil
 }
+
+// changeHLCNode marks HLC timestamps derived from commit times
+const changeHLCNode = "commit"
+
+// changeHLC returns the hybrid logical clock timestamp of a change: the row's
+// hlc column if it has one, otherwise the commit time. Commit times come from
+// the database clock, so for tables without an hlc column the order against
+// device timestamps is only approximate.
+func changeHLC(change *WALChange) string {
+	if hlc, ok := change.Columns["hlc"].(string); ok && hlc != "" {
+		return hlc
+	}
+	return hlcFromTime(change.CommitTime, changeHLCNode).String()
+}
+
+// timestampLayouts are the text forms of timestamps in pgoutput and JSON rows
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// timestampValue converts a column value to a time. Timestamps without a time
+// zone are taken as UTC.
+func timestampValue(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// ConvertWALChangeToTombstone converts a DELETE change to a Tombstone using the
+// key from the replica identity. Its HLC is taken from the commit time, but
+// orders after the deleted row's hlc when the old row carries one, so a delete
+// never sorts before the write it removes.
+func ConvertWALChangeToTombstone(change *WALChange) (*models.Tombstone, error) {
+	if change.Operation != "DELETE" {
+		return nil, fmt.Errorf("unsupported operation: %s", change.Operation)
+	}
+
+	id, ok := keyText(change.OldColumns["id"])
+	if !ok {
+		return nil, fmt.Errorf("delete on %s without id", change.Table)
+	}
+
+	hlc := hlcFromTime(change.CommitTime, changeHLCNode)
+	if s, ok := change.OldColumns["hlc"].(string); ok {
+		if last, err := ParseHLC(s); err == nil && !last.Before(hlc) {
+			hlc = HLCTimestamp{Wall: last.Wall, Logical: last.Logical + 1, Node: changeHLCNode}
+		}
+	}
+
+	return &models.Tombstone{
+		Table:     change.Table,
+		ID:        id,
+		DeletedAt: change.CommitTime,
+		HLC:       hlc.String(),
+	}, nil
+}
@@ -1,76 +1,254 @@
 package sync
 
 import (
+	"context"
+	"encoding/json"
+	"reflect"
 	"testing"
+	"time"
+
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/models"
 )
 
-// TestGetDevicesForSender documents the expected behavior of getDevicesForSender()
-func TestGetDevicesForSender(t *testing.T) {
-	// This test documents the expected behavior:
-	// 1. getDevicesForSender() should return device_id for mobile users
-	// 2. getDevicesForSender() should return empty list for web users
-	// 3. getDevicesForSender() should return empty list for non-existent users
-	
-	t.Log("TestGetDevicesForSender: Documents expected behavior")
-	t.Log("  - Mobile users with device_id should return their device")
-	t.Log("  - Web users (no device_id) should return empty list")
-	t.Log("  - Non-existent users should return empty list")
+// fakeDirectory serves routing lookups from maps
+type fakeDirectory struct {
+	devices  map[string][]string // userID -> devices
+	joins    map[string][]string // join key -> userIDs
+	enrolled []string
+}
+
+func (d *fakeDirectory) GetDeviceIDsForUser(ctx context.Context, userID string) ([]string, error) {
+	return d.devices[userID], nil
+}
+
+func (d *fakeDirectory) GetUserIDsByQuery(ctx context.Context, query string, key string) ([]string, error) {
+	return d.joins[key], nil
+}
+
+func (d *fakeDirectory) GetEnrolledDeviceIDs(ctx context.Context) ([]string, error) {
+	return d.enrolled, nil
+}
+
+func newRoutingTracker(t *testing.T, rules ...config.SyncRule) *ChangeTracker {
+	t.Helper()
+	syncRules, err := NewSyncRules(rules)
+	if err != nil {
+		t.Fatalf("NewSyncRules: %v", err)
+	}
+	return &ChangeTracker{
+		rules: syncRules,
+		directory: &fakeDirectory{
+			devices: map[string][]string{
+				"alice": {"alice-phone"},
+				"bob":   {"bob-phone", "bob-tablet"},
+				"carol": {"carol-phone"},
+			},
+			joins:    map[string][]string{"project-1": {"bob", "carol"}},
+			enrolled: []string{"alice-phone", "bob-phone", "bob-tablet", "carol-phone"},
+		},
+	}
+}
+
+func TestRouteChange(t *testing.T) {
+	ct := newRoutingTracker(t,
+		config.SyncRule{Table: "messages", Mode: SyncRuleColumn, UserColumns: []string{"recipient_id"}, OriginColumns: []string{"sender_id"}},
+		config.SyncRule{Table: "tasks", Mode: SyncRuleJoin, Join: "SELECT user_id FROM members WHERE project_id = $1", JoinColumn: "project_id", OriginColumns: []string{"author_id"}},
+		config.SyncRule{Table: "app.settings", Mode: SyncRuleBroadcast, OriginColumns: []string{"updated_by"}},
+	)
+
+	tests := []struct {
+		name   string
+		change *WALChange
+		want   []string
+	}{
+		{
+			name: "insert goes to the recipient, not back to the sender",
+			change: &WALChange{Schema: "public", Table: "messages", Operation: "INSERT",
+				Columns: map[string]interface{}{"id": "m1", "sender_id": "alice", "recipient_id": "bob"}},
+			want: []string{"bob-phone", "bob-tablet"},
+		},
+		{
+			name: "web users have no devices to exclude",
+			change: &WALChange{Schema: "public", Table: "messages", Operation: "INSERT",
+				Columns: map[string]interface{}{"id": "m2", "sender_id": "web-user", "recipient_id": "alice"}},
+			want: []string{"alice-phone"},
+		},
+		{
+			name: "message to oneself is not echoed",
+			change: &WALChange{Schema: "public", Table: "messages", Operation: "UPDATE",
+				Columns: map[string]interface{}{"id": "m3", "sender_id": "bob", "recipient_id": "bob"}},
+			want: []string{},
+		},
+		{
+			name: "delete reaches the origin's devices too",
+			change: &WALChange{Schema: "public", Table: "messages", Operation: "DELETE",
+				OldColumns: map[string]interface{}{"id": "m1", "sender_id": "alice", "recipient_id": "bob"}},
+			want: []string{"bob-phone", "bob-tablet", "alice-phone"},
+		},
+		{
+			name: "delete without routing columns is skipped",
+			change: &WALChange{Schema: "public", Table: "messages", Operation: "DELETE",
+				OldColumns: map[string]interface{}{"id": "m1"}},
+			want: nil,
+		},
+		{
+			name: "join routes to the users the query returns",
+			change: &WALChange{Schema: "public", Table: "tasks", Operation: "INSERT",
+				Columns: map[string]interface{}{"id": "t1", "project_id": "project-1", "author_id": "carol"}},
+			want: []string{"bob-phone", "bob-tablet"},
+		},
+		{
+			name: "update skips both the old and the new origin",
+			change: &WALChange{Schema: "app", Table: "settings", Operation: "UPDATE",
+				Columns:    map[string]interface{}{"id": "s1", "updated_by": "alice"},
+				OldColumns: map[string]interface{}{"id": "s1", "updated_by": "carol"}},
+			want: []string{"bob-phone", "bob-tablet"},
+		},
+		{
+			name: "tables without a rule are not synced",
+			change: &WALChange{Schema: "public", Table: "audit_log", Operation: "INSERT",
+				Columns: map[string]interface{}{"id": "a1"}},
+			want: nil,
+		},
+		{
+			name:   "truncates are not routed",
+			change: &WALChange{Schema: "public", Table: "messages", Operation: "TRUNCATE"},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ct.routeChange(context.Background(), tt.change)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: routed to %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConvertWALChangeToTombstone(t *testing.T) {
+	deletedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	change := &WALChange{
+		Table:      "messages",
+		Operation:  "DELETE",
+		OldColumns: map[string]interface{}{"id": "m1", "recipient_id": "u2"},
+		CommitTime: deletedAt,
+	}
+
+	tombstone, err := ConvertWALChangeToTombstone(change)
+	if err != nil {
+		t.Fatalf("ConvertWALChangeToTombstone: %v", err)
+	}
+	if tombstone.Table != "messages" || tombstone.ID != "m1" || !tombstone.DeletedAt.Equal(deletedAt) {
+		t.Errorf("unexpected tombstone: %+v", tombstone)
+	}
+	if want := hlcFromTime(deletedAt, changeHLCNode).String(); tombstone.HLC != want {
+		t.Errorf("tombstone HLC = %q, want %q", tombstone.HLC, want)
+	}
+
+	// The deleted row was last written by a clock ahead of the database
+	written := hlcFromTime(deletedAt.Add(time.Minute), "device")
+	change.OldColumns["hlc"] = written.String()
+	if tombstone, err = ConvertWALChangeToTombstone(change); err != nil {
+		t.Fatalf("ConvertWALChangeToTombstone: %v", err)
+	}
+	if deleted, err := ParseHLC(tombstone.HLC); err != nil || !written.Before(deleted) {
+		t.Errorf("tombstone HLC = %q, want after %q", tombstone.HLC, written)
+	}
+
+	change.OldColumns = map[string]interface{}{"recipient_id": "u2"}
+	if _, err := ConvertWALChangeToTombstone(change); err == nil {
+		t.Error("expected error for delete without id")
+	}
 }
 
-// TestAddChange_PreventsSyncLoop documents the expected behavior for loop prevention
-// This test should be run with a real test database in integration test environment
-func TestAddChange_PreventsSyncLoop(t *testing.T) {
-	// This test documents the expected behavior:
-	// When a mobile user sends a message:
-	// 1. The message is inserted into PostgreSQL
-	// 2. WAL change is detected
-	// 3. ChangeTracker.AddChange() is called
-	// 4. Recipient devices receive the change
-	// 5. Sender devices are EXCLUDED (loop prevention)
-	
-	t.Log("TestAddChange_PreventsSyncLoop: Documents expected behavior")
-	t.Log("  - Messages from mobile user A to mobile user B")
-	t.Log("  - Recipient (user B) device should receive the change")
-	t.Log("  - Sender (user A) device should NOT receive the change")
-	t.Log("  - This prevents infinite sync loops")
-	
-	// To run this as an integration test:
-	// 1. Set up a test database
-	// 2. Create sender and recipient users with devices
-	// 3. Create a WAL change
-	// 4. Call AddChange()
-	// 5. Verify recipient device has the change
-	// 6. Verify sender device does NOT have the change
+func TestNewChangeNotification(t *testing.T) {
+	queued := []models.QueuedChange{
+		{DeviceID: "phone", LSN: 0x16B3748, Table: "messages"},
+		{DeviceID: "tablet", LSN: 0x16B3748, Table: "messages"},
+		{DeviceID: "phone", LSN: 0x16B3748, Table: "tasks"},
+	}
+
+	notification := newChangeNotification(queued)
+	if notification.LSN != queued[0].LSN.String() {
+		t.Errorf("LSN = %s, want %s", notification.LSN, queued[0].LSN)
+	}
+	if len(notification.DeviceIDs) != 2 || notification.DeviceIDs[0] != "phone" || notification.DeviceIDs[1] != "tablet" {
+		t.Errorf("DeviceIDs = %v, want [phone tablet]", notification.DeviceIDs)
+	}
+	if len(notification.Tables) != 2 || notification.Tables[0] != "messages" || notification.Tables[1] != "tasks" {
+		t.Errorf("Tables = %v, want [messages tasks]", notification.Tables)
+	}
 }
 
-// TestAddChange_WebUserToMobileUser documents expected behavior for web-to-mobile messages
-func TestAddChange_WebUserToMobileUser(t *testing.T) {
-	// This test documents the expected behavior:
-	// When a web user sends a message to a mobile user:
-	// 1. Web users don't have device_id
-	// 2. getDevicesForSender() returns empty list for web users
-	// 3. No devices are excluded (since sender has no devices)
-	// 4. Recipient device receives the change normally
-	
-	t.Log("TestAddChange_WebUserToMobileUser: Documents expected behavior")
-	t.Log("  - Messages from web user to mobile user")
-	t.Log("  - Web users have no device_id")
-	t.Log("  - Recipient device should receive the change")
-	t.Log("  - No exclusion needed (sender has no devices)")
+func TestRowKeyValues(t *testing.T) {
+	update := &WALChange{
+		Schema:     "public",
+		Table:      "order_items",
+		Operation:  "UPDATE",
+		Columns:    map[string]interface{}{"order_id": "o1", "line": int32(2), "note": "x:y"},
+		OldColumns: map[string]interface{}{"order_id": "o1", "line": int32(2)},
+	}
+	if got := rowKeyValues(update, []string{"order_id", "line"}); got != `["o1","2"]` {
+		t.Errorf("composite key = %s", got)
+	}
+
+	// Deletes carry the key in the old row only
+	del := &WALChange{Operation: "DELETE", OldColumns: map[string]interface{}{"id": json.Number("42")}}
+	if got := rowKeyValues(del, []string{"id"}); got != `["42"]` {
+		t.Errorf("delete key = %s", got)
+	}
+
+	// Without key columns, or with a key value missing, the row is not keyed
+	if got := rowKeyValues(update, nil); got != "" {
+		t.Errorf("key without columns = %s", got)
+	}
+	if got := rowKeyValues(update, []string{"order_id", "sku"}); got != "" {
+		t.Errorf("key with a missing column = %s", got)
+	}
 }
 
-// TestAddChange_UpdateOperation documents expected behavior for UPDATE operations
-func TestAddChange_UpdateOperation(t *testing.T) {
-	// This test documents the expected behavior:
-	// When a message is updated and sender_id changes:
-	// 1. Both old and new sender_id are extracted from OldColumns and Columns
-	// 2. Devices for both old and new sender are excluded
-	// 3. Recipient device receives the change
-	// 4. Both old and new sender devices are excluded (loop prevention)
-	
-	t.Log("TestAddChange_UpdateOperation: Documents expected behavior")
-	t.Log("  - UPDATE operations with sender_id changes")
-	t.Log("  - Both old and new sender devices should be excluded")
-	t.Log("  - Recipient device should receive the change")
-	t.Log("  - This prevents loops even when sender changes")
+func TestRouteChangesStablePositions(t *testing.T) {
+	ct := newRoutingTracker(t,
+		config.SyncRule{Table: "messages", Mode: SyncRuleColumn, UserColumns: []string{"recipient_id"}, OriginColumns: []string{"sender_id"}},
+	)
+	message := func(id, recipient string) *WALChange {
+		return &WALChange{LSN: 0x100, Schema: "public", Table: "messages", Operation: "INSERT", Key: []string{"id"},
+			Columns: map[string]interface{}{"id": id, "sender_id": "web-user", "recipient_id": recipient}}
+	}
+	txn := []*WALChange{message("m1", "alice"), message("m2", "bob"), message("m3", "alice")}
+
+	positions := func() map[[2]string]int {
+		position := 0
+		queued, err := ct.routeChanges(context.Background(), txn, &position)
+		if err != nil {
+			t.Fatalf("routeChanges: %v", err)
+		}
+		seqs := make(map[[2]string]int)
+		for _, q := range queued {
+			seqs[[2]string{q.DeviceID, q.RowKey}] = q.Seq
+		}
+		return seqs
+	}
+
+	before := positions()
+	if before[[2]string{"alice-phone", `["m3"]`}] != 2 {
+		t.Errorf("m3 queued at %d for alice-phone, want its position 2", before[[2]string{"alice-phone", `["m3"]`}])
+	}
+
+	// A device enrolled before the transaction is replayed does not shift the others
+	ct.directory.(*fakeDirectory).devices["alice"] = []string{"alice-phone", "alice-tablet"}
+	after := positions()
+	for key, seq := range before {
+		if after[key] != seq {
+			t.Errorf("%v queued at %d on replay, was %d", key, after[key], seq)
+		}
+	}
+	if after[[2]string{"alice-tablet", `["m3"]`}] != 2 {
+		t.Errorf("m3 queued at %d for alice-tablet, want 2", after[[2]string{"alice-tablet", `["m3"]`}])
+	}
 }
@@ -0,0 +1,208 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+)
+
+// Conflict resolution strategies accepted by sync.conflict_resolution
+const (
+	ConflictLastWriteWins = "last_write_wins"
+	ConflictManual        = "manual"
+)
+
+// Resolutions of a conflict: the version that is kept
+const (
+	ResolutionServer = "server"
+	ResolutionDevice = "device"
+)
+
+// maxUpdateAttempts bounds the retries of an edit that races other writers
+const maxUpdateAttempts = 3
+
+// ConflictResolver applies device edits of stored rows. An edit conflicts when
+// the row changed on the server after the version the device edited; the
+// configured strategy then decides which version is kept. Every conflict is
+// recorded in sync_conflicts, and manual ones stay open until a user resolves
+// them.
+type ConflictResolver struct {
+	db       *database.DB
+	strategy string
+	clock    *HLCClock // Stamps device versions applied by a user's resolution
+}
+
+// NewConflictResolver creates a resolver using strategy
+func NewConflictResolver(db *database.DB, strategy string, clock *HLCClock) (*ConflictResolver, error) {
+	switch strategy {
+	case ConflictLastWriteWins, ConflictManual:
+	default:
+		return nil, fmt.Errorf("unknown conflict resolution strategy %q", strategy)
+	}
+	return &ConflictResolver{db: db, strategy: strategy, clock: clock}, nil
+}
+
+// updateDecision is what happens to a device's edit of a stored message
+type updateDecision int
+
+const (
+	updateUnchanged  updateDecision = iota // The edit matches the stored message
+	updateApply                            // No conflict: apply the edit
+	updateDeviceWins                       // Conflict won by the device: apply the edit
+	updateServerWins                       // Conflict won by the server: keep the stored message
+	updateManual                           // Conflict left for a user to resolve
+	updateIDTaken                          // The ID belongs to another sender's or recipient's message
+)
+
+// decideUpdate compares an edit with the stored message. The edit conflicts if
+// the stored content is newer than the version the device edited; under
+// last_write_wins the later of the two edits by hybrid logical clock is kept,
+// so a device whose wall clock is skewed cannot win or lose by it.
+func decideUpdate(strategy string, stored, update *models.Message) updateDecision {
+	if stored.SenderID != update.SenderID || stored.RecipientID != update.RecipientID {
+		return updateIDTaken
+	}
+	if stored.Content == update.Content {
+		return updateUnchanged
+	}
+	// Only content edits advance a message's hlc, so status changes such as
+	// delivery do not make an edit conflict
+	if stored.HLC <= update.BaseHLC {
+		return updateApply
+	}
+
+	if strategy == ConflictManual {
+		return updateManual
+	}
+	// Both are HLC text forms, which sort in clock order
+	if stored.HLC < update.HLC {
+		return updateDeviceWins
+	}
+	return updateServerWins
+}
+
+// ApplyUpdate applies a device's edit of a stored message and returns its outcome
+func (r *ConflictResolver) ApplyUpdate(ctx context.Context, deviceID string, update *models.Message) (models.MessageUploadResult, error) {
+	result := models.MessageUploadResult{MessageID: update.ID}
+	if update.UpdatedAt.IsZero() {
+		update.UpdatedAt = time.Now()
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		stored, err := r.db.GetMessageByID(ctx, update.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			result.Outcome = models.UploadRejected
+			result.Reason = models.RejectUnknownMessage
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to get stored message: %w", err)
+		}
+
+		decision := decideUpdate(r.strategy, stored, update)
+		switch decision {
+		case updateIDTaken:
+			result.Outcome = models.UploadConflict
+			return result, nil
+		case updateUnchanged:
+			result.Outcome = models.UploadDuplicate
+			return result, nil
+		}
+
+		var conflict *models.SyncConflict
+		if decision != updateApply {
+			if conflict, result, err = r.newConflict(deviceID, stored, update, decision); err != nil {
+				return result, err
+			}
+		}
+		if decision == updateServerWins || decision == updateManual {
+			if err := r.db.CreateConflict(ctx, conflict); err != nil {
+				return result, fmt.Errorf("failed to record conflict: %w", err)
+			}
+			log.Printf("Conflicting edit of message %s from device %s: %s (%s)", stored.ID, deviceID, result.Resolution, r.strategy)
+			if decision == updateManual {
+				result.ConflictID = conflict.ID
+			}
+			return result, nil
+		}
+
+		// Apply the edit, together with the conflict it won, unless the message
+		// changed since it was read
+		applied, err := r.db.UpdateMessageContent(ctx, update.ID, update.Content, update.HLC, stored.HLC, conflict)
+		if err != nil {
+			return result, fmt.Errorf("failed to update message: %w", err)
+		}
+		if !applied {
+			continue
+		}
+		if conflict != nil {
+			log.Printf("Conflicting edit of message %s from device %s: %s (%s)", stored.ID, deviceID, result.Resolution, r.strategy)
+		}
+		result.Outcome = models.UploadUpdated
+		return result, nil
+	}
+	return result, fmt.Errorf("message %s kept changing while applying an edit", update.ID)
+}
+
+// newConflict builds the record of a detected conflict and the edit's outcome
+func (r *ConflictResolver) newConflict(deviceID string, stored, update *models.Message, decision updateDecision) (*models.SyncConflict, models.MessageUploadResult, error) {
+	result := models.MessageUploadResult{MessageID: update.ID}
+
+	conflict := &models.SyncConflict{
+		TableName: "messages",
+		RowID:     stored.ID,
+		DeviceID:  deviceID,
+		UserID:    update.SenderID,
+		BaseHLC:   update.BaseHLC,
+		Strategy:  r.strategy,
+		Status:    "open",
+	}
+	var err error
+	if conflict.ServerData, err = json.Marshal(stored); err != nil {
+		return nil, result, fmt.Errorf("failed to encode stored message: %w", err)
+	}
+	if conflict.DeviceData, err = json.Marshal(update); err != nil {
+		return nil, result, fmt.Errorf("failed to encode device message: %w", err)
+	}
+
+	switch decision {
+	case updateDeviceWins:
+		result.Outcome = models.UploadUpdated
+		result.Resolution = ResolutionDevice
+	case updateServerWins:
+		result.Outcome = models.UploadConflict
+		result.Resolution = ResolutionServer
+	default:
+		result.Outcome = models.UploadConflict
+		result.Resolution = ConflictManual
+	}
+	if decision != updateManual {
+		// Resolved on arrival; recorded for the audit trail
+		now := time.Now()
+		conflict.Status = "resolved"
+		conflict.Resolution = &result.Resolution
+		conflict.ResolvedAt = &now
+	}
+	return conflict, result, nil
+}
+
+// Resolve closes an open conflict of a user, keeping the server's or the
+// device's version
+func (r *ConflictResolver) Resolve(ctx context.Context, conflictID, userID, resolution string) (*models.SyncConflict, error) {
+	if resolution != ResolutionServer && resolution != ResolutionDevice {
+		return nil, fmt.Errorf("unknown resolution %q", resolution)
+	}
+	return r.db.ResolveConflict(ctx, conflictID, userID, resolution, r.clock.Now().String())
+}
+
+// ListConflicts returns a user's recorded conflicts
+func (r *ConflictResolver) ListConflicts(ctx context.Context, filter models.ConflictFilter) ([]models.SyncConflict, error) {
+	return r.db.ListConflicts(ctx, filter)
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"posduif/sync-engine/internal/models"
+)
+
+func TestDecideUpdate(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	stored := func(updatedAt time.Time) *models.Message {
+		return &models.Message{ID: "m1", SenderID: "u1", RecipientID: "u2", Content: "server", UpdatedAt: updatedAt,
+			HLC: hlcFromTime(updatedAt, "server").String()}
+	}
+	edit := func(content string, at time.Time) *models.Message {
+		// The device's wall clock runs a day ahead; only its HLC orders the edit
+		return &models.Message{ID: "m1", SenderID: "u1", RecipientID: "u2", Content: content, UpdatedAt: at.Add(24 * time.Hour),
+			HLC: hlcFromTime(at, "device").String(), BaseHLC: hlcFromTime(base, "server").String()}
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		stored   *models.Message
+		update   *models.Message
+		want     updateDecision
+	}{
+		{"unchanged on server", ConflictLastWriteWins, stored(base), edit("device", base.Add(time.Minute)), updateApply},
+		{"same content", ConflictManual, stored(base.Add(time.Hour)), edit("server", base.Add(time.Minute)), updateUnchanged},
+		{"device edit is later", ConflictLastWriteWins, stored(base.Add(time.Minute)), edit("device", base.Add(time.Hour)), updateDeviceWins},
+		{"server edit is later", ConflictLastWriteWins, stored(base.Add(time.Hour)), edit("device", base.Add(time.Minute)), updateServerWins},
+		{"manual", ConflictManual, stored(base.Add(time.Minute)), edit("device", base.Add(time.Hour)), updateManual},
+		{"other sender", ConflictLastWriteWins, &models.Message{ID: "m1", SenderID: "u3", RecipientID: "u2", UpdatedAt: base}, edit("device", base), updateIDTaken},
+	}
+	for _, tt := range tests {
+		if got := decideUpdate(tt.strategy, tt.stored, tt.update); got != tt.want {
+			t.Errorf("%s: decision = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"posduif/sync-engine/internal/models"
+)
+
+var (
+	// ErrInvalidCursor is returned for a cursor that was not issued to the device
+	ErrInvalidCursor = errors.New("invalid sync cursor")
+	// ErrStaleCursor is returned for a cursor behind the device's acknowledged
+	// position, or of a page that can no longer be acknowledged, such as a page
+	// of a replaced snapshot
+	ErrStaleCursor = errors.New("sync cursor no longer applies")
+)
+
+// Kinds of incoming cursors
+const (
+	cursorChanges  = "changes"  // Page of the device's change queue
+	cursorSnapshot = "snapshot" // Page of the device's initial snapshot
+	cursorMessages = "messages" // Messages found by the polling source
+)
+
+// incomingCursor identifies a page of incoming changes. A device acknowledges
+// the cursor once it has applied the page, and only then does the server
+// consider the page delivered.
+type incomingCursor struct {
+	Kind      string
+	LSN       models.LSN // changes: commit LSN of the last change; snapshot: WAL position of the snapshot
+	Page      int        // snapshot: page number, starting at 1
+	Rule      int        // snapshot: sync rule the next page starts in
+	After     *string    // snapshot: last id of the page in that rule; messages: id of the last message
+	HLC       string     // messages: hlc of the last message
+	UpdatedAt time.Time  // messages: latest updated_at of the page
+}
+
+// String returns the text form passed between change sources and the Manager,
+// which signs it before it is sent to a device
+func (c *incomingCursor) String() string {
+	switch c.Kind {
+	case cursorChanges:
+		return cursorChanges + ":" + c.LSN.String()
+	case cursorSnapshot:
+		s := cursorSnapshot + ":" + c.LSN.String() + ":" + strconv.Itoa(c.Page) + ":" + strconv.Itoa(c.Rule)
+		if c.After != nil {
+			// Row ids may contain any character
+			s += ":" + base64.RawURLEncoding.EncodeToString([]byte(*c.After))
+		}
+		return s
+	case cursorMessages:
+		if c.After == nil {
+			return cursorMessages + ":"
+		}
+		return cursorMessages + ":" + base64.RawURLEncoding.EncodeToString([]byte(c.HLC)) + ":" +
+			base64.RawURLEncoding.EncodeToString([]byte(*c.After)) + ":" + strconv.FormatInt(c.UpdatedAt.UnixMicro(), 10)
+	}
+	return ""
+}
+
+// parseIncomingCursor parses the text form of a cursor
+func parseIncomingCursor(s string) (*incomingCursor, error) {
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok || (value == "" && kind != cursorMessages) {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &incomingCursor{Kind: kind}
+	var err error
+	switch kind {
+	case cursorChanges:
+		c.LSN, err = models.ParseLSN(value)
+	case cursorSnapshot:
+		parts := strings.Split(value, ":")
+		if len(parts) != 3 && len(parts) != 4 {
+			return nil, ErrInvalidCursor
+		}
+		if c.LSN, err = models.ParseLSN(parts[0]); err == nil {
+			c.Page, err = strconv.Atoi(parts[1])
+		}
+		if err == nil {
+			c.Rule, err = strconv.Atoi(parts[2])
+		}
+		if err == nil && len(parts) == 4 {
+			var after []byte
+			if after, err = base64.RawURLEncoding.DecodeString(parts[3]); err == nil {
+				afterID := string(after)
+				c.After = &afterID
+			}
+		}
+	case cursorMessages:
+		// An empty page of the polling source still has a cursor, without a position
+		if value == "" {
+			break
+		}
+		parts := strings.Split(value, ":")
+		if len(parts) != 3 {
+			return nil, ErrInvalidCursor
+		}
+		var hlc, after []byte
+		var micros int64
+		if hlc, err = base64.RawURLEncoding.DecodeString(parts[0]); err == nil {
+			after, err = base64.RawURLEncoding.DecodeString(parts[1])
+		}
+		if err == nil {
+			micros, err = strconv.ParseInt(parts[2], 10, 64)
+		}
+		if err == nil {
+			afterID := string(after)
+			c.HLC, c.After, c.UpdatedAt = string(hlc), &afterID, time.UnixMicro(micros).UTC()
+		}
+	default:
+		return nil, ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return c, nil
+}
+
+// cursorSigner turns cursors into opaque tokens bound to a device. A token is
+// the base64url encoded device ID and cursor, followed by an HMAC-SHA256 of
+// them, so a device cannot forge a position or use another device's cursor.
+type cursorSigner struct {
+	key []byte
+}
+
+func newCursorSigner(secret string) *cursorSigner {
+	return &cursorSigner{key: []byte(secret)}
+}
+
+// seal returns the token for a device's cursor
+func (s *cursorSigner) seal(deviceID, cursor string) string {
+	payload := []byte(deviceID + "\n" + cursor)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+// open verifies a token issued to the device and returns its cursor
+func (s *cursorSigner) open(deviceID, token string) (string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return "", ErrInvalidCursor
+	}
+
+	owner, cursor, ok := strings.Cut(string(payload), "\n")
+	if !ok || owner != deviceID {
+		return "", ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (s *cursorSigner) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncomingCursorRoundTrip(t *testing.T) {
+	after := "a:b/c"
+	updatedAt := time.UnixMicro(1709296200123456).UTC()
+	cursors := []*incomingCursor{
+		{Kind: cursorChanges, LSN: 0x16B3748},
+		{Kind: cursorSnapshot, LSN: 0x16B3748, Page: 3, Rule: 1, After: &after},
+		{Kind: cursorSnapshot, LSN: 0x16B3748, Page: 4, Rule: 2},
+		{Kind: cursorMessages, HLC: "1709296200123-00000-node", After: &after, UpdatedAt: updatedAt},
+		{Kind: cursorMessages},
+	}
+	for _, c := range cursors {
+		parsed, err := parseIncomingCursor(c.String())
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.String(), err)
+		}
+		if !reflect.DeepEqual(parsed, c) {
+			t.Errorf("parse %q = %+v, want %+v", c.String(), parsed, c)
+		}
+	}
+
+	for _, s := range []string{"", "changes", "changes:", "changes:nope", "snapshot:0/1", "snapshot:0/1:3", "snapshot:0/1:x:0", "snapshot:0/1:1:0:!", "messages:a:b", "messages:m1,m2", "messages:!:YQ:1", "messages:YQ:YQ:x", "other:1"} {
+		if _, err := parseIncomingCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("parse %q: err = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestCursorSigner(t *testing.T) {
+	signer := newCursorSigner("secret")
+	token := signer.seal("device-1", "changes:0/16B3748")
+
+	cursor, err := signer.open("device-1", token)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if cursor != "changes:0/16B3748" {
+		t.Errorf("open = %q, want %q", cursor, "changes:0/16B3748")
+	}
+
+	forged := newCursorSigner("secret").seal("device-1", "changes:0/FFFFFFFF")
+	tampered := forged[:strings.Index(forged, ".")] + token[strings.Index(token, "."):]
+	invalid := map[string]struct {
+		deviceID, token string
+	}{
+		"other device": {"device-2", token},
+		"other key":    {"device-1", newCursorSigner("other").seal("device-1", "changes:0/16B3748")},
+		"tampered":     {"device-1", tampered},
+		"unsigned":     {"device-1", "changes:0/16B3748"},
+		"garbage":      {"device-1", "!!.!!"},
+	}
+	for name, tc := range invalid {
+		if _, err := signer.open(tc.deviceID, tc.token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClockDrift is returned for a remote timestamp too far ahead of the local clock
+var ErrClockDrift = errors.New("hybrid logical clock timestamp too far in the future")
+
+// hlcMaxLogical is the largest logical counter of the text form; the wall time
+// moves on a millisecond instead of overflowing it
+const hlcMaxLogical = 99999
+
+// HLCTimestamp is a hybrid logical clock timestamp: the largest physical time
+// seen, in Unix milliseconds, a counter ordering events within that millisecond,
+// and the node that issued it as a tie-breaker. Its text form,
+// "<wall:13 digits>-<logical:5 digits>-<node>", sorts in timestamp order, so
+// it is stored and compared as text.
+type HLCTimestamp struct {
+	Wall    int64
+	Logical uint32
+	Node    string
+}
+
+// ParseHLC parses the text form of a timestamp
+func ParseHLC(s string) (HLCTimestamp, error) {
+	parts := strings.SplitN(s, "-", 3)
+	if len(parts) != 3 || len(parts[0]) != 13 || len(parts[1]) != 5 || parts[2] == "" {
+		return HLCTimestamp{}, fmt.Errorf("invalid HLC timestamp %q", s)
+	}
+	wall, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return HLCTimestamp{}, fmt.Errorf("invalid HLC wall time %q", s)
+	}
+	logical, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return HLCTimestamp{}, fmt.Errorf("invalid HLC counter %q", s)
+	}
+	return HLCTimestamp{Wall: wall, Logical: uint32(logical), Node: parts[2]}, nil
+}
+
+// hlcFromTime returns the timestamp of an event at t that no clock observed,
+// such as a committed row without an HLC of its own
+func hlcFromTime(t time.Time, node string) HLCTimestamp {
+	return HLCTimestamp{Wall: t.UnixMilli(), Node: node}
+}
+
+func (t HLCTimestamp) String() string {
+	return fmt.Sprintf("%013d-%05d-%s", t.Wall, t.Logical, t.Node)
+}
+
+// Before reports whether t orders before o
+func (t HLCTimestamp) Before(o HLCTimestamp) bool {
+	if t.Wall != o.Wall {
+		return t.Wall < o.Wall
+	}
+	if t.Logical != o.Logical {
+		return t.Logical < o.Logical
+	}
+	return t.Node < o.Node
+}
+
+// HLCClock issues hybrid logical clock timestamps. Every timestamp it issues
+// is later than all timestamps it issued or received before, and stays within
+// maxDrift of physical time even when devices' clocks are skewed.
+type HLCClock struct {
+	lock     sync.Mutex
+	node     string
+	maxDrift time.Duration
+	now      func() time.Time
+	last     HLCTimestamp
+}
+
+// NewHLCClock creates a clock for node
+func NewHLCClock(node string, maxDrift time.Duration) *HLCClock {
+	return &HLCClock{node: node, maxDrift: maxDrift, now: time.Now}
+}
+
+// Now returns a timestamp for a local event
+func (c *HLCClock) Now() HLCTimestamp {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	physical := c.now().UnixMilli()
+	if physical > c.last.Wall {
+		c.last = HLCTimestamp{Wall: physical}
+	} else {
+		c.advance()
+	}
+	c.last.Node = c.node
+	return c.last
+}
+
+// Update merges a timestamp received from another node, so that later local
+// timestamps order after it. A timestamp more than maxDrift ahead of physical
+// time is not merged and returns ErrClockDrift.
+func (c *HLCClock) Update(remote HLCTimestamp) (HLCTimestamp, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	physical := c.now().UnixMilli()
+	if c.maxDrift > 0 && remote.Wall-physical > c.maxDrift.Milliseconds() {
+		return HLCTimestamp{}, ErrClockDrift
+	}
+
+	switch {
+	case physical > c.last.Wall && physical > remote.Wall:
+		c.last = HLCTimestamp{Wall: physical}
+	case remote.Wall > c.last.Wall:
+		c.last = HLCTimestamp{Wall: remote.Wall, Logical: remote.Logical}
+		c.advance()
+	case remote.Wall == c.last.Wall && remote.Logical > c.last.Logical:
+		c.last.Logical = remote.Logical
+		c.advance()
+	default:
+		c.advance()
+	}
+	c.last.Node = c.node
+	return c.last, nil
+}
+
+// advance moves the last timestamp on by one logical tick
+func (c *HLCClock) advance() {
+	if c.last.Logical >= hlcMaxLogical {
+		c.last.Wall++
+		c.last.Logical = 0
+		return
+	}
+	c.last.Logical++
+}
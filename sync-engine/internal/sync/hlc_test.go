@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHLCClock(t *testing.T) {
+	physical := time.UnixMilli(1_700_000_000_000)
+	clock := NewHLCClock("server", time.Minute)
+	clock.now = func() time.Time { return physical }
+
+	first := clock.Now()
+	second := clock.Now()
+	if !first.Before(second) || second.Logical != 1 {
+		t.Fatalf("Now() = %v then %v, want increasing counter", first, second)
+	}
+
+	// A device ahead of the server moves the clock forward
+	remote := HLCTimestamp{Wall: physical.UnixMilli() + 5000, Logical: 7, Node: "device"}
+	merged, err := clock.Update(remote)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if !remote.Before(merged) {
+		t.Errorf("Update(%v) = %v, want later timestamp", remote, merged)
+	}
+	if next := clock.Now(); !merged.Before(next) {
+		t.Errorf("Now() after Update = %v, want after %v", next, merged)
+	}
+
+	// A device behind the server does not move it back
+	physical = physical.Add(time.Second)
+	behind := HLCTimestamp{Wall: physical.UnixMilli() - 60000, Node: "device"}
+	if merged, err := clock.Update(behind); err != nil || merged.Wall != remote.Wall {
+		t.Errorf("Update(%v) = %v, %v", behind, merged, err)
+	}
+
+	// Physical time past every timestamp seen resets the counter
+	physical = physical.Add(time.Hour)
+	if now := clock.Now(); now.Wall != physical.UnixMilli() || now.Logical != 0 {
+		t.Errorf("Now() = %v, want physical time", now)
+	}
+
+	ahead := HLCTimestamp{Wall: physical.Add(2 * time.Minute).UnixMilli(), Node: "device"}
+	if _, err := clock.Update(ahead); !errors.Is(err, ErrClockDrift) {
+		t.Errorf("Update of drifted timestamp: err = %v, want ErrClockDrift", err)
+	}
+}
+
+func TestHLCTextOrder(t *testing.T) {
+	timestamps := []HLCTimestamp{
+		{Wall: 999_999_999_999, Logical: 99999, Node: "a"},
+		{Wall: 1_700_000_000_000, Node: "b"},
+		{Wall: 1_700_000_000_000, Logical: 2, Node: "a"},
+		{Wall: 1_700_000_000_000, Logical: 10, Node: "a"},
+		{Wall: 1_700_000_000_000, Logical: 10, Node: "b-2"},
+	}
+	for i, ts := range timestamps {
+		parsed, err := ParseHLC(ts.String())
+		if err != nil || parsed != ts {
+			t.Errorf("ParseHLC(%q) = %v, %v", ts.String(), parsed, err)
+		}
+		if i > 0 {
+			prev := timestamps[i-1]
+			if !prev.Before(ts) || prev.String() >= ts.String() {
+				t.Errorf("%v does not order before %v", prev, ts)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "1700000000000", "1700000000000-00001", "170000000000-00001-a", "1700000000000-0000x-a"} {
+		if _, err := ParseHLC(s); err == nil {
+			t.Errorf("ParseHLC(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/database"
+)
+
+// LeaderElector picks one sync-engine replica per tenant database to capture
+// changes, using a PostgreSQL advisory lock. Standby replicas retry the lock
+// and take over when the leader's session ends.
+type LeaderElector struct {
+	db       *database.DB
+	lockName string
+	interval time.Duration
+	leader   atomic.Bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewLeaderElector creates a new leader elector
+func NewLeaderElector(db *database.DB, cfg *config.LeaderConfig) *LeaderElector {
+	interval, err := time.ParseDuration(cfg.CheckInterval)
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	return &LeaderElector{
+		db:       db,
+		lockName: cfg.LockName,
+		interval: interval,
+	}
+}
+
+// Start campaigns for leadership in the background. While this replica is the
+// leader, lead runs with a context that is cancelled when leadership is lost;
+// lead must return once its work has stopped. If lead returns early the
+// replica steps down so another one can take over.
+func (e *LeaderElector) Start(ctx context.Context, lead func(ctx context.Context)) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+		for {
+			lock, err := e.db.TryLeaderLock(ctx, e.lockName)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Leader election failed: %v", err)
+			}
+			if lock != nil {
+				e.hold(ctx, lock, lead)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.interval):
+			}
+		}
+	}()
+}
+
+// Stop steps down and stops campaigning, waiting for lead to return
+func (e *LeaderElector) Stop() {
+	if e.cancel != nil {
+		e.cancel()
+		<-e.done
+	}
+}
+
+// IsLeader reports whether this replica currently holds the leader lock
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// hold runs lead while the lock's session stays alive
+func (e *LeaderElector) hold(ctx context.Context, lock *database.LeaderLock, lead func(ctx context.Context)) {
+	log.Printf("Elected leader (lock %s)", e.lockName)
+	e.leader.Store(true)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for leadCtx.Err() == nil {
+		select {
+		case <-leadCtx.Done():
+		case <-done:
+			log.Printf("Leader work stopped, stepping down")
+			cancel()
+		case <-ticker.C:
+			checkCtx, checkCancel := context.WithTimeout(leadCtx, e.interval)
+			err := lock.Check(checkCtx)
+			checkCancel()
+			if err != nil && leadCtx.Err() == nil {
+				// Another replica may already hold the lock
+				log.Printf("Lost leader lock %s: %v", e.lockName, err)
+				cancel()
+			}
+		}
+	}
+
+	<-done
+	e.leader.Store(false)
+	lock.Release(context.Background())
+	log.Printf("No longer leader (lock %s)", e.lockName)
+}
@@ -3,6 +3,7 @@ package sync
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"posduif/sync-engine/internal/database"
@@ -10,19 +11,28 @@ import (
 )
 
 type Manager struct {
-	db            *database.DB
-	changeTracker *ChangeTracker
-	walEnabled    bool
+	db        *database.DB
+	source    ChangeSource
+	conflicts *ConflictResolver
+	clock     *HLCClock
+	cursors   *cursorSigner
 }
 
-func NewManager(db *database.DB, changeTracker *ChangeTracker, walEnabled bool) *Manager {
+func NewManager(db *database.DB, source ChangeSource, conflicts *ConflictResolver, clock *HLCClock, cursorSecret string) *Manager {
 	return &Manager{
-		db:            db,
-		changeTracker: changeTracker,
-		walEnabled:    walEnabled,
+		db:        db,
+		source:    source,
+		conflicts: conflicts,
+		clock:     clock,
+		cursors:   newCursorSigner(cursorSecret),
 	}
 }
 
+// HLC returns a timestamp of the server clock for a sync response
+func (m *Manager) HLC() string {
+	return m.clock.Now().String()
+}
+
 func (m *Manager) PerformSync(ctx context.Context, deviceID string) error {
 	// Update sync status to syncing
 	sm, err := m.db.GetSyncMetadata(ctx, deviceID)
@@ -37,7 +47,7 @@ func (m *Manager) PerformSync(ctx context.Context, deviceID string) error {
 	m.db.UpdateSyncMetadata(ctx, sm)
 
 	// Sync incoming messages
-	_, err = m.SyncIncoming(ctx, deviceID, 100)
+	_, err = m.SyncIncoming(ctx, deviceID, "", 100)
 	if err != nil {
 		sm.SyncStatus = "error"
 		m.db.UpdateSyncMetadata(ctx, sm)
@@ -54,104 +64,44 @@ func (m *Manager) PerformSync(ctx context.Context, deviceID string) error {
 	return nil
 }
 
-func (m *Manager) SyncIncoming(ctx context.Context, deviceID string, limit int) ([]models.Message, error) {
-	if m.walEnabled {
-		return m.syncIncomingWAL(ctx, deviceID, limit)
-	}
-	return m.syncIncomingPolling(ctx, deviceID, limit)
-}
-
-// syncIncomingWAL syncs incoming messages using WAL-based change detection
-func (m *Manager) syncIncomingWAL(ctx context.Context, deviceID string, limit int) ([]models.Message, error) {
-	// Get WAL changes for this device
-	changes, err := m.changeTracker.GetChangesForDevice(ctx, deviceID, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get WAL changes: %w", err)
-	}
-
-	// Convert WAL changes to messages
-	messages := make([]models.Message, 0, len(changes))
-	var maxLSN models.LSN
-
-	for _, change := range changes {
-		msg, err := ConvertWALChangeToMessage(change)
-		if err != nil {
-			// Skip invalid changes
-			continue
-		}
-
-		messages = append(messages, *msg)
-		if change.LSN > maxLSN {
-			maxLSN = change.LSN
+// SyncIncoming returns the next page of incoming changes for a device with its
+// signed cursor. A device resuming from a saved cursor passes it to confirm the
+// page it applied before the next one is read.
+func (m *Manager) SyncIncoming(ctx context.Context, deviceID string, cursor string, limit int) (*models.IncomingChanges, error) {
+	if cursor != "" {
+		if err := m.AckIncoming(ctx, deviceID, cursor); err != nil {
+			return nil, err
 		}
 	}
 
-	// Update sync metadata with the latest LSN
-	if len(messages) > 0 {
-		sm, err := m.db.GetSyncMetadata(ctx, deviceID)
-		if err != nil {
-			sm = &models.SyncMetadata{
-				DeviceID:   deviceID,
-				SyncStatus: "syncing",
-			}
-		}
-
-		// Update LSN - convert models.LSN to string
-		lsnStr := maxLSN.String()
-		sm.LastSyncedLSN = &lsnStr
-
-		now := time.Now()
-		sm.LastSyncTimestamp = &now
-		sm.SyncStatus = "idle"
-
-		if err := m.db.UpdateSyncMetadata(ctx, sm); err != nil {
-			return nil, fmt.Errorf("failed to update sync metadata: %w", err)
-		}
-
-		// Clear synced changes from tracker
-		if err := m.changeTracker.ClearChangesForDevice(ctx, deviceID, maxLSN); err != nil {
-			// Log error but don't fail sync
-		}
+	incoming, err := m.source.IncomingChanges(ctx, deviceID, limit)
+	if err != nil {
+		return nil, err
 	}
-
-	return messages, nil
+	sortIncomingByHLC(incoming)
+	incoming.Cursor = m.cursors.seal(deviceID, incoming.Cursor)
+	return incoming, nil
 }
 
-// syncIncomingPolling syncs incoming messages using the old polling-based approach
-func (m *Manager) syncIncomingPolling(ctx context.Context, deviceID string, limit int) ([]models.Message, error) {
-	messages, err := m.db.GetPendingMessagesForDevice(ctx, deviceID, limit)
+// AckIncoming confirms that a device applied the incoming page identified by cursor
+func (m *Manager) AckIncoming(ctx context.Context, deviceID string, cursor string) error {
+	plain, err := m.cursors.open(deviceID, cursor)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pending messages: %w", err)
-	}
-
-	// Update status to synced
-	for _, msg := range messages {
-		if err := m.db.UpdateMessageStatus(ctx, msg.ID, "synced"); err != nil {
-			return nil, fmt.Errorf("failed to update message status: %w", err)
-		}
+		return err
 	}
-
-	return messages, nil
+	return m.source.Acknowledge(ctx, deviceID, plain)
 }
 
-func (m *Manager) SyncOutgoing(ctx context.Context, messages []models.Message) (int, int, []models.FailedMessage) {
-	syncedCount := 0
-	failedCount := 0
-	var failedMessages []models.FailedMessage
-
-	for _, msg := range messages {
-		if err := m.db.CreateMessage(ctx, &msg); err != nil {
-			failedCount++
-			failedMessages = append(failedMessages, models.FailedMessage{
-				MessageID: msg.ID,
-				Error:     err.Error(),
-			})
-		} else {
-			syncedCount++
-		}
-	}
-
-	return syncedCount, failedCount, failedMessages
+// sortIncomingByHLC orders a page by hybrid logical clock. The text form of a
+// timestamp sorts in timestamp order.
+func sortIncomingByHLC(incoming *models.IncomingChanges) {
+	sort.SliceStable(incoming.Messages, func(i, j int) bool {
+		return incoming.Messages[i].HLC < incoming.Messages[j].HLC
+	})
+	sort.SliceStable(incoming.Records, func(i, j int) bool {
+		return incoming.Records[i].HLC < incoming.Records[j].HLC
+	})
+	sort.SliceStable(incoming.Tombstones, func(i, j int) bool {
+		return incoming.Tombstones[i].HLC < incoming.Tombstones[j].HLC
+	})
 }
-
-
@@ -0,0 +1,277 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+)
+
+// notifyTxnIdle is how long to wait for more notifications of the same
+// transaction before handing it to the tracker. PostgreSQL delivers all
+// notifications of a transaction together at commit.
+const notifyTxnIdle = 50 * time.Millisecond
+
+// NotifyChangeSource detects changes with row triggers and LISTEN/NOTIFY.
+// It works on managed PostgreSQL where replication slots are not allowed.
+// Notifications sent while the listener is disconnected are not replayed.
+type NotifyChangeSource struct {
+	trackedIncoming
+	cfg           *config.NotifyConfig
+	retryAttempts int
+	retryBackoff  time.Duration
+	cancel        context.CancelFunc
+	done          chan struct{} // Closed once the listener has stopped
+
+	// Monotonic position assigned to each transaction, seeded from the WAL
+	// position reported by the trigger so device LSNs stay comparable across restarts
+	lastLSN models.LSN
+}
+
+// notifyPayload is the JSON document sent by posduif_notify_change()
+type notifyPayload struct {
+	Op        string                 `json:"op"`
+	Schema    string                 `json:"schema"`
+	Table     string                 `json:"table"`
+	XID       string                 `json:"xid"`
+	LSN       string                 `json:"lsn"`
+	Timestamp time.Time              `json:"ts"`
+	Row       map[string]interface{} `json:"row"`
+	Old       map[string]interface{} `json:"old"`
+	Truncated bool                   `json:"truncated"`
+	Key       map[string]interface{} `json:"key"` // Primary key of a truncated row
+}
+
+// NewNotifyChangeSource creates a LISTEN/NOTIFY change source. Transactions
+// that fail to queue are retried sync.retry_attempts times with exponential
+// backoff from sync.retry_backoff.
+func NewNotifyChangeSource(db *database.DB, changeTracker *ChangeTracker, snapshots *SnapshotManager, cfg *config.SyncConfig) *NotifyChangeSource {
+	retryBackoff, err := time.ParseDuration(cfg.RetryBackoff)
+	if err != nil || retryBackoff <= 0 {
+		retryBackoff = 2 * time.Second
+	}
+
+	return &NotifyChangeSource{
+		trackedIncoming: trackedIncoming{db: db, changeTracker: changeTracker, snapshots: snapshots},
+		cfg:             &cfg.Notify,
+		retryAttempts:   cfg.RetryAttempts,
+		retryBackoff:    retryBackoff,
+	}
+}
+
+func (s *NotifyChangeSource) Name() string {
+	return ChangeSourceNotify
+}
+
+// Start installs the notify triggers and starts listening in the background
+func (s *NotifyChangeSource) Start(ctx context.Context) error {
+	if err := s.db.EnsureNotifyTriggers(ctx, s.cfg.Channel, s.cfg.Tables); err != nil {
+		return err
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.run(ctx)
+	}()
+	return nil
+}
+
+// Stop stops listening and waits until the listening connection is closed
+func (s *NotifyChangeSource) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// run keeps a listening connection open, reconnecting after failures
+func (s *NotifyChangeSource) run(ctx context.Context) {
+	for {
+		if err := s.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error listening for change notifications: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// listen receives notifications and groups them into transactions by xid
+func (s *NotifyChangeSource) listen(ctx context.Context) error {
+	conn, err := s.db.ListenConn(ctx, s.cfg.Channel)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	log.Printf("Listening for change notifications on %s", s.cfg.Channel)
+
+	var pending []*notifyPayload
+	for {
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+		if len(pending) > 0 {
+			waitCtx, cancel = context.WithTimeout(ctx, notifyTxnIdle)
+		}
+		notification, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if pgconn.Timeout(err) {
+				s.flush(ctx, pending)
+				pending = nil
+				continue
+			}
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+
+		var payload notifyPayload
+		if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			log.Printf("Ignoring malformed change notification: %v", err)
+			continue
+		}
+
+		if len(pending) > 0 && pending[0].XID != payload.XID {
+			s.flush(ctx, pending)
+			pending = nil
+		}
+		pending = append(pending, &payload)
+	}
+}
+
+// flush converts one transaction's notifications to changes and adds them to the tracker
+func (s *NotifyChangeSource) flush(ctx context.Context, payloads []*notifyPayload) {
+	if len(payloads) == 0 {
+		return
+	}
+
+	position := s.lastLSN + 1
+	for _, payload := range payloads {
+		if lsn, err := models.ParseLSN(payload.LSN); err == nil && lsn > position {
+			position = lsn
+		}
+	}
+	s.lastLSN = position
+
+	xid, _ := strconv.ParseUint(payloads[0].XID, 10, 64)
+	changes := make([]*WALChange, 0, len(payloads))
+	for _, payload := range payloads {
+		change, err := s.toChange(ctx, payload)
+		if err != nil {
+			log.Printf("Skipping change notification for %s.%s: %v", payload.Schema, payload.Table, err)
+			continue
+		}
+		change.LSN = position
+		change.XID = uint32(xid)
+		changes = append(changes, change)
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+	if err := s.addTransaction(ctx, changes); err != nil {
+		s.resyncAfterLoss(ctx, payloads[0].XID, changes, err)
+	}
+}
+
+// addTransaction hands a transaction to the tracker, retrying with exponential
+// backoff. Notifications are not replayed, so there is no later chance to queue it.
+func (s *NotifyChangeSource) addTransaction(ctx context.Context, changes []*WALChange) error {
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.changeTracker.AddTransaction(ctx, changes)
+		if err == nil || attempt >= s.retryAttempts {
+			return err
+		}
+		log.Printf("Failed to track notified transaction, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// resyncAfterLoss marks the devices a transaction is routed to for a full
+// resync after it could not be queued, since a resync is the only way they can
+// still receive the change. If the routing fails too, the affected devices are
+// unknown and every device is marked.
+func (s *NotifyChangeSource) resyncAfterLoss(ctx context.Context, xid string, changes []*WALChange, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	deviceIDs, routeErr := s.changeTracker.RouteDevices(ctx, changes)
+	if routeErr != nil {
+		log.Printf("Failed to track notified transaction %s, marking all devices for full resync: %v (routing: %v)", xid, err, routeErr)
+		count, err := s.db.MarkDevicesForFullResync(ctx)
+		if err != nil {
+			log.Printf("Failed to mark devices for full resync, transaction %s is lost: %v", xid, err)
+			return
+		}
+		log.Printf("Marked %d devices for full resync", count)
+		return
+	}
+
+	if len(deviceIDs) == 0 {
+		return
+	}
+	log.Printf("Failed to track notified transaction %s, marking %d devices for full resync: %v", xid, len(deviceIDs), err)
+	if err := s.db.RequestFullResyncs(ctx, deviceIDs); err != nil {
+		log.Printf("Failed to mark devices for full resync, transaction %s is lost: %v", xid, err)
+	}
+}
+
+// toChange converts a notification payload to a WALChange, reloading rows
+// that were too large to fit in the payload
+func (s *NotifyChangeSource) toChange(ctx context.Context, payload *notifyPayload) (*WALChange, error) {
+	change := &WALChange{
+		Schema:     payload.Schema,
+		Table:      payload.Table,
+		Operation:  payload.Op,
+		Columns:    payload.Row,
+		OldColumns: payload.Old,
+		CommitTime: payload.Timestamp,
+	}
+
+	if !payload.Truncated {
+		return change, nil
+	}
+
+	// Truncated payloads keep the primary key and the small old columns,
+	// which is enough to route a delete
+	key := payload.Key
+	if change.OldColumns == nil {
+		change.OldColumns = map[string]interface{}{}
+	}
+	for column, value := range key {
+		change.OldColumns[column] = value
+	}
+	if payload.Op == "DELETE" {
+		return change, nil
+	}
+
+	rowJSON, err := s.db.GetRowJSON(ctx, payload.Schema+"."+payload.Table, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload row %v: %w", key, err)
+	}
+	if change.Columns, err = database.DecodeColumns(rowJSON); err != nil {
+		return nil, fmt.Errorf("failed to decode row %v: %w", key, err)
+	}
+	return change, nil
+}
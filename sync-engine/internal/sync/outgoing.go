@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"posduif/sync-engine/internal/models"
+)
+
+// messageStatuses are the statuses a message can be stored with
+var messageStatuses = map[string]bool{"": true, "pending_sync": true, "synced": true, "read": true}
+
+// SyncOutgoing stores the messages uploaded by a device and returns the outcome
+// of each, in order. Messages are keyed on their client-generated IDs, so a
+// device can upload the same message again until it sees a final outcome.
+// Messages with a base_hlc are edits, which go through the conflict
+// resolver.
+func (m *Manager) SyncOutgoing(ctx context.Context, deviceID string, messages []models.Message) ([]models.MessageUploadResult, error) {
+	userID, err := m.db.GetDeviceUserID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.MessageUploadResult, 0, len(messages))
+	for _, msg := range messages {
+		result := models.MessageUploadResult{MessageID: msg.ID}
+		if reason := normalizeUpload(&msg, userID); reason != "" {
+			result.Outcome = models.UploadRejected
+			result.Reason = reason
+			results = append(results, result)
+			continue
+		}
+
+		// Merge the device's clock; a message without an HLC, or with one too
+		// far ahead of the server, is stamped by the server
+		if hlc, err := ParseHLC(msg.HLC); err == nil {
+			if _, err := m.clock.Update(hlc); err != nil {
+				log.Printf("Restamping message %s from device %s: %v", msg.ID, deviceID, err)
+				msg.HLC = m.clock.Now().String()
+			}
+		} else {
+			msg.HLC = m.clock.Now().String()
+		}
+
+		if msg.BaseHLC != "" {
+			if result, err = m.conflicts.ApplyUpdate(ctx, deviceID, &msg); err != nil {
+				log.Printf("Failed to apply edit of message %s from device %s: %v", msg.ID, deviceID, err)
+				result.Outcome = models.UploadRejected
+				result.Reason = models.RejectInternalError
+			}
+			results = append(results, result)
+			continue
+		}
+
+		result.Outcome, err = m.db.InsertUploadedMessage(ctx, &msg)
+		if err != nil {
+			result.Outcome = models.UploadRejected
+			result.Reason = uploadErrorReason(err)
+			if result.Reason == models.RejectInternalError {
+				log.Printf("Failed to store message %s from device %s: %v", msg.ID, deviceID, err)
+			}
+		}
+		if result.Outcome == models.UploadCreated || result.Outcome == models.UploadDuplicate {
+			result.HLC = msg.HLC
+		}
+		if result.Outcome == models.UploadCreated {
+			// Update sender's last_message_sent
+			sender, err := m.db.GetUserByID(ctx, msg.SenderID)
+			if err == nil {
+				sender.LastMessageSent = &msg.Content
+				m.db.UpdateUser(ctx, sender)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// normalizeUpload checks an uploaded message sent by userID and brings its IDs
+// to canonical form, so that replays compare equal. It returns the reason code
+// if the message is rejected.
+func normalizeUpload(msg *models.Message, userID string) string {
+	if msg.ID == "" {
+		return models.RejectMissingID
+	}
+	id, err := uuid.Parse(msg.ID)
+	if err != nil {
+		return models.RejectInvalidID
+	}
+	msg.ID = id.String()
+
+	// A message without a sender is sent by the device's user
+	if msg.SenderID == "" {
+		msg.SenderID = userID
+	}
+	if senderID, err := uuid.Parse(msg.SenderID); err != nil || senderID.String() != userID {
+		return models.RejectSenderMismatch
+	}
+	msg.SenderID = userID
+
+	recipientID, err := uuid.Parse(msg.RecipientID)
+	if err != nil {
+		return models.RejectInvalidRecipient
+	}
+	msg.RecipientID = recipientID.String()
+
+	if msg.Content == "" {
+		return models.RejectEmptyContent
+	}
+	if !messageStatuses[msg.Status] {
+		return models.RejectInvalidStatus
+	}
+	for _, hlc := range []string{msg.HLC, msg.BaseHLC} {
+		if hlc == "" {
+			continue
+		}
+		if _, err := ParseHLC(hlc); err != nil {
+			return models.RejectInvalidHLC
+		}
+	}
+	return ""
+}
+
+// uploadErrorReason maps a failed insert to a reason code
+func uploadErrorReason(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" && pgErr.ConstraintName == "messages_recipient_id_fkey" {
+		return models.RejectUnknownRecipient
+	}
+	return models.RejectInternalError
+}
@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"testing"
+
+	"posduif/sync-engine/internal/models"
+)
+
+func TestNormalizeUpload(t *testing.T) {
+	const userID = "6f1c2a9e-3b7d-4c1e-9a55-0d2f8b4e7c31"
+	const recipientID = "a2d4e6f8-1b3c-4d5e-8f70-9a1b2c3d4e5f"
+	valid := func() models.Message {
+		return models.Message{
+			ID:          "0F6E2C4A-8B1D-4E3F-A5C7-9D0B2E4F6A81",
+			RecipientID: recipientID,
+			Content:     "hi",
+			Status:      "pending_sync",
+		}
+	}
+
+	msg := valid()
+	if reason := normalizeUpload(&msg, userID); reason != "" {
+		t.Fatalf("valid message rejected: %s", reason)
+	}
+	if msg.ID != "0f6e2c4a-8b1d-4e3f-a5c7-9d0b2e4f6a81" || msg.SenderID != userID {
+		t.Errorf("normalized message = %+v", msg)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.Message)
+		reason string
+	}{
+		{"missing id", func(m *models.Message) { m.ID = "" }, models.RejectMissingID},
+		{"invalid id", func(m *models.Message) { m.ID = "42" }, models.RejectInvalidID},
+		{"other sender", func(m *models.Message) { m.SenderID = recipientID }, models.RejectSenderMismatch},
+		{"invalid sender", func(m *models.Message) { m.SenderID = "me" }, models.RejectSenderMismatch},
+		{"no recipient", func(m *models.Message) { m.RecipientID = "" }, models.RejectInvalidRecipient},
+		{"empty content", func(m *models.Message) { m.Content = "" }, models.RejectEmptyContent},
+		{"invalid status", func(m *models.Message) { m.Status = "sent" }, models.RejectInvalidStatus},
+		{"invalid hlc", func(m *models.Message) { m.HLC = "2026-03-01T12:00:00Z" }, models.RejectInvalidHLC},
+	}
+	for _, tt := range tests {
+		msg := valid()
+		tt.modify(&msg)
+		if reason := normalizeUpload(&msg, userID); reason != tt.reason {
+			t.Errorf("%s: reason = %q, want %q", tt.name, reason, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// pgoutput protocol decoding.
+// Message formats: https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html
+
+// pgEpoch is the PostgreSQL timestamp epoch (2000-01-01 UTC)
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// pgTimeToTime converts microseconds since the PostgreSQL epoch to a time.Time
+func pgTimeToTime(micros int64) time.Time {
+	return pgEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+// timeToPgTime converts a time.Time to microseconds since the PostgreSQL epoch
+func timeToPgTime(t time.Time) int64 {
+	return t.Sub(pgEpoch).Microseconds()
+}
+
+// relationColumn describes a single column of a relation message
+type relationColumn struct {
+	Key     bool // Part of the replica identity
+	Name    string
+	TypeOID uint32
+	TypeMod int32
+}
+
+// relation holds the table metadata sent in pgoutput 'R' messages
+type relation struct {
+	ID              uint32
+	Namespace       string
+	Name            string
+	ReplicaIdentity byte
+	Columns         []relationColumn
+}
+
+// keyColumns returns the columns of the relation's replica identity key. With
+// REPLICA IDENTITY FULL every column is flagged, so none are returned.
+func (rel *relation) keyColumns() []string {
+	if rel.ReplicaIdentity == 'f' {
+		return nil
+	}
+	var columns []string
+	for _, col := range rel.Columns {
+		if col.Key {
+			columns = append(columns, col.Name)
+		}
+	}
+	return columns
+}
+
+// tupleColumn is a single column value from pgoutput tuple data
+type tupleColumn struct {
+	Kind byte // 'n' null, 'u' unchanged TOAST, 't' text, 'b' binary
+	Data []byte
+}
+
+// messageReader reads pgoutput fields from a byte slice.
+// The first short read is remembered in err so callers can check once at the end.
+type messageReader struct {
+	data []byte
+	err  error
+}
+
+func (m *messageReader) next(n int) []byte {
+	if m.err != nil {
+		return nil
+	}
+	if len(m.data) < n {
+		m.err = fmt.Errorf("pgoutput message truncated: need %d bytes, have %d", n, len(m.data))
+		return nil
+	}
+	b := m.data[:n]
+	m.data = m.data[n:]
+	return b
+}
+
+func (m *messageReader) uint8() uint8 {
+	b := m.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (m *messageReader) uint16() uint16 {
+	b := m.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (m *messageReader) uint32() uint32 {
+	b := m.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (m *messageReader) uint64() uint64 {
+	b := m.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (m *messageReader) cstring() string {
+	if m.err != nil {
+		return ""
+	}
+	idx := bytes.IndexByte(m.data, 0)
+	if idx < 0 {
+		m.err = fmt.Errorf("pgoutput message truncated: unterminated string")
+		return ""
+	}
+	s := string(m.data[:idx])
+	m.data = m.data[idx+1:]
+	return s
+}
+
+// tuple reads a TupleData structure
+func (m *messageReader) tuple() []tupleColumn {
+	n := int(m.uint16())
+	columns := make([]tupleColumn, 0, n)
+	for i := 0; i < n && m.err == nil; i++ {
+		col := tupleColumn{Kind: m.uint8()}
+		switch col.Kind {
+		case 'n', 'u':
+		case 't', 'b':
+			length := int(m.uint32())
+			col.Data = m.next(length)
+		default:
+			m.err = fmt.Errorf("unknown tuple column kind %q", col.Kind)
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// parseRelationMessage parses the body of an 'R' message
+func parseRelationMessage(data []byte) (*relation, error) {
+	m := &messageReader{data: data}
+	rel := &relation{
+		ID:              m.uint32(),
+		Namespace:       m.cstring(),
+		Name:            m.cstring(),
+		ReplicaIdentity: m.uint8(),
+	}
+	n := int(m.uint16())
+	for i := 0; i < n && m.err == nil; i++ {
+		rel.Columns = append(rel.Columns, relationColumn{
+			Key:     m.uint8()&1 == 1,
+			Name:    m.cstring(),
+			TypeOID: m.uint32(),
+			TypeMod: int32(m.uint32()),
+		})
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse relation message: %w", m.err)
+	}
+	return rel, nil
+}
+
+// beginMessage is the body of a 'B' message
+type beginMessage struct {
+	FinalLSN   uint64
+	CommitTime time.Time
+	XID        uint32
+}
+
+// parseBeginMessage parses the body of a 'B' message
+func parseBeginMessage(data []byte) (*beginMessage, error) {
+	m := &messageReader{data: data}
+	msg := &beginMessage{
+		FinalLSN:   m.uint64(),
+		CommitTime: pgTimeToTime(int64(m.uint64())),
+		XID:        m.uint32(),
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse begin message: %w", m.err)
+	}
+	return msg, nil
+}
+
+// commitMessage is the body of a 'C' message
+type commitMessage struct {
+	CommitLSN  uint64
+	EndLSN     uint64
+	CommitTime time.Time
+}
+
+// parseCommitMessage parses the body of a 'C' message
+func parseCommitMessage(data []byte) (*commitMessage, error) {
+	m := &messageReader{data: data}
+	m.uint8() // flags, currently unused
+	msg := &commitMessage{
+		CommitLSN:  m.uint64(),
+		EndLSN:     m.uint64(),
+		CommitTime: pgTimeToTime(int64(m.uint64())),
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse commit message: %w", m.err)
+	}
+	return msg, nil
+}
+
+// streamStartMessage is the body of an 'S' message
+type streamStartMessage struct {
+	XID   uint32
+	First bool // First chunk of the transaction
+}
+
+// parseStreamStartMessage parses the body of an 'S' message
+func parseStreamStartMessage(data []byte) (*streamStartMessage, error) {
+	m := &messageReader{data: data}
+	msg := &streamStartMessage{
+		XID:   m.uint32(),
+		First: m.uint8() == 1,
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse stream start message: %w", m.err)
+	}
+	return msg, nil
+}
+
+// streamCommitMessage is the body of a 'c' message
+type streamCommitMessage struct {
+	XID uint32
+	commitMessage
+}
+
+// parseStreamCommitMessage parses the body of a 'c' message
+func parseStreamCommitMessage(data []byte) (*streamCommitMessage, error) {
+	m := &messageReader{data: data}
+	msg := &streamCommitMessage{XID: m.uint32()}
+	m.uint8() // flags, currently unused
+	msg.CommitLSN = m.uint64()
+	msg.EndLSN = m.uint64()
+	msg.CommitTime = pgTimeToTime(int64(m.uint64()))
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse stream commit message: %w", m.err)
+	}
+	return msg, nil
+}
+
+// streamAbortMessage is the body of an 'A' message
+type streamAbortMessage struct {
+	XID    uint32
+	SubXID uint32 // Equal to XID when the whole transaction was rolled back
+}
+
+// parseStreamAbortMessage parses the body of an 'A' message
+func parseStreamAbortMessage(data []byte) (*streamAbortMessage, error) {
+	m := &messageReader{data: data}
+	msg := &streamAbortMessage{
+		XID:    m.uint32(),
+		SubXID: m.uint32(),
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse stream abort message: %w", m.err)
+	}
+	return msg, nil
+}
+
+// rowMessage is the body of an 'I', 'U' or 'D' message
+type rowMessage struct {
+	RelationID uint32
+	OldTuple   []tupleColumn // Old key ('K') or full old row ('O'), if sent
+	NewTuple   []tupleColumn
+}
+
+// parseRowMessage parses the body of an INSERT, UPDATE or DELETE message
+func parseRowMessage(msgType byte, data []byte) (*rowMessage, error) {
+	m := &messageReader{data: data}
+	msg := &rowMessage{RelationID: m.uint32()}
+
+	marker := m.uint8()
+	if msgType != 'I' && (marker == 'K' || marker == 'O') {
+		msg.OldTuple = m.tuple()
+		if msgType == 'U' {
+			marker = m.uint8()
+		}
+	}
+	if msgType == 'D' {
+		if msg.OldTuple == nil && m.err == nil {
+			m.err = fmt.Errorf("expected old tuple marker, got %q", marker)
+		}
+	} else {
+		if marker != 'N' && m.err == nil {
+			m.err = fmt.Errorf("expected new tuple marker, got %q", marker)
+		}
+		msg.NewTuple = m.tuple()
+	}
+
+	if m.err != nil {
+		return nil, fmt.Errorf("failed to parse row message: %w", m.err)
+	}
+	return msg, nil
+}
+
+// decodeTuple maps tuple columns to column names using the relation metadata,
+// converting text values by column type. Unchanged TOAST values are omitted
+// because pgoutput does not send them.
+func decodeTuple(rel *relation, tuple []tupleColumn, types *TypeDecoder) (map[string]interface{}, error) {
+	if len(tuple) > len(rel.Columns) {
+		return nil, fmt.Errorf("tuple for %s.%s has %d columns, relation has %d",
+			rel.Namespace, rel.Name, len(tuple), len(rel.Columns))
+	}
+
+	values := make(map[string]interface{}, len(tuple))
+	for i, col := range tuple {
+		name := rel.Columns[i].Name
+		switch col.Kind {
+		case 'n':
+			values[name] = nil
+		case 't':
+			values[name] = types.Decode(rel.Columns[i].TypeOID, col.Data)
+		case 'b':
+			values[name] = col.Data
+		}
+	}
+	return values, nil
+}
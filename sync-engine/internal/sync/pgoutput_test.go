@@ -0,0 +1,390 @@
+package sync
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/models"
+)
+
+// pgoutputBuilder assembles pgoutput messages for tests
+type pgoutputBuilder struct {
+	buf []byte
+}
+
+func (b *pgoutputBuilder) byte(v byte) *pgoutputBuilder {
+	b.buf = append(b.buf, v)
+	return b
+}
+
+func (b *pgoutputBuilder) uint16(v uint16) *pgoutputBuilder {
+	b.buf = binary.BigEndian.AppendUint16(b.buf, v)
+	return b
+}
+
+func (b *pgoutputBuilder) uint32(v uint32) *pgoutputBuilder {
+	b.buf = binary.BigEndian.AppendUint32(b.buf, v)
+	return b
+}
+
+func (b *pgoutputBuilder) uint64(v uint64) *pgoutputBuilder {
+	b.buf = binary.BigEndian.AppendUint64(b.buf, v)
+	return b
+}
+
+func (b *pgoutputBuilder) cstring(s string) *pgoutputBuilder {
+	b.buf = append(append(b.buf, s...), 0)
+	return b
+}
+
+// tuple appends TupleData where nil values are sent as NULL
+func (b *pgoutputBuilder) tuple(values ...*string) *pgoutputBuilder {
+	b.uint16(uint16(len(values)))
+	for _, v := range values {
+		if v == nil {
+			b.byte('n')
+			continue
+		}
+		b.byte('t').uint32(uint32(len(*v)))
+		b.buf = append(b.buf, *v...)
+	}
+	return b
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func messagesRelation() []byte {
+	b := &pgoutputBuilder{}
+	b.byte('R').uint32(16384).cstring("public").cstring("messages").byte('d').uint16(4)
+	b.byte(1).cstring("id").uint32(2950).uint32(0xFFFFFFFF)
+	b.byte(0).cstring("sender_id").uint32(2950).uint32(0xFFFFFFFF)
+	b.byte(0).cstring("recipient_id").uint32(2950).uint32(0xFFFFFFFF)
+	b.byte(0).cstring("content").uint32(25).uint32(0xFFFFFFFF)
+	return b.buf
+}
+
+func newTestReader(t *testing.T) *WALReader {
+	t.Helper()
+	r := NewWALReader(nil, "test_slot", &config.WALConfig{Publication: "posduif_sync"}, nil, nil)
+	if _, err := r.parsePgoutputMessage(0, messagesRelation()); err != nil {
+		t.Fatalf("relation message: %v", err)
+	}
+	return r
+}
+
+func beginMsg(xid uint32) []byte {
+	return (&pgoutputBuilder{}).byte('B').uint64(0x500).uint64(1_000_000).uint32(xid).buf
+}
+
+func commitMsg(commitLSN uint64, commitMicros uint64) []byte {
+	return (&pgoutputBuilder{}).byte('C').byte(0).uint64(commitLSN).uint64(commitLSN + 0x10).uint64(commitMicros).buf
+}
+
+// streamTransaction feeds BEGIN, the row messages and COMMIT to the reader and
+// returns the committed changes
+func streamTransaction(t *testing.T, r *WALReader, rows ...[]byte) []*WALChange {
+	t.Helper()
+	if _, err := r.parsePgoutputMessage(0, beginMsg(42)); err != nil {
+		t.Fatalf("begin message: %v", err)
+	}
+	for _, row := range rows {
+		txn, err := r.parsePgoutputMessage(0, row)
+		if err != nil {
+			t.Fatalf("row message: %v", err)
+		}
+		if txn != nil {
+			t.Fatal("row message released a transaction before commit")
+		}
+	}
+	txn, err := r.parsePgoutputMessage(0, commitMsg(0x500, 2_000_000))
+	if err != nil {
+		t.Fatalf("commit message: %v", err)
+	}
+	return readBatches(t, txn)[0]
+}
+
+// readBatches reads every batch of a committed transaction and releases it
+func readBatches(t *testing.T, txn *Transaction) [][]*WALChange {
+	t.Helper()
+	if txn == nil {
+		t.Fatal("no transaction was committed")
+	}
+	defer txn.close()
+
+	var batches [][]*WALChange
+	for {
+		changes, err := txn.Next()
+		if err != nil {
+			t.Fatalf("reading transaction: %v", err)
+		}
+		if len(changes) == 0 {
+			return batches
+		}
+		batches = append(batches, changes)
+	}
+}
+
+func TestParsePgoutputInsert(t *testing.T) {
+	r := newTestReader(t)
+
+	insert := (&pgoutputBuilder{}).byte('I').uint32(16384).byte('N').
+		tuple(strPtr("m1"), strPtr("u1"), strPtr("u2"), nil).buf
+	changes := streamTransaction(t, r, insert)
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+	change := changes[0]
+
+	if change.Operation != "INSERT" || change.Schema != "public" || change.Table != "messages" {
+		t.Fatalf("unexpected change header: %+v", change)
+	}
+	if change.LSN != 0x500 || change.XID != 42 {
+		t.Errorf("LSN = %s, XID = %d, want 0/500 and 42", change.LSN, change.XID)
+	}
+	if want := pgTimeToTime(2_000_000); !change.CommitTime.Equal(want) {
+		t.Errorf("CommitTime = %v, want %v", change.CommitTime, want)
+	}
+	if change.Columns["recipient_id"] != "u2" || change.Columns["sender_id"] != "u1" {
+		t.Errorf("unexpected columns: %v", change.Columns)
+	}
+	if v, ok := change.Columns["content"]; !ok || v != nil {
+		t.Errorf("content = %v, want NULL", v)
+	}
+	if len(change.Key) != 1 || change.Key[0] != "id" {
+		t.Errorf("Key = %v, want [id]", change.Key)
+	}
+}
+
+func TestParsePgoutputUpdateAndDelete(t *testing.T) {
+	r := newTestReader(t)
+
+	update := (&pgoutputBuilder{}).byte('U').uint32(16384).
+		byte('O').tuple(strPtr("m1"), strPtr("u1"), strPtr("u2"), strPtr("old")).
+		byte('N').tuple(strPtr("m1"), strPtr("u1"), strPtr("u3"), strPtr("new")).buf
+	del := (&pgoutputBuilder{}).byte('D').uint32(16384).
+		byte('K').tuple(strPtr("m1"), nil, nil, nil).buf
+
+	changes := streamTransaction(t, r, update, del)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+
+	if changes[0].Operation != "UPDATE" {
+		t.Fatalf("Operation = %s, want UPDATE", changes[0].Operation)
+	}
+	if changes[0].OldColumns["recipient_id"] != "u2" || changes[0].Columns["recipient_id"] != "u3" {
+		t.Errorf("unexpected update columns: old=%v new=%v", changes[0].OldColumns, changes[0].Columns)
+	}
+
+	if changes[1].Operation != "DELETE" || changes[1].OldColumns["id"] != "m1" || changes[1].Columns != nil {
+		t.Errorf("unexpected delete change: %+v", changes[1])
+	}
+	if changes[0].LSN != changes[1].LSN || !changes[0].CommitTime.Equal(changes[1].CommitTime) {
+		t.Errorf("changes of one transaction carry different commit positions")
+	}
+}
+
+func TestParsePgoutputUnknownRelation(t *testing.T) {
+	r := NewWALReader(nil, "test_slot", &config.WALConfig{}, nil, nil)
+	if _, err := r.parsePgoutputMessage(0, beginMsg(1)); err != nil {
+		t.Fatalf("begin message: %v", err)
+	}
+
+	insert := (&pgoutputBuilder{}).byte('I').uint32(99).byte('N').tuple(strPtr("x")).buf
+	if _, err := r.parsePgoutputMessage(0, insert); err == nil {
+		t.Fatal("expected error for row message without relation metadata")
+	}
+}
+
+func TestParsePgoutputTruncated(t *testing.T) {
+	r := newTestReader(t)
+	if _, err := r.parsePgoutputMessage(0, beginMsg(1)); err != nil {
+		t.Fatalf("begin message: %v", err)
+	}
+
+	insert := (&pgoutputBuilder{}).byte('I').uint32(16384).byte('N').uint16(4).byte('t').uint32(10).buf
+	if _, err := r.parsePgoutputMessage(0, insert); err == nil {
+		t.Fatal("expected error for truncated tuple data")
+	}
+}
+
+// messagesRelationV2 is messagesRelation after ALTER TABLE messages ADD COLUMN priority
+func messagesRelationV2() []byte {
+	b := &pgoutputBuilder{buf: messagesRelation()}
+	binary.BigEndian.PutUint16(b.buf[1+4+len("public")+1+len("messages")+1+1:], 5)
+	b.byte(0).cstring("priority").uint32(23).uint32(0xFFFFFFFF)
+	return b.buf
+}
+
+func TestParsePgoutputSchemaChange(t *testing.T) {
+	r := NewWALReader(nil, "test_slot", &config.WALConfig{}, nil, nil)
+	if _, err := r.parsePgoutputMessage(0x100, messagesRelation()); err != nil {
+		t.Fatalf("relation message: %v", err)
+	}
+	change := r.relations.add(mustParseRelation(t, messagesRelationV2()), 0x200)
+	if change == nil || len(change.Added) != 1 || change.Added[0] != "priority" || change.Version != 2 {
+		t.Fatalf("unexpected schema change: %+v", change)
+	}
+
+	// A transaction committed after the ALTER uses the new layout
+	if _, err := r.parsePgoutputMessage(0x300, beginMsg(7)); err != nil {
+		t.Fatalf("begin message: %v", err)
+	}
+	insert := (&pgoutputBuilder{}).byte('I').uint32(16384).byte('N').
+		tuple(strPtr("m2"), strPtr("u1"), strPtr("u2"), strPtr("hi"), strPtr("3")).buf
+	if _, err := r.parsePgoutputMessage(0x300, insert); err != nil {
+		t.Fatalf("insert after ALTER: %v", err)
+	}
+
+	// A transaction that wrote before the ALTER but commits after it keeps the old layout
+	old := (&pgoutputBuilder{}).byte('I').uint32(16384).byte('N').
+		tuple(strPtr("m1"), strPtr("u1"), strPtr("u2"), strPtr("hello")).buf
+	if _, err := r.parsePgoutputMessage(0x150, old); err != nil {
+		t.Fatalf("insert before ALTER: %v", err)
+	}
+
+	txn, err := r.parsePgoutputMessage(0x400, commitMsg(0x400, 2_000_000))
+	if err != nil {
+		t.Fatalf("commit message: %v", err)
+	}
+	changes := readBatches(t, txn)[0]
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if changes[0].Columns["priority"] != int32(3) {
+		t.Errorf("new layout columns = %v", changes[0].Columns)
+	}
+	if _, ok := changes[1].Columns["priority"]; ok || changes[1].Columns["content"] != "hello" {
+		t.Errorf("old layout columns = %v", changes[1].Columns)
+	}
+
+	// Resending a known layout is not a schema change
+	if change := r.relations.add(mustParseRelation(t, messagesRelationV2()), 0x500); change != nil {
+		t.Errorf("unexpected schema change for resent layout: %+v", change)
+	}
+
+	// A tuple that does not match the layout in effect is not decoded with an older layout
+	if _, err := r.parsePgoutputMessage(0x600, beginMsg(8)); err != nil {
+		t.Fatalf("begin message: %v", err)
+	}
+	if _, err := r.parsePgoutputMessage(0x600, old); err == nil {
+		t.Error("expected error for a tuple with fewer columns than the layout")
+	}
+}
+
+func mustParseRelation(t *testing.T, msg []byte) *relation {
+	t.Helper()
+	rel, err := parseRelationMessage(msg[1:])
+	if err != nil {
+		t.Fatalf("parseRelationMessage: %v", err)
+	}
+	return rel
+}
+
+// streamed prefixes a row message with the XID sent inside stream blocks
+func streamed(xid uint32, msg []byte) []byte {
+	b := (&pgoutputBuilder{}).byte(msg[0]).uint32(xid)
+	b.buf = append(b.buf, msg[1:]...)
+	return b.buf
+}
+
+func TestParsePgoutputStreamedTransaction(t *testing.T) {
+	// One change per batch, so the streamed transaction is read back in two
+	r := NewWALReader(nil, "test_slot", &config.WALConfig{SpillDir: t.TempDir(), BatchSize: 1}, nil, nil)
+	defer r.Close(context.Background())
+	if _, err := r.parsePgoutputMessage(0, messagesRelation()); err != nil {
+		t.Fatalf("relation message: %v", err)
+	}
+
+	insert := func(id string) []byte {
+		return (&pgoutputBuilder{}).byte('I').uint32(16384).byte('N').
+			tuple(strPtr(id), strPtr("u1"), strPtr("u2"), strPtr("bulk")).buf
+	}
+	messages := [][]byte{
+		(&pgoutputBuilder{}).byte('S').uint32(50).byte(1).buf,
+		streamed(50, insert("m1")),
+		streamed(51, insert("m2")), // subtransaction, rolled back below
+		(&pgoutputBuilder{}).byte('E').buf,
+		// A small transaction commits between the chunks
+		beginMsg(60),
+		insert("m3"),
+		commitMsg(0x300, 1_000_000),
+		(&pgoutputBuilder{}).byte('S').uint32(50).byte(0).buf,
+		streamed(50, insert("m4")),
+		(&pgoutputBuilder{}).byte('E').buf,
+		(&pgoutputBuilder{}).byte('A').uint32(50).uint32(51).buf,
+		(&pgoutputBuilder{}).byte('c').uint32(50).byte(0).uint64(0x400).uint64(0x410).uint64(2_000_000).buf,
+	}
+
+	var committed [][][]*WALChange
+	for i, msg := range messages {
+		txn, err := r.parsePgoutputMessage(models.LSN(0x100+i), msg)
+		if err != nil {
+			t.Fatalf("message %d (%q): %v", i, msg[0], err)
+		}
+		if txn != nil {
+			committed = append(committed, readBatches(t, txn))
+		}
+	}
+
+	if len(committed) != 2 || len(committed[0]) != 1 || len(committed[0][0]) != 1 || committed[0][0][0].Columns["id"] != "m3" {
+		t.Fatalf("unexpected transactions: %v", committed)
+	}
+	batches := committed[1]
+	if len(batches) != 2 || len(batches[0]) != 1 || len(batches[1]) != 1 ||
+		batches[0][0].Columns["id"] != "m1" || batches[1][0].Columns["id"] != "m4" {
+		t.Fatalf("streamed transaction = %v, want m1 and m4 in separate batches", batches)
+	}
+	for _, batch := range batches {
+		change := batch[0]
+		if change.LSN != 0x400 || change.XID != 50 || !change.CommitTime.Equal(pgTimeToTime(2_000_000)) {
+			t.Errorf("change header = %+v, want commit 0/400 of XID 50", change)
+		}
+	}
+	if _, err := r.spill.commit(50); err == nil {
+		t.Error("spill file of committed transaction was not removed")
+	}
+}
+
+func TestParsePgoutputAbortedStreamRelation(t *testing.T) {
+	r := NewWALReader(nil, "test_slot", &config.WALConfig{SpillDir: t.TempDir()}, nil, nil)
+	defer r.Close(context.Background())
+	if _, err := r.parsePgoutputMessage(0x100, messagesRelation()); err != nil {
+		t.Fatalf("relation message: %v", err)
+	}
+
+	// An ALTER inside a subtransaction that is rolled back, then the whole transaction
+	messages := [][]byte{
+		(&pgoutputBuilder{}).byte('S').uint32(70).byte(1).buf,
+		streamed(71, messagesRelationV2()),
+		(&pgoutputBuilder{}).byte('E').buf,
+		(&pgoutputBuilder{}).byte('A').uint32(70).uint32(71).buf,
+	}
+	for i, msg := range messages {
+		if _, err := r.parsePgoutputMessage(models.LSN(0x200+i), msg); err != nil {
+			t.Fatalf("message %d (%q): %v", i, msg[0], err)
+		}
+	}
+	if v := r.relations.at(16384, 0x300); v == nil || len(v.Columns) != 4 {
+		t.Fatalf("layout after subtransaction abort = %+v, want the original 4 columns", v)
+	}
+
+	messages = [][]byte{
+		(&pgoutputBuilder{}).byte('S').uint32(80).byte(1).buf,
+		streamed(80, messagesRelationV2()),
+		(&pgoutputBuilder{}).byte('E').buf,
+		(&pgoutputBuilder{}).byte('A').uint32(80).uint32(80).buf,
+	}
+	for i, msg := range messages {
+		if _, err := r.parsePgoutputMessage(models.LSN(0x300+i), msg); err != nil {
+			t.Fatalf("message %d (%q): %v", i, msg[0], err)
+		}
+	}
+	if v := r.relations.at(16384, 0x400); v == nil || len(v.Columns) != 4 {
+		t.Fatalf("layout after transaction abort = %+v, want the original 4 columns", v)
+	}
+}
@@ -0,0 +1,183 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"posduif/sync-engine/internal/models"
+)
+
+// maxRelationVersions bounds the layouts kept per relation. Only transactions
+// still being decoded can need an old layout, so a few versions are enough.
+const maxRelationVersions = 8
+
+// relationVersion is one layout of a relation and the WAL position at which the
+// stream sent it
+type relationVersion struct {
+	*relation
+	LSN     models.LSN
+	Version int // Increases with every layout change of the relation
+}
+
+// relationCache keeps the layouts of each relation sent in 'R' messages.
+// Transactions are decoded in commit order, so a transaction that started
+// before an ALTER TABLE can commit after it and still carry tuples in the old
+// layout. Tuples are decoded with the layout in effect at their LSN.
+type relationCache struct {
+	versions map[uint32][]*relationVersion // relation ID -> layouts ordered by LSN
+}
+
+// schemaChange describes how a relation's layout changed
+type schemaChange struct {
+	Schema  string
+	Table   string
+	LSN     models.LSN
+	Version int
+	Renamed string   // Previous "schema.table" if the table was renamed
+	Added   []string // Columns added
+	Dropped []string // Columns dropped
+	Retyped []string // Columns whose type or type modifier changed
+}
+
+func (c *schemaChange) String() string {
+	parts := []string{fmt.Sprintf("%s.%s version %d at %s", c.Schema, c.Table, c.Version, c.LSN)}
+	if c.Renamed != "" {
+		parts = append(parts, "renamed from "+c.Renamed)
+	}
+	if len(c.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(c.Added, ", "))
+	}
+	if len(c.Dropped) > 0 {
+		parts = append(parts, "dropped "+strings.Join(c.Dropped, ", "))
+	}
+	if len(c.Retyped) > 0 {
+		parts = append(parts, "retyped "+strings.Join(c.Retyped, ", "))
+	}
+	return strings.Join(parts, ": ")
+}
+
+func newRelationCache() *relationCache {
+	return &relationCache{versions: make(map[uint32][]*relationVersion)}
+}
+
+// add records a relation message received at lsn. It returns the schema change
+// when the message introduces a newer layout than any seen before, and nil for
+// the first layout, a resent layout or an older layout.
+func (c *relationCache) add(rel *relation, lsn models.LSN) *schemaChange {
+	versions := c.versions[rel.ID]
+	current := c.at(rel.ID, lsn)
+	if current != nil && sameLayout(current.relation, rel) {
+		return nil
+	}
+
+	version := &relationVersion{relation: rel, LSN: lsn, Version: 1}
+	for _, v := range versions {
+		if v.Version >= version.Version {
+			version.Version = v.Version + 1
+		}
+	}
+
+	// Insert after every layout sent at or before lsn
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].LSN > lsn })
+	versions = append(versions, nil)
+	copy(versions[i+1:], versions[i:])
+	versions[i] = version
+	newest := i == len(versions)-1
+	if len(versions) > maxRelationVersions {
+		versions = versions[len(versions)-maxRelationVersions:]
+	}
+	c.versions[rel.ID] = versions
+
+	if current == nil || !newest {
+		return nil
+	}
+	return diffRelations(current, version)
+}
+
+// remove forgets the layout sent at lsn, if one was recorded there
+func (c *relationCache) remove(id uint32, lsn models.LSN) {
+	versions := c.versions[id]
+	for i, v := range versions {
+		if v.LSN == lsn {
+			c.versions[id] = append(versions[:i:i], versions[i+1:]...)
+			return
+		}
+	}
+}
+
+// at returns the layout in effect at lsn: the last one sent at or before lsn,
+// or the oldest known layout for earlier positions
+func (c *relationCache) at(id uint32, lsn models.LSN) *relationVersion {
+	versions := c.versions[id]
+	if len(versions) == 0 {
+		return nil
+	}
+
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].LSN > lsn })
+	if i == 0 {
+		return versions[0]
+	}
+	return versions[i-1]
+}
+
+// forTuple returns the layout to decode a tuple of n columns at lsn, or nil if
+// the relation is unknown. pgoutput sends every column of the layout in effect,
+// so a tuple with a different number of columns cannot be decoded reliably and
+// is an error rather than being matched to another layout by its count.
+func (c *relationCache) forTuple(id uint32, lsn models.LSN, n int) (*relationVersion, error) {
+	current := c.at(id, lsn)
+	if current == nil || len(current.Columns) == n {
+		return current, nil
+	}
+	return nil, fmt.Errorf("tuple of %d columns at %s does not match %s.%s version %d with %d columns",
+		n, lsn, current.Namespace, current.Name, current.Version, len(current.Columns))
+}
+
+// sameLayout reports whether two relation messages describe the same table layout
+func sameLayout(a, b *relation) bool {
+	if a.Namespace != b.Namespace || a.Name != b.Name || a.ReplicaIdentity != b.ReplicaIdentity ||
+		len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i] != b.Columns[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffRelations describes the change from one layout to the next
+func diffRelations(from, to *relationVersion) *schemaChange {
+	change := &schemaChange{
+		Schema:  to.Namespace,
+		Table:   to.Name,
+		LSN:     to.LSN,
+		Version: to.Version,
+	}
+	if from.Namespace != to.Namespace || from.Name != to.Name {
+		change.Renamed = from.Namespace + "." + from.Name
+	}
+
+	fromColumns := make(map[string]relationColumn, len(from.Columns))
+	for _, col := range from.Columns {
+		fromColumns[col.Name] = col
+	}
+	for _, col := range to.Columns {
+		prev, ok := fromColumns[col.Name]
+		if !ok {
+			change.Added = append(change.Added, col.Name)
+		} else if prev.TypeOID != col.TypeOID || prev.TypeMod != col.TypeMod {
+			change.Retyped = append(change.Retyped, col.Name)
+		}
+		delete(fromColumns, col.Name)
+	}
+	for _, col := range from.Columns {
+		if _, ok := fromColumns[col.Name]; ok {
+			change.Dropped = append(change.Dropped, col.Name)
+		}
+	}
+
+	return change
+}
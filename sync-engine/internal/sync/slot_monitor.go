@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+)
+
+// Slot monitor actions taken when retained WAL exceeds the threshold
+const (
+	SlotActionWarn         = "warn"
+	SlotActionResyncStale  = "resync_stale"
+	SlotActionRecreateSlot = "recreate_slot"
+)
+
+// SlotMonitor watches the sync replication slot so an abandoned or lagging
+// consumer cannot fill the tenant database's disk with retained WAL
+type SlotMonitor struct {
+	db          *database.DB
+	slotManager *database.ReplicationSlotManager
+	slotName    string
+	cfg         *config.SlotMonitorConfig
+	cancel      context.CancelFunc
+	done        chan struct{} // Closed once the background checks have stopped
+
+	statsLock sync.RWMutex
+	stats     *models.ReplicationSlotStats
+}
+
+// NewSlotMonitor creates a new slot monitor
+func NewSlotMonitor(db *database.DB, slotManager *database.ReplicationSlotManager, slotName string, cfg *config.SlotMonitorConfig) (*SlotMonitor, error) {
+	switch cfg.Action {
+	case SlotActionWarn, SlotActionRecreateSlot:
+	case SlotActionResyncStale:
+		if _, err := time.ParseDuration(cfg.StaleDeviceAge); err != nil {
+			return nil, fmt.Errorf("invalid stale_device_age %q: %w", cfg.StaleDeviceAge, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown slot monitor action %q", cfg.Action)
+	}
+
+	return &SlotMonitor{
+		db:          db,
+		slotManager: slotManager,
+		slotName:    slotName,
+		cfg:         cfg,
+	}, nil
+}
+
+// Start starts checking the slot in the background
+func (m *SlotMonitor) Start(ctx context.Context) {
+	interval, err := time.ParseDuration(m.cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := m.Check(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Replication slot check failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the background checks, waiting for a running check to finish
+func (m *SlotMonitor) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+		<-m.done
+	}
+}
+
+// Stats returns the most recent slot statistics, or nil before the first check
+func (m *SlotMonitor) Stats() *models.ReplicationSlotStats {
+	m.statsLock.RLock()
+	defer m.statsLock.RUnlock()
+
+	if m.stats == nil {
+		return nil
+	}
+	stats := *m.stats
+	return &stats
+}
+
+// Check reads the slot statistics and applies the configured action if the
+// retained WAL exceeds the threshold
+func (m *SlotMonitor) Check(ctx context.Context) error {
+	stats, err := m.slotManager.GetSlotStats(ctx, m.slotName)
+	if err != nil {
+		return err
+	}
+	stats.OverThreshold = stats.RetainedBytes > m.cfg.MaxRetainedBytes
+
+	m.statsLock.Lock()
+	m.stats = stats
+	m.statsLock.Unlock()
+
+	if !stats.OverThreshold {
+		return nil
+	}
+
+	log.Printf("Replication slot %s retains %d bytes of WAL (threshold %d, flush lag %d, active %t), action: %s",
+		m.slotName, stats.RetainedBytes, m.cfg.MaxRetainedBytes, stats.FlushLagBytes, stats.Active, m.cfg.Action)
+
+	switch m.cfg.Action {
+	case SlotActionResyncStale:
+		return m.resyncStaleDevices(ctx)
+	case SlotActionRecreateSlot:
+		return m.recreateSlot(ctx)
+	}
+	return nil
+}
+
+// resyncStaleDevices releases the WAL held for devices that have not synced or
+// been seen within stale_device_age: their queued changes are dropped and they
+// must download a full snapshot. The slot advances on the next status update.
+func (m *SlotMonitor) resyncStaleDevices(ctx context.Context) error {
+	staleAge, err := time.ParseDuration(m.cfg.StaleDeviceAge)
+	if err != nil {
+		return fmt.Errorf("invalid stale_device_age %q: %w", m.cfg.StaleDeviceAge, err)
+	}
+
+	staleBefore := time.Now().Add(-staleAge)
+	count, err := m.db.MarkStaleDevicesForFullResync(ctx, staleBefore)
+	if err != nil {
+		return fmt.Errorf("failed to mark stale devices for full resync: %w", err)
+	}
+	if count > 0 {
+		log.Printf("Marked %d devices not synced since %s for full resync", count, staleBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// recreateSlot drops and recreates the slot. Changes in the released WAL are
+// lost, so every device is marked for a full resync first.
+func (m *SlotMonitor) recreateSlot(ctx context.Context) error {
+	count, err := m.db.MarkDevicesForFullResync(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to mark devices for full resync: %w", err)
+	}
+
+	if err := m.slotManager.RecreateReplicationSlot(ctx, m.slotName); err != nil {
+		return fmt.Errorf("failed to recreate replication slot: %w", err)
+	}
+
+	log.Printf("Recreated replication slot %s, marked %d devices for full resync", m.slotName, count)
+	return nil
+}
@@ -0,0 +1,308 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+)
+
+// SnapshotManager bootstraps devices that need a full resync. It pages the
+// device's rows as of the snapshot for every sync rule, then hands over to the
+// device's change queue. Rows written after the snapshot are left to the queue,
+// and queued transactions already visible in the snapshot are dropped, so
+// there are no gaps or duplicates at the handover. The snapshot and the paging
+// position are kept in sync_metadata, so any replica can serve the next page.
+// A page is returned again until the device acknowledges it.
+type SnapshotManager struct {
+	db    *database.DB
+	rules *SyncRules
+}
+
+// snapshotPosition is a position in the paging of a snapshot
+type snapshotPosition struct {
+	ruleIndex int     // Rule currently being paged
+	afterID   *string // Last id returned for the current rule
+}
+
+// NewSnapshotManager creates a new snapshot manager
+func NewSnapshotManager(db *database.DB, rules *SyncRules) *SnapshotManager {
+	return &SnapshotManager{
+		db:    db,
+		rules: rules,
+	}
+}
+
+// NextPage returns the page of a device's snapshot after the last acknowledged
+// one. sm is the device's sync metadata, or nil if it has none yet. A new
+// snapshot is taken for every full resync request, and the device starts over
+// with a reset page.
+func (m *SnapshotManager) NextPage(ctx context.Context, deviceID string, sm *models.SyncMetadata, limit int) (*models.IncomingChanges, error) {
+	sm, err := m.begin(ctx, deviceID, sm)
+	if err != nil {
+		return nil, err
+	}
+
+	lsn, err := models.ParseLSN(*sm.SnapshotLSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot LSN: %w", err)
+	}
+	if sm.Snapshot == nil {
+		return nil, fmt.Errorf("no snapshot for device %s", deviceID)
+	}
+	snap, err := parsePgSnapshot(*sm.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	user, err := m.db.GetUserByDeviceID(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for device: %w", err)
+	}
+
+	position := snapshotPosition{ruleIndex: sm.SnapshotRule, afterID: sm.SnapshotAfter}
+	incoming, next, err := m.readPage(ctx, user.ID, snap, *sm.SnapshotTakenAt, position, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	incoming.Snapshot.Reset = sm.SnapshotPage == 0
+	incoming.Snapshot.Done = next.ruleIndex >= len(m.rules.All())
+	incoming.Cursor = (&incomingCursor{
+		Kind:  cursorSnapshot,
+		LSN:   lsn,
+		Page:  sm.SnapshotPage + 1,
+		Rule:  next.ruleIndex,
+		After: next.afterID,
+	}).String()
+	// Live changes follow the last page, so there is always more to fetch
+	incoming.HasMore = true
+	return incoming, nil
+}
+
+// Acknowledge moves a device's snapshot past the page identified by cursor.
+// Acknowledging the last page hands the device over to its change queue.
+func (m *SnapshotManager) Acknowledge(ctx context.Context, deviceID string, cursor *incomingCursor) error {
+	done := cursor.Rule >= len(m.rules.All())
+	advanced, err := m.db.AdvanceSnapshot(ctx, deviceID, cursor.LSN.String(), cursor.Page, cursor.Rule, cursor.After, done)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge snapshot page: %w", err)
+	}
+	if !advanced {
+		return m.acknowledgedBefore(ctx, deviceID, cursor)
+	}
+	if done {
+		log.Printf("Completed snapshot for device %s", deviceID)
+	}
+	return nil
+}
+
+// acknowledgedBefore accepts a repeated acknowledgement of the last page the
+// device acknowledged in its snapshot, and rejects any other cursor, such as a
+// page of a snapshot replaced by a new full resync request
+func (m *SnapshotManager) acknowledgedBefore(ctx context.Context, deviceID string, cursor *incomingCursor) error {
+	sm, err := m.db.GetSyncMetadata(ctx, deviceID)
+	if err != nil {
+		return ErrStaleCursor
+	}
+	if sm.SnapshotLSN == nil || sm.SnapshotPage != cursor.Page {
+		return ErrStaleCursor
+	}
+	if lsn, err := models.ParseLSN(*sm.SnapshotLSN); err != nil || lsn != cursor.LSN {
+		return ErrStaleCursor
+	}
+	return nil
+}
+
+// begin returns the device's sync metadata with a snapshot for its current
+// full resync request, taking the snapshot if none was taken yet
+func (m *SnapshotManager) begin(ctx context.Context, deviceID string, sm *models.SyncMetadata) (*models.SyncMetadata, error) {
+	if sm != nil && snapshotStarted(sm) {
+		return sm, nil
+	}
+
+	if sm == nil {
+		// A device enrolled before snapshots existed has no metadata yet
+		if err := m.db.RequestFullResync(ctx, deviceID); err != nil {
+			return nil, fmt.Errorf("failed to request full resync: %w", err)
+		}
+	}
+
+	started, err := m.db.BeginSnapshot(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	// Another replica may have taken the snapshot first; use whichever was taken
+	if sm, err = m.db.GetSyncMetadata(ctx, deviceID); err != nil {
+		return nil, fmt.Errorf("failed to get sync metadata: %w", err)
+	}
+	if !snapshotStarted(sm) {
+		return nil, fmt.Errorf("no snapshot for device %s", deviceID)
+	}
+	if started {
+		log.Printf("Started snapshot for device %s at %s", deviceID, *sm.SnapshotLSN)
+	}
+	return sm, nil
+}
+
+// snapshotStarted reports whether a snapshot was taken for the device's
+// current full resync request
+func snapshotStarted(sm *models.SyncMetadata) bool {
+	if sm.SnapshotTakenAt == nil || sm.SnapshotLSN == nil || sm.Snapshot == nil {
+		return false
+	}
+	if sm.SnapshotRequestedAt == nil || sm.ResyncRequestedAt == nil {
+		return sm.SnapshotRequestedAt == nil && sm.ResyncRequestedAt == nil
+	}
+	return sm.SnapshotRequestedAt.Equal(*sm.ResyncRequestedAt)
+}
+
+// readPage reads up to limit rows from position, moving on to the next rule
+// when one is exhausted. Only rows whose current version is visible in snap
+// are returned: rows written since were changed after the snapshot, and their
+// latest state reaches the device through its change queue. Inserts and
+// updates are not queued for the devices of a row's origin user, so the
+// user's own rows are returned as they are now. It returns the position after
+// the page, which may hold fewer rows than limit.
+func (m *SnapshotManager) readPage(ctx context.Context, userID string, snap *pgSnapshot, takenAt time.Time, position snapshotPosition, limit int) (*models.IncomingChanges, *snapshotPosition, error) {
+	incoming := &models.IncomingChanges{
+		Messages: make([]models.Message, 0),
+		Snapshot: &models.SnapshotPage{},
+	}
+
+	rules := m.rules.All()
+	remaining := limit
+	for position.ruleIndex < len(rules) && remaining > 0 {
+		rule := rules[position.ruleIndex]
+		rows, nextXID, err := m.db.ReadSnapshotRows(ctx, rule, userID, position.afterID, remaining)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read snapshot of %s: %w", rule.Table, err)
+		}
+
+		schema, table := splitTableName(rule.Table)
+		for _, row := range rows {
+			if !row.Origin && !snap.rowVisible(row.XMin, nextXID) {
+				continue
+			}
+
+			change := &WALChange{
+				Schema:     schema,
+				Table:      table,
+				Operation:  "INSERT",
+				CommitTime: takenAt,
+			}
+			if change.Columns, err = database.DecodeColumns(row.Data); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode snapshot row of %s: %w", rule.Table, err)
+			}
+
+			if table == "messages" {
+				if msg, err := ConvertWALChangeToMessage(change); err == nil {
+					incoming.Messages = append(incoming.Messages, *msg)
+				}
+			} else if record, err := ConvertWALChangeToRecord(change); err == nil {
+				incoming.Records = append(incoming.Records, *record)
+			}
+		}
+
+		remaining -= len(rows)
+		if remaining > 0 {
+			// Fewer rows than requested: this rule is exhausted
+			position.ruleIndex++
+			position.afterID = nil
+		} else {
+			position.afterID = &rows[len(rows)-1].ID
+		}
+	}
+
+	return incoming, &position, nil
+}
+
+// pgSnapshot is a parsed pg_snapshot: xmin:xmax:xip_list
+type pgSnapshot struct {
+	xmin uint64
+	xmax uint64
+	xip  map[uint64]bool
+}
+
+// parsePgSnapshot parses the text form of pg_current_snapshot()
+func parsePgSnapshot(s string) (*pgSnapshot, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid snapshot format: %s", s)
+	}
+
+	xmin, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot xmin: %w", err)
+	}
+	xmax, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot xmax: %w", err)
+	}
+
+	snap := &pgSnapshot{xmin: xmin, xmax: xmax, xip: make(map[uint64]bool)}
+	if parts[2] != "" {
+		for _, x := range strings.Split(parts[2], ",") {
+			xid, err := strconv.ParseUint(x, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid snapshot xip: %w", err)
+			}
+			snap.xip[xid] = true
+		}
+	}
+
+	return snap, nil
+}
+
+// visible reports whether a transaction's changes are visible in the snapshot.
+// Replication only carries the low 32 bits of the XID, so the full XID is taken
+// as the one within 2^31 of xmax, which holds for transactions near the snapshot.
+func (s *pgSnapshot) visible(xid uint32) bool {
+	full := int64(s.xmax) + int64(int32(xid-uint32(s.xmax)))
+	if full < 0 {
+		return true
+	}
+
+	if uint64(full) < s.xmin {
+		return true
+	}
+	return uint64(full) < s.xmax && !s.xip[uint64(full)]
+}
+
+// rowVisible reports whether a row version written by xmin is part of the
+// snapshot. nextXID is the next transaction ID at the time the row was read:
+// an xmin that maps to nextXID or later cannot belong to a transaction started
+// since the snapshot, so it is the XID of a row frozen more than 2^31
+// transactions ago, which every snapshot sees. pg_snapshot does not list
+// subtransactions, so a row written in a savepoint of a transaction running
+// at snapshot time is taken as visible; the device receives the same row
+// again from its change queue.
+func (s *pgSnapshot) rowVisible(xmin uint32, nextXID uint64) bool {
+	full := int64(s.xmax) + int64(int32(xmin-uint32(s.xmax)))
+	if full >= 0 && uint64(full) >= nextXID {
+		return true
+	}
+	return s.visible(xmin)
+}
+
+// dropSnapshotChanges removes the transactions that a device already received in
+// its snapshot. Only changes committed at or before snapshotLSN can be visible.
+// It returns the remaining changes and the commit LSNs of the dropped transactions.
+func dropSnapshotChanges(changes []*WALChange, snap *pgSnapshot, snapshotLSN models.LSN) ([]*WALChange, []models.LSN) {
+	kept := make([]*WALChange, 0, len(changes))
+	var dropped []models.LSN
+	for _, change := range changes {
+		if change.LSN <= snapshotLSN && snap.visible(change.XID) {
+			if len(dropped) == 0 || dropped[len(dropped)-1] != change.LSN {
+				dropped = append(dropped, change.LSN)
+			}
+			continue
+		}
+		kept = append(kept, change)
+	}
+	return kept, dropped
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"posduif/sync-engine/internal/models"
+)
+
+func TestPgSnapshotVisible(t *testing.T) {
+	snap, err := parsePgSnapshot("100:110:103,107")
+	if err != nil {
+		t.Fatalf("parsePgSnapshot: %v", err)
+	}
+
+	cases := map[uint32]bool{
+		99:  true,  // committed before xmin
+		100: true,  // between xmin and xmax, not in progress
+		103: false, // in progress when the snapshot was taken
+		107: false,
+		110: false, // started after the snapshot
+		200: false,
+	}
+	for xid, want := range cases {
+		if got := snap.visible(xid); got != want {
+			t.Errorf("visible(%d) = %t, want %t", xid, got, want)
+		}
+	}
+
+	if _, err := parsePgSnapshot("100:110"); err == nil {
+		t.Error("expected error for malformed snapshot")
+	}
+}
+
+func TestPgSnapshotVisibleAcrossEpoch(t *testing.T) {
+	// xmax in epoch 1; XID 0xFFFFFFF0 belongs to epoch 0 and is older than xmin
+	snap, err := parsePgSnapshot("4294967300:4294967310:")
+	if err != nil {
+		t.Fatalf("parsePgSnapshot: %v", err)
+	}
+	if !snap.visible(0xFFFFFFF0) {
+		t.Error("XID from the previous epoch should be visible")
+	}
+	if snap.visible(20) {
+		t.Error("XID after xmax should not be visible")
+	}
+}
+
+func TestPgSnapshotRowVisible(t *testing.T) {
+	snap, _ := parsePgSnapshot("100:110:105")
+	const nextXID = 120
+
+	cases := map[uint32]bool{
+		99:  true,  // written before the snapshot
+		105: false, // in progress when the snapshot was taken
+		115: false, // written after the snapshot
+		// Frozen row written 2^31+ transactions ago, which maps past nextXID
+		uint32(110 + 1<<31 - 1): true,
+	}
+	for xmin, want := range cases {
+		if got := snap.rowVisible(xmin, nextXID); got != want {
+			t.Errorf("rowVisible(%d) = %t, want %t", xmin, got, want)
+		}
+	}
+}
+
+func TestDropSnapshotChanges(t *testing.T) {
+	snap, _ := parsePgSnapshot("100:110:105")
+	changes := []*WALChange{
+		{LSN: 0x10, XID: 101},
+		{LSN: 0x10, XID: 101},
+		{LSN: 0x20, XID: 105}, // in progress at snapshot time
+		{LSN: 0x30, XID: 102},
+		{LSN: 0x90, XID: 103}, // after the snapshot LSN
+	}
+
+	kept, dropped := dropSnapshotChanges(changes, snap, 0x40)
+	if len(kept) != 2 || kept[0].LSN != 0x20 || kept[1].LSN != 0x90 {
+		t.Errorf("unexpected kept changes: %+v", kept)
+	}
+	if len(dropped) != 2 || dropped[0] != models.LSN(0x10) || dropped[1] != models.LSN(0x30) {
+		t.Errorf("dropped = %v, want [0/10 0/30]", dropped)
+	}
+}
+
+func TestTimestampValue(t *testing.T) {
+	want := time.Date(2025, 3, 4, 5, 6, 7, 123456000, time.UTC)
+	for _, v := range []interface{}{
+		want,
+		"2025-03-04T05:06:07.123456",
+		"2025-03-04T05:06:07.123456+00:00",
+		"2025-03-04 05:06:07.123456+00",
+		"2025-03-04 05:06:07.123456",
+	} {
+		got, ok := timestampValue(v)
+		if !ok || !got.Equal(want) {
+			t.Errorf("timestampValue(%v) = %v, %t", v, got, ok)
+		}
+	}
+
+	if _, ok := timestampValue("yesterday"); ok {
+		t.Error("expected no timestamp for invalid text")
+	}
+}
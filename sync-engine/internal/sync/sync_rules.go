@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"posduif/sync-engine/internal/config"
+)
+
+// Sync rule modes accepted by sync.rules[].mode
+const (
+	SyncRuleColumn    = "column"
+	SyncRuleJoin      = "join"
+	SyncRuleBroadcast = "broadcast"
+)
+
+// SyncRules maps synced tables to the rule that routes their rows to devices
+type SyncRules struct {
+	rules   map[string]*config.SyncRule // "schema.table" -> rule
+	ordered []*config.SyncRule          // Rules in configuration order
+}
+
+// NewSyncRules validates the configured rules
+func NewSyncRules(rules []config.SyncRule) (*SyncRules, error) {
+	sr := &SyncRules{rules: make(map[string]*config.SyncRule)}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Table == "" {
+			return nil, fmt.Errorf("sync rule %d has no table", i)
+		}
+
+		switch rule.Mode {
+		case SyncRuleColumn:
+			if len(rule.UserColumns) == 0 {
+				return nil, fmt.Errorf("sync rule for %s: column mode needs user_columns", rule.Table)
+			}
+		case SyncRuleJoin:
+			if rule.Join == "" {
+				return nil, fmt.Errorf("sync rule for %s: join mode needs a join query", rule.Table)
+			}
+		case SyncRuleBroadcast:
+		default:
+			return nil, fmt.Errorf("sync rule for %s: unknown mode %q", rule.Table, rule.Mode)
+		}
+
+		schema, table := splitTableName(rule.Table)
+		key := schema + "." + table
+		if _, ok := sr.rules[key]; ok {
+			return nil, fmt.Errorf("duplicate sync rule for %s", rule.Table)
+		}
+		sr.rules[key] = rule
+		sr.ordered = append(sr.ordered, rule)
+	}
+
+	return sr, nil
+}
+
+// Match returns the rule for a table, or nil if the table is not synced
+func (sr *SyncRules) Match(schema, table string) *config.SyncRule {
+	return sr.rules[schema+"."+table]
+}
+
+// All returns the rules in configuration order
+func (sr *SyncRules) All() []*config.SyncRule {
+	return sr.ordered
+}
+
+// splitTableName splits "schema.table" into its parts, defaulting to the public schema
+func splitTableName(name string) (string, string) {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return schema, table
+	}
+	return "public", name
+}
+
+// rowValue returns a column of the new row, falling back to the old row for
+// deletes and for updates that did not send the column
+func rowValue(change *WALChange, column string) (string, bool) {
+	if v, ok := keyText(change.Columns[column]); ok {
+		return v, true
+	}
+	if v, ok := keyText(change.OldColumns[column]); ok {
+		return v, true
+	}
+	return "", false
+}
+
+// columnUserIDs returns the distinct user IDs held in the given columns
+func columnUserIDs(change *WALChange, columns []string) []string {
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		if userID, ok := rowValue(change, column); ok && !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+// originUserIDs returns the authoring users of both the new and the old row, so
+// a change of author still skips the previous author's devices
+func originUserIDs(change *WALChange, columns []string) []string {
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, row := range []map[string]interface{}{change.Columns, change.OldColumns} {
+		for _, column := range columns {
+			if userID, ok := keyText(row[column]); ok && !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+	return userIDs
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"posduif/sync-engine/internal/config"
+)
+
+func TestNewSyncRules(t *testing.T) {
+	rules, err := NewSyncRules([]config.SyncRule{
+		{Table: "messages", Mode: SyncRuleColumn, UserColumns: []string{"recipient_id"}},
+		{Table: "app.tasks", Mode: SyncRuleJoin, Join: "SELECT user_id FROM task_members WHERE task_id = $1", JoinColumn: "id"},
+		{Table: "countries", Mode: SyncRuleBroadcast},
+	})
+	if err != nil {
+		t.Fatalf("NewSyncRules: %v", err)
+	}
+
+	if rule := rules.Match("public", "messages"); rule == nil || rule.Mode != SyncRuleColumn {
+		t.Errorf("public.messages matched %+v", rule)
+	}
+	if rule := rules.Match("app", "tasks"); rule == nil || rule.Mode != SyncRuleJoin {
+		t.Errorf("app.tasks matched %+v", rule)
+	}
+	if rule := rules.Match("public", "tasks"); rule != nil {
+		t.Errorf("public.tasks matched %+v, want no rule", rule)
+	}
+
+	invalid := [][]config.SyncRule{
+		{{Table: "messages", Mode: SyncRuleColumn}},
+		{{Table: "tasks", Mode: SyncRuleJoin}},
+		{{Table: "tasks", Mode: "everyone"}},
+		{{Mode: SyncRuleBroadcast}},
+		{{Table: "countries", Mode: SyncRuleBroadcast}, {Table: "public.countries", Mode: SyncRuleBroadcast}},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewSyncRules(cfg); err == nil {
+			t.Errorf("expected error for rules %+v", cfg)
+		}
+	}
+}
+
+func TestRuleUserIDs(t *testing.T) {
+	change := &WALChange{
+		Operation:  "UPDATE",
+		Columns:    map[string]interface{}{"recipient_id": "u2", "sender_id": "u1"},
+		OldColumns: map[string]interface{}{"recipient_id": "u3", "sender_id": "u4", "reviewer_id": "u5"},
+	}
+
+	if got, want := columnUserIDs(change, []string{"recipient_id", "reviewer_id"}), []string{"u2", "u5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columnUserIDs = %v, want %v", got, want)
+	}
+	if got, want := originUserIDs(change, []string{"sender_id"}), []string{"u1", "u4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("originUserIDs = %v, want %v", got, want)
+	}
+}
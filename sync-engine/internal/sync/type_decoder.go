@@ -0,0 +1,168 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"posduif/sync-engine/internal/database"
+)
+
+// ValueDecoder converts the text form of a column value to a Go value
+type ValueDecoder func(text string) (interface{}, error)
+
+// TypeDecoder converts pgoutput text values to Go values by column type OID.
+// Built-in types are decoded with pgtype and normalized to values that survive
+// the JSON round trip through the change queue: uuids as strings, timestamps as
+// UTC times, numerics as exact JSON numbers and json/jsonb as raw JSON.
+// Values of unknown types, and values that fail to decode, are kept as text.
+type TypeDecoder struct {
+	types  *pgtype.Map
+	custom map[uint32]ValueDecoder
+	named  map[string]ValueDecoder // Type name -> decoder, resolved to OIDs by ResolveTypeNames
+}
+
+// NewTypeDecoder creates a decoder for the built-in PostgreSQL types
+func NewTypeDecoder() *TypeDecoder {
+	return &TypeDecoder{
+		types:  pgtype.NewMap(),
+		custom: make(map[uint32]ValueDecoder),
+		named:  make(map[string]ValueDecoder),
+	}
+}
+
+// RegisterType installs a decoder for a type OID, replacing the built-in one
+func (d *TypeDecoder) RegisterType(oid uint32, decode ValueDecoder) {
+	d.custom[oid] = decode
+}
+
+// RegisterTypeName installs a decoder for a type created in the database, such
+// as an extension or enum type, whose OID differs between databases. The name
+// may be schema-qualified and is resolved by ResolveTypeNames.
+func (d *TypeDecoder) RegisterTypeName(name string, decode ValueDecoder) {
+	d.named[name] = decode
+}
+
+// ResolveTypeNames looks up the OIDs of the types registered by name. Types
+// that do not exist yet are skipped and resolved on a later call.
+func (d *TypeDecoder) ResolveTypeNames(ctx context.Context, db *database.DB) error {
+	if len(d.named) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(d.named))
+	for name := range d.named {
+		names = append(names, name)
+	}
+	oids, err := db.GetTypeOIDs(ctx, names)
+	if err != nil {
+		return fmt.Errorf("failed to resolve custom types: %w", err)
+	}
+	for name, oid := range oids {
+		d.custom[oid] = d.named[name]
+	}
+	return nil
+}
+
+// Decode converts the text form of a value of the given type
+func (d *TypeDecoder) Decode(oid uint32, text []byte) interface{} {
+	if decode, ok := d.custom[oid]; ok {
+		if v, err := decode(string(text)); err == nil {
+			return v
+		}
+		return string(text)
+	}
+
+	switch oid {
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		// Decoded by the device; keeping the raw document preserves large numbers
+		return json.RawMessage(append([]byte(nil), text...))
+	case pgtype.TextOID, pgtype.VarcharOID, pgtype.BPCharOID, pgtype.NameOID:
+		return string(text)
+	}
+
+	typ, ok := d.types.TypeForOID(oid)
+	if !ok {
+		return string(text)
+	}
+	v, err := typ.Codec.DecodeValue(d.types, oid, pgtype.TextFormatCode, text)
+	if err != nil {
+		return string(text)
+	}
+	if v, ok := normalizeValue(v); ok {
+		return v
+	}
+	return string(text)
+}
+
+// normalizeValue converts a pgtype value to one with a faithful JSON form. It
+// returns false for values that have none, which are then kept as text.
+func normalizeValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte, int16, int32, int64, json.Number:
+		return v, true
+	case float32:
+		return normalizeValue(float64(v))
+	case float64:
+		// NaN and infinities have no JSON form
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return v, true
+	case time.Time:
+		return v.UTC(), true
+	case [16]byte:
+		return uuid.UUID(v).String(), true
+	case pgtype.Numeric:
+		if v.NaN || v.InfinityModifier != pgtype.Finite {
+			return nil, false
+		}
+		text, err := v.Value()
+		if err != nil {
+			return nil, false
+		}
+		s, ok := text.(string)
+		if !ok {
+			return nil, false
+		}
+		return json.Number(s), true
+	case map[string]interface{}:
+		return v, true
+	case []interface{}:
+		elements := make([]interface{}, len(v))
+		for i, element := range v {
+			normalized, ok := normalizeValue(element)
+			if !ok {
+				return nil, false
+			}
+			elements[i] = normalized
+		}
+		return elements, true
+	}
+	return nil, false
+}
+
+// keyText returns the text form of a key or user ID column value, which may
+// be decoded as a string or as a number
+func keyText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	case int16:
+		return strconv.FormatInt(int64(v), 10), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
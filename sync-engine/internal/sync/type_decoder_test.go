@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTypeDecoderDecode(t *testing.T) {
+	d := NewTypeDecoder()
+
+	tests := []struct {
+		name string
+		oid  uint32
+		text string
+		want interface{}
+	}{
+		{"uuid", pgtype.UUIDOID, "0d1f5c8e-2a7b-4c3d-9e6f-1a2b3c4d5e6f", "0d1f5c8e-2a7b-4c3d-9e6f-1a2b3c4d5e6f"},
+		{"timestamptz", pgtype.TimestamptzOID, "2024-03-01 12:30:00+02",
+			time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{"boolean", pgtype.BoolOID, "t", true},
+		{"int4", pgtype.Int4OID, "42", int32(42)},
+		{"int8", pgtype.Int8OID, "9007199254740993", int64(9007199254740993)},
+		{"numeric", pgtype.NumericOID, "12345678901234567890.0100", json.Number("12345678901234567890.0100")},
+		{"jsonb", pgtype.JSONBOID, `{"n": 1}`, json.RawMessage(`{"n": 1}`)},
+		{"int4[]", pgtype.Int4ArrayOID, "{1,2,NULL}", []interface{}{int32(1), int32(2), nil}},
+		{"bytea", pgtype.ByteaOID, `\x0102`, []byte{1, 2}},
+		{"text", pgtype.TextOID, "hello", "hello"},
+		{"float8 infinity", pgtype.Float8OID, "Infinity", "Infinity"},
+		{"numeric NaN", pgtype.NumericOID, "NaN", "NaN"},
+		{"invalid uuid", pgtype.UUIDOID, "not-a-uuid", "not-a-uuid"},
+		{"unknown type", 999999, "(1,2)", "(1,2)"},
+	}
+	for _, tt := range tests {
+		if got := d.Decode(tt.oid, []byte(tt.text)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Decode(%q) = %#v, want %#v", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTypeDecoderRegisterType(t *testing.T) {
+	d := NewTypeDecoder()
+	d.RegisterType(70000, func(text string) (interface{}, error) {
+		return strings.ToUpper(text), nil
+	})
+
+	if got := d.Decode(70000, []byte("draft")); got != "DRAFT" {
+		t.Errorf("custom type = %#v, want DRAFT", got)
+	}
+}
@@ -0,0 +1,188 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"posduif/sync-engine/internal/config"
+	"posduif/sync-engine/internal/database"
+	"posduif/sync-engine/internal/models"
+)
+
+// WALDumpOptions selects the changes printed by DumpWAL
+type WALDumpOptions struct {
+	Slot        string     // Slot to copy; empty starts a new slot at the current WAL position
+	FromLSN     models.LSN // Skip transactions committed before this position
+	Tables      []string   // "table" or "schema.table"; empty = all tables
+	Operations  []string   // INSERT, UPDATE, DELETE; empty = all operations
+	DeviceID    string     // Only changes routed to this device
+	RecipientID string     // Only changes routed to a device of this user
+	Limit       int        // Stop after this many changes; 0 = until cancelled
+}
+
+// dumpedChange is the JSON line printed for a decoded change
+type dumpedChange struct {
+	LSN        string                 `json:"lsn"`
+	XID        uint32                 `json:"xid"`
+	CommitTime time.Time              `json:"commit_time"`
+	Schema     string                 `json:"schema"`
+	Table      string                 `json:"table"`
+	Operation  string                 `json:"operation"`
+	Columns    map[string]interface{} `json:"columns,omitempty"`
+	OldColumns map[string]interface{} `json:"old_columns,omitempty"`
+	Devices    []string               `json:"devices"` // Devices the sync rules route the change to
+}
+
+// errDumpLimit stops the replication stream once the limit is reached
+var errDumpLimit = errors.New("dump limit reached")
+
+// DumpWAL decodes the publication with the same reader the WAL service uses and
+// writes every matching change to w as a JSON line, until ctx is cancelled or
+// the limit is reached. It streams from a temporary slot, a copy of opts.Slot or
+// a new one, that is dropped on disconnect. No flush position is ever confirmed,
+// so the production slot is never advanced.
+func DumpWAL(ctx context.Context, db *database.DB, slotManager *database.ReplicationSlotManager, changeTracker *ChangeTracker, cfg *config.WALConfig, opts WALDumpOptions, w io.Writer) error {
+	var recipientDevices map[string]bool
+	if opts.RecipientID != "" {
+		deviceIDs, err := db.GetDeviceIDsForUser(ctx, opts.RecipientID)
+		if err != nil {
+			return fmt.Errorf("failed to get devices of recipient: %w", err)
+		}
+		if len(deviceIDs) == 0 {
+			return fmt.Errorf("user %s has no enrolled devices", opts.RecipientID)
+		}
+		recipientDevices = make(map[string]bool, len(deviceIDs))
+		for _, deviceID := range deviceIDs {
+			recipientDevices[deviceID] = true
+		}
+	}
+
+	conn, err := slotManager.ConnectReplication(ctx)
+	if err != nil {
+		return err
+	}
+	slotName := fmt.Sprintf("posduif_dump_%d", os.Getpid())
+	if err := slotManager.CreateTemporarySlot(ctx, conn, slotName, opts.Slot); err != nil {
+		conn.Close(context.Background())
+		return err
+	}
+
+	reader := NewWALReader(conn, slotName, cfg, nil, nil)
+	defer reader.Close(context.Background())
+	if err := reader.StartReplication(ctx, opts.FromLSN); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	printed := 0
+	err = reader.ReadChanges(ctx, func(txn *Transaction) error {
+		if txn.LSN < opts.FromLSN {
+			return nil
+		}
+
+		for {
+			changes, err := txn.Next()
+			if err != nil {
+				return err
+			}
+			if len(changes) == 0 {
+				return nil
+			}
+
+			for _, change := range changes {
+				if !opts.matches(change) {
+					continue
+				}
+
+				devices, err := changeTracker.routeChange(ctx, change)
+				if err != nil {
+					return err
+				}
+				if opts.DeviceID != "" && !containsString(devices, opts.DeviceID) {
+					continue
+				}
+				if recipientDevices != nil && !containsAny(devices, recipientDevices) {
+					continue
+				}
+
+				if devices == nil {
+					devices = []string{}
+				}
+				err = encoder.Encode(dumpedChange{
+					LSN:        change.LSN.String(),
+					XID:        change.XID,
+					CommitTime: change.CommitTime,
+					Schema:     change.Schema,
+					Table:      change.Table,
+					Operation:  change.Operation,
+					Columns:    change.Columns,
+					OldColumns: change.OldColumns,
+					Devices:    devices,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to write change: %w", err)
+				}
+
+				printed++
+				if opts.Limit > 0 && printed >= opts.Limit {
+					return errDumpLimit
+				}
+			}
+		}
+	})
+	if errors.Is(err, errDumpLimit) || ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// matches applies the table and operation filters
+func (opts *WALDumpOptions) matches(change *WALChange) bool {
+	if len(opts.Operations) > 0 {
+		found := false
+		for _, op := range opts.Operations {
+			if strings.EqualFold(op, change.Operation) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(opts.Tables) > 0 {
+		for _, table := range opts.Tables {
+			schema, name := splitTableName(table)
+			if schema == change.Schema && name == change.Table {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values []string, set map[string]bool) bool {
+	for _, v := range values {
+		if set[v] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package sync
+
+import "testing"
+
+func TestWALDumpOptionsMatches(t *testing.T) {
+	insert := &WALChange{Schema: "public", Table: "messages", Operation: "INSERT"}
+	remove := &WALChange{Schema: "inventory", Table: "items", Operation: "DELETE"}
+
+	tests := []struct {
+		opts       WALDumpOptions
+		wantInsert bool
+		wantDelete bool
+	}{
+		{WALDumpOptions{}, true, true},
+		{WALDumpOptions{Tables: []string{"messages"}}, true, false},
+		{WALDumpOptions{Tables: []string{"inventory.items"}}, false, true},
+		{WALDumpOptions{Tables: []string{"items"}}, false, false},
+		{WALDumpOptions{Operations: []string{"delete"}}, false, true},
+		{WALDumpOptions{Tables: []string{"messages"}, Operations: []string{"UPDATE"}}, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.matches(insert); got != tt.wantInsert {
+			t.Errorf("%+v matches insert = %v, want %v", tt.opts, got, tt.wantInsert)
+		}
+		if got := tt.opts.matches(remove); got != tt.wantDelete {
+			t.Errorf("%+v matches delete = %v, want %v", tt.opts, got, tt.wantDelete)
+		}
+	}
+}
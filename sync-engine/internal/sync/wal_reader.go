@@ -4,58 +4,205 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
 	"posduif/sync-engine/internal/config"
 	"posduif/sync-engine/internal/models"
 )
 
-// WALChange represents a single change from the WAL
+// WALChange represents a single change from the WAL.
+// All changes of a transaction share the transaction's commit LSN and commit time.
 type WALChange struct {
-	LSN         models.LSN
-	Schema       string
-	Table        string
-	Operation    string // "INSERT", "UPDATE", "DELETE"
-	Columns      map[string]interface{}
-	OldColumns   map[string]interface{} // For UPDATE operations
-	CommitTime   time.Time
+	LSN        models.LSN // Commit LSN of the transaction
+	XID        uint32
+	Schema     string
+	Table      string
+	Operation  string // "INSERT", "UPDATE", "DELETE"
+	Columns    map[string]interface{}
+	OldColumns map[string]interface{} // Replica identity or old row for UPDATE and DELETE operations
+	CommitTime time.Time
+	Key        []string // Columns identifying the row, if the relation names them
 }
 
+// Transaction is a committed transaction handed to a TransactionHandler. Its
+// changes are read in WAL order with Next. A streamed transaction is read back
+// from its spill file in batches of sync.wal.batch_size changes, so it is never
+// held in memory whole.
+type Transaction struct {
+	LSN models.LSN // Commit LSN
+	XID uint32
+
+	changes []*WALChange                 // Changes buffered in memory
+	next    func() ([]*WALChange, error) // Reads the next batch of a streamed transaction
+	release func()                       // Removes the spill file of a streamed transaction
+}
+
+// Next returns the next batch of changes, or nil after the last one
+func (t *Transaction) Next() ([]*WALChange, error) {
+	if t.next != nil {
+		return t.next()
+	}
+	changes := t.changes
+	t.changes = nil
+	return changes, nil
+}
+
+// close releases the resources of the transaction once it was handled
+func (t *Transaction) close() {
+	if t.release != nil {
+		t.release()
+	}
+}
+
+// TransactionHandler receives one committed transaction. The transaction can
+// only be read until the handler returns.
+type TransactionHandler func(txn *Transaction) error
+
+// walTransaction buffers the changes of the transaction currently being streamed
+type walTransaction struct {
+	xid     uint32
+	changes []*WALChange
+}
+
+// FlushPositionFunc returns the LSN up to which WAL may be released by the server.
+// It receives the latest LSN read from the stream and must not return a larger value.
+type FlushPositionFunc func(ctx context.Context, received models.LSN) (models.LSN, error)
+
 // WALReader reads changes from PostgreSQL WAL using logical replication
 type WALReader struct {
-	conn     *pgx.Conn
-	slotName string
-	cfg      *config.WALConfig
+	conn           *pgconn.PgConn
+	slotName       string
+	cfg            *config.WALConfig
+	relations      *relationCache // Layouts from 'R' messages
+	types          *TypeDecoder
+	flushPosition  FlushPositionFunc
+	statusInterval time.Duration
+
+	// Transaction currently being streamed, nil between COMMIT and BEGIN
+	txn *walTransaction
+
+	// In-progress transactions streamed by the server (protocol v2). stream is
+	// the spill file of the current stream block, nil outside of one.
+	spill  *spillStore
+	stream *spilledTransaction
+
+	// Stream positions reported in standby status updates
+	receivedLSN models.LSN
+	flushedLSN  models.LSN
 }
 
-// NewWALReader creates a new WAL reader
-func NewWALReader(conn *pgx.Conn, slotName string, cfg *config.WALConfig) *WALReader {
+// NewWALReader creates a new WAL reader on a replication connection.
+// If flushPosition is nil the reader never confirms a flush position, so the slot is not advanced.
+// If types is nil only the built-in types are decoded.
+func NewWALReader(conn *pgconn.PgConn, slotName string, cfg *config.WALConfig, flushPosition FlushPositionFunc, types *TypeDecoder) *WALReader {
+	statusInterval, err := time.ParseDuration(cfg.StatusInterval)
+	if err != nil || statusInterval <= 0 {
+		statusInterval = 10 * time.Second
+	}
+	if types == nil {
+		types = NewTypeDecoder()
+	}
+	spillDir := cfg.SpillDir
+	if spillDir == "" {
+		spillDir = os.TempDir()
+	}
+
 	return &WALReader{
-		conn:     conn,
-		slotName: slotName,
-		cfg:      cfg,
+		conn:           conn,
+		slotName:       slotName,
+		cfg:            cfg,
+		relations:      newRelationCache(),
+		types:          types,
+		spill:          newSpillStore(filepath.Join(spillDir, "posduif-"+slotName)),
+		flushPosition:  flushPosition,
+		statusInterval: statusInterval,
 	}
 }
 
-// StartReplication starts reading from the replication slot
-// NOTE: This is a placeholder - proper replication requires pglogrepl library
+// StartReplication starts streaming from the replication slot using the pgoutput
+// plugin. Protocol version 2 with streaming lets the server send large
+// transactions while they are still in progress instead of buffering them.
 func (r *WALReader) StartReplication(ctx context.Context, startLSN models.LSN) error {
-	// TODO: Implement proper replication using pglogrepl library
-	// For now, return an error indicating this is not yet implemented
-	return fmt.Errorf("WAL replication not yet fully implemented - requires pglogrepl library")
+	if err := r.spill.reset(); err != nil {
+		return err
+	}
+
+	publication := strings.ReplaceAll(r.cfg.Publication, "'", "''")
+	query := fmt.Sprintf(
+		"START_REPLICATION SLOT %s LOGICAL %s (proto_version '2', streaming 'on', publication_names '%s')",
+		r.slotName, startLSN, publication,
+	)
+
+	r.conn.Frontend().Send(&pgproto3.Query{String: query})
+	if err := r.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("failed to send START_REPLICATION: %w", err)
+	}
+
+	// Wait for the server to switch to COPY BOTH mode
+	for {
+		msg, err := r.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start replication: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("failed to start replication: %s (SQLSTATE %s)", msg.Message, msg.Code)
+		}
+	}
 }
 
-// ReadChanges reads WAL changes from the replication stream
-// NOTE: This is a placeholder - proper replication requires pgx/v5 replication API
-func (r *WALReader) ReadChanges(ctx context.Context, handler func(*WALChange) error) error {
-	// TODO: Implement proper replication message reading
-	// For now, return an error indicating this is not yet implemented
-	return fmt.Errorf("WAL replication reading not yet fully implemented - requires pglogrepl or similar library")
+// ReadChanges reads WAL changes from the replication stream until the context is
+// cancelled or the stream fails. Changes are passed to the handler one committed
+// transaction at a time. A standby status update is sent every status interval
+// and whenever the server requests one.
+func (r *WALReader) ReadChanges(ctx context.Context, handler TransactionHandler) error {
+	nextStatus := time.Now().Add(r.statusInterval)
+
+	for {
+		if !time.Now().Before(nextStatus) {
+			if err := r.SendStandbyStatus(ctx); err != nil {
+				return err
+			}
+			nextStatus = time.Now().Add(r.statusInterval)
+		}
+
+		recvCtx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := r.conn.ReceiveMessage(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return fmt.Errorf("failed to receive replication message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if err := r.processCopyData(ctx, msg.Data, handler); err != nil {
+				return err
+			}
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("replication stream error: %s (SQLSTATE %s)", msg.Message, msg.Code)
+		case *pgproto3.CopyDone:
+			return fmt.Errorf("replication stream closed by server")
+		}
+	}
 }
 
 // processCopyData processes COPY_DATA messages from the replication stream
-func (r *WALReader) processCopyData(ctx context.Context, data []byte, handler func(*WALChange) error) error {
+func (r *WALReader) processCopyData(ctx context.Context, data []byte, handler TransactionHandler) error {
 	if len(data) < 1 {
 		return nil
 	}
@@ -74,53 +221,37 @@ func (r *WALReader) processCopyData(ctx context.Context, data []byte, handler fu
 	}
 }
 
-// processWALData processes WAL data messages (pgoutput format)
-func (r *WALReader) processWALData(ctx context.Context, data []byte, handler func(*WALChange) error) error {
-	// Parse pgoutput format
-	// This is a simplified parser - pgoutput format is complex
-	// For production, consider using a library or more complete parser
-	
-	// Skip WAL header (24 bytes: LSN + timestamp)
-	if len(data) < 25 {
-		return nil
+// processWALData processes XLogData messages carrying pgoutput payloads
+func (r *WALReader) processWALData(ctx context.Context, data []byte, handler TransactionHandler) error {
+	// XLogData header: WAL start (8), WAL end (8), server clock (8)
+	if len(data) < 24 {
+		return fmt.Errorf("XLogData message too short: %d bytes", len(data))
 	}
 
-	// Extract LSN (first 8 bytes)
-	lsnBytes := data[0:8]
-	lsn := models.LSN(binary.BigEndian.Uint64(lsnBytes))
-
-	// Extract timestamp (next 8 bytes)
-	timestampBytes := data[8:16]
-	timestampMicros := int64(binary.BigEndian.Uint64(timestampBytes))
-	commitTime := time.Unix(0, timestampMicros*1000)
-
-	// Skip transaction ID (4 bytes)
-	// Remaining data contains the actual change data
-	changeData := data[25:]
+	lsn := models.LSN(binary.BigEndian.Uint64(data[0:8]))
+	if walEnd := models.LSN(binary.BigEndian.Uint64(data[8:16])); walEnd > r.receivedLSN {
+		r.receivedLSN = walEnd
+	}
 
-	// Parse pgoutput message
-	// This is simplified - actual pgoutput parsing is more complex
-	// For now, we'll need to implement proper pgoutput message parsing
-	// or use a library that handles it
-	
-	// Placeholder: parse basic INSERT/UPDATE/DELETE messages
-	// In production, you'd want to use a proper pgoutput parser
-	change, err := r.parsePgoutputMessage(changeData, lsn, commitTime)
+	committed, err := r.parsePgoutputMessage(lsn, data[24:])
 	if err != nil {
-		// Log error but continue processing
-		return nil
+		return fmt.Errorf("failed to decode WAL data at %s: %w", lsn, err)
 	}
 
-	if change != nil {
-		return handler(change)
+	if committed != nil {
+		defer committed.close()
+		return handler(committed)
 	}
 
 	return nil
 }
 
-// parsePgoutputMessage parses a pgoutput protocol message
-// This is a simplified implementation - full pgoutput parsing is complex
-func (r *WALReader) parsePgoutputMessage(data []byte, lsn models.LSN, commitTime time.Time) (*WALChange, error) {
+// parsePgoutputMessage parses a pgoutput protocol message sent at lsn.
+// Row changes are buffered until COMMIT, which returns the whole transaction.
+// Row changes of streamed transactions are spilled to disk until STREAM COMMIT,
+// which returns the transaction to be read back from its spill file.
+// Transactions without changes are not returned.
+func (r *WALReader) parsePgoutputMessage(lsn models.LSN, data []byte) (*Transaction, error) {
 	if len(data) < 1 {
 		return nil, nil
 	}
@@ -128,114 +259,264 @@ func (r *WALReader) parsePgoutputMessage(data []byte, lsn models.LSN, commitTime
 	msgType := data[0]
 	data = data[1:]
 
+	// Inside a stream block, data messages start with the XID of the (sub)transaction
+	var streamXID uint32
+	if r.stream != nil && strings.IndexByte("IUDRYTM", msgType) >= 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("streamed message %q too short", msgType)
+		}
+		streamXID = binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+
 	switch msgType {
-	case 'I': // INSERT
-		return r.parseInsert(data, lsn, commitTime)
-	case 'U': // UPDATE
-		return r.parseUpdate(data, lsn, commitTime)
-	case 'D': // DELETE
-		return r.parseDelete(data, lsn, commitTime)
+	case 'I', 'U', 'D': // INSERT, UPDATE, DELETE
+		if r.stream != nil {
+			// Decoded on commit with the layout in effect at lsn
+			return nil, r.stream.append(lsn, streamXID, msgType, data)
+		}
+		if r.txn == nil {
+			return nil, fmt.Errorf("row message outside of a transaction")
+		}
+		change, err := r.parseRowChange(lsn, msgType, data)
+		if err != nil {
+			return nil, err
+		}
+		change.XID = r.txn.xid
+		r.txn.changes = append(r.txn.changes, change)
+		return nil, nil
 	case 'B': // BEGIN
-		// Transaction begin, no change to process
+		begin, err := parseBeginMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		r.txn = &walTransaction{xid: begin.XID}
 		return nil, nil
 	case 'C': // COMMIT
-		// Transaction commit, no change to process
+		commit, err := parseCommitMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		if r.txn == nil {
+			return nil, fmt.Errorf("commit message without begin")
+		}
+		txn := &Transaction{LSN: models.LSN(commit.CommitLSN), XID: r.txn.xid, changes: r.txn.changes}
+		for _, change := range txn.changes {
+			change.LSN = txn.LSN
+			change.CommitTime = commit.CommitTime
+		}
+		r.txn = nil
+		if len(txn.changes) == 0 {
+			return nil, nil
+		}
+		return txn, nil
+	case 'S': // STREAM START
+		start, err := parseStreamStartMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		if r.stream != nil {
+			return nil, fmt.Errorf("stream start inside a stream block")
+		}
+		if r.stream, err = r.spill.start(start.XID, start.First); err != nil {
+			return nil, err
+		}
+		if start.First {
+			log.Printf("Spilling large in-progress transaction %d to %s", start.XID, r.spill.dir)
+		}
+		return nil, nil
+	case 'E': // STREAM STOP
+		r.stream = nil
+		return nil, nil
+	case 'c': // STREAM COMMIT
+		commit, err := parseStreamCommitMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		return r.commitStreamed(commit)
+	case 'A': // STREAM ABORT
+		abort, err := parseStreamAbortMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		// Layouts sent inside the aborted part of the stream never took effect
+		for _, rel := range r.spill.abort(abort.XID, abort.SubXID) {
+			r.relations.remove(rel.id, rel.lsn)
+		}
 		return nil, nil
 	case 'R': // RELATION
-		// Relation metadata, store for later use
+		rel, err := parseRelationMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		// Tuples keep decoding with the layout in effect at their LSN, so an
+		// ALTER TABLE does not break transactions that are still streaming
+		if change := r.relations.add(rel, lsn); change != nil {
+			log.Printf("Schema change on %s", change)
+		}
+		if r.stream != nil {
+			r.stream.relations = append(r.stream.relations, streamedRelation{id: rel.ID, lsn: lsn, xid: streamXID})
+		}
 		return nil, nil
 	default:
-		// Unknown message type
+		// Type, origin, truncate and logical messages are not needed for sync
 		return nil, nil
 	}
 }
 
-// parseInsert parses an INSERT message
-func (r *WALReader) parseInsert(data []byte, lsn models.LSN, commitTime time.Time) (*WALChange, error) {
-	// Simplified parsing - full implementation would need relation metadata
-	// For now, return a placeholder that indicates we need relation info
-	// In production, you'd track relation metadata from 'R' messages
-	
-	// This is a placeholder - actual implementation requires:
-	// 1. Relation metadata tracking
-	// 2. Proper column type parsing
-	// 3. Tuple data parsing
-	
-	return &WALChange{
-		LSN:       lsn,
-		Operation: "INSERT",
-		CommitTime: commitTime,
-		// Schema, Table, Columns would be populated from relation metadata
-	}, nil
-}
-
-// parseUpdate parses an UPDATE message
-func (r *WALReader) parseUpdate(data []byte, lsn models.LSN, commitTime time.Time) (*WALChange, error) {
-	// Similar to parseInsert, requires relation metadata
-	return &WALChange{
-		LSN:       lsn,
-		Operation: "UPDATE",
-		CommitTime: commitTime,
-	}, nil
-}
-
-// parseDelete parses a DELETE message
-func (r *WALReader) parseDelete(data []byte, lsn models.LSN, commitTime time.Time) (*WALChange, error) {
-	// Similar to parseInsert, requires relation metadata
-	return &WALChange{
-		LSN:       lsn,
-		Operation: "DELETE",
-		CommitTime: commitTime,
-	}, nil
-}
-
-// processKeepalive processes keepalive messages
+// commitStreamed returns a committed streamed transaction, whose spilled row
+// changes are decoded batch by batch as it is read, leaving out rolled back
+// subtransactions
+func (r *WALReader) commitStreamed(commit *streamCommitMessage) (*Transaction, error) {
+	spilled, err := r.spill.commit(commit.XID)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := r.cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	txn := &Transaction{LSN: models.LSN(commit.CommitLSN), XID: commit.XID, release: spilled.close}
+	txn.next = func() ([]*WALChange, error) {
+		messages, err := spilled.next(batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		changes := make([]*WALChange, 0, len(messages))
+		for _, msg := range messages {
+			change, err := r.parseRowChange(msg.LSN, msg.MsgType, msg.Data)
+			if err != nil {
+				return nil, err
+			}
+			change.LSN = txn.LSN
+			change.XID = commit.XID
+			change.CommitTime = commit.CommitTime
+			changes = append(changes, change)
+		}
+		return changes, nil
+	}
+	return txn, nil
+}
+
+// parseRowChange decodes an INSERT, UPDATE or DELETE message sent at lsn into a
+// WALChange using the relation layout in effect at that position
+func (r *WALReader) parseRowChange(lsn models.LSN, msgType byte, data []byte) (*WALChange, error) {
+	row, err := parseRowMessage(msgType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	tuple := row.NewTuple
+	if tuple == nil {
+		tuple = row.OldTuple
+	}
+	version, err := r.relations.forTuple(row.RelationID, lsn, len(tuple))
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		return nil, fmt.Errorf("no relation metadata for relation ID %d", row.RelationID)
+	}
+	rel := version.relation
+
+	change := &WALChange{
+		Schema: rel.Namespace,
+		Table:  rel.Name,
+		Key:    rel.keyColumns(),
+	}
+
+	switch msgType {
+	case 'I':
+		change.Operation = "INSERT"
+	case 'U':
+		change.Operation = "UPDATE"
+	case 'D':
+		change.Operation = "DELETE"
+	}
+
+	if row.NewTuple != nil {
+		if change.Columns, err = decodeTuple(rel, row.NewTuple, r.types); err != nil {
+			return nil, err
+		}
+	}
+	if row.OldTuple != nil {
+		if change.OldColumns, err = decodeTuple(rel, row.OldTuple, r.types); err != nil {
+			return nil, err
+		}
+	}
+
+	return change, nil
+}
+
+// processKeepalive processes primary keepalive messages
 func (r *WALReader) processKeepalive(ctx context.Context, data []byte) error {
-	if len(data) < 9 {
-		return nil
+	// Keepalive: server WAL end (8), server clock (8), reply requested (1)
+	if len(data) < 17 {
+		return fmt.Errorf("keepalive message too short: %d bytes", len(data))
 	}
 
-	// Extract server LSN (first 8 bytes)
-	serverLSNBytes := data[0:8]
-	serverLSN := models.LSN(binary.BigEndian.Uint64(serverLSNBytes))
+	// Everything up to the server's WAL end that was not sent is outside our publication
+	if serverWALEnd := models.LSN(binary.BigEndian.Uint64(data[0:8])); serverWALEnd > r.receivedLSN {
+		r.receivedLSN = serverWALEnd
+	}
 
-	// Send status update to acknowledge
-	// TODO: Implement proper status update sending via replication API
-	_ = r.createStandbyStatusUpdate(serverLSN)
-	return fmt.Errorf("keepalive processing not yet fully implemented")
+	if data[16] == 1 {
+		return r.SendStandbyStatus(ctx)
+	}
+	return nil
+}
+
+// SendStandbyStatus reports the received and flushed positions to the server.
+// The flushed position lets PostgreSQL recycle WAL retained by the slot.
+func (r *WALReader) SendStandbyStatus(ctx context.Context) error {
+	if r.flushPosition != nil {
+		flushLSN, err := r.flushPosition(ctx, r.receivedLSN)
+		if err != nil {
+			// Keep the connection alive but do not advance the slot
+			log.Printf("Failed to determine WAL flush position: %v", err)
+		} else {
+			if flushLSN > r.receivedLSN {
+				flushLSN = r.receivedLSN
+			}
+			if flushLSN > r.flushedLSN {
+				r.flushedLSN = flushLSN
+			}
+		}
+	}
+
+	status := createStandbyStatusUpdate(r.receivedLSN, r.flushedLSN, time.Now())
+	r.conn.Frontend().Send(&pgproto3.CopyData{Data: status})
+	if err := r.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("failed to send standby status update: %w", err)
+	}
+	return nil
 }
 
 // createStandbyStatusUpdate creates a standby status update message
-func (r *WALReader) createStandbyStatusUpdate(lsn models.LSN) []byte {
+func createStandbyStatusUpdate(written, flushed models.LSN, now time.Time) []byte {
 	// Standby status update format:
 	// Byte 1: 'r' (status update)
-	// Bytes 2-9: LSN (8 bytes, big-endian)
-	// Bytes 10-17: Flush LSN (8 bytes, big-endian)
-	// Bytes 18-21: Apply LSN (4 bytes, big-endian)
-	// Bytes 22-25: Timestamp (8 bytes, big-endian, microseconds since 2000-01-01)
-	
-	buf := make([]byte, 25)
+	// Bytes 2-9: Last WAL position received and written (8 bytes, big-endian)
+	// Bytes 10-17: Last WAL position flushed (8 bytes, big-endian)
+	// Bytes 18-25: Last WAL position applied (8 bytes, big-endian)
+	// Bytes 26-33: Client clock (8 bytes, microseconds since 2000-01-01)
+	// Byte 34: Reply requested (1 = immediately)
+	buf := make([]byte, 34)
 	buf[0] = 'r'
-	
-	// Write LSN
-	binary.BigEndian.PutUint64(buf[1:9], uint64(lsn))
-	
-	// Write Flush LSN (same as LSN for now)
-	binary.BigEndian.PutUint64(buf[9:17], uint64(lsn))
-	
-	// Write Apply LSN (same as LSN for now)
-	binary.BigEndian.PutUint32(buf[17:21], uint32(lsn>>32))
-	
-	// Write timestamp (microseconds since 2000-01-01)
-	epoch2000 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
-	micros := time.Since(epoch2000).Microseconds()
-	binary.BigEndian.PutUint64(buf[17:25], uint64(micros))
-	
+	binary.BigEndian.PutUint64(buf[1:9], uint64(written))
+	binary.BigEndian.PutUint64(buf[9:17], uint64(flushed))
+	binary.BigEndian.PutUint64(buf[17:25], uint64(flushed))
+	binary.BigEndian.PutUint64(buf[25:33], uint64(timeToPgTime(now)))
+	buf[33] = 0
+
 	return buf
 }
 
-// Close closes the replication connection
+// Close removes spilled transactions and closes the replication connection
 func (r *WALReader) Close(ctx context.Context) error {
+	r.spill.close()
 	if r.conn != nil {
 		return r.conn.Close(ctx)
 	}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestCreateStandbyStatusUpdate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	buf := createStandbyStatusUpdate(0x3000, 0x2000, now)
+
+	if len(buf) != 34 || buf[0] != 'r' {
+		t.Fatalf("unexpected status update header: len=%d type=%q", len(buf), buf[0])
+	}
+	if got := binary.BigEndian.Uint64(buf[1:9]); got != 0x3000 {
+		t.Errorf("written LSN = %X, want 3000", got)
+	}
+	if got := binary.BigEndian.Uint64(buf[9:17]); got != 0x2000 {
+		t.Errorf("flushed LSN = %X, want 2000", got)
+	}
+	if got := binary.BigEndian.Uint64(buf[17:25]); got != 0x2000 {
+		t.Errorf("applied LSN = %X, want 2000", got)
+	}
+	if got := pgTimeToTime(int64(binary.BigEndian.Uint64(buf[25:33]))); !got.Equal(now) {
+		t.Errorf("client clock = %v, want %v", got, now)
+	}
+	if buf[33] != 0 {
+		t.Errorf("reply requested = %d, want 0", buf[33])
+	}
+}
+
+func TestLimitToTransactions(t *testing.T) {
+	changes := []*WALChange{
+		{LSN: 0x100}, {LSN: 0x100},
+		{LSN: 0x200}, {LSN: 0x200}, {LSN: 0x200},
+		{LSN: 0x300},
+	}
+
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{limit: 0, want: 6},
+		{limit: 10, want: 6},
+		{limit: 2, want: 2},
+		{limit: 3, want: 2}, // second transaction does not fit
+		{limit: 5, want: 5},
+		{limit: 1, want: 2}, // first transaction is larger than the limit
+	}
+
+	for _, tt := range tests {
+		if got := len(limitToTransactions(changes, tt.limit)); got != tt.want {
+			t.Errorf("limitToTransactions(limit=%d) returned %d changes, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -19,106 +19,176 @@ type WALService struct {
 	pool          *pgxpool.Pool
 	slotManager   *database.ReplicationSlotManager
 	cfg           *config.WALConfig
+	types         *TypeDecoder
 	slotName      string
 	running       bool
-	stopChan      chan struct{}
+	cancel        context.CancelFunc
+	done          chan struct{} // Closed once the reader has stopped and closed its connection
+	lastCommitLSN models.LSN    // Commit LSN of the last transaction handed to the tracker
 }
 
-// NewWALService creates a new WAL service
-func NewWALService(db *database.DB, changeTracker *ChangeTracker, pool *pgxpool.Pool, slotManager *database.ReplicationSlotManager, cfg *config.WALConfig) (*WALService, error) {
-	slotName, err := slotManager.CreateReplicationSlot(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("failed to create replication slot: %w", err)
-	}
-
+// NewWALService creates a new WAL service streaming from slotName. The slot is
+// created when the service starts.
+func NewWALService(db *database.DB, changeTracker *ChangeTracker, pool *pgxpool.Pool, slotManager *database.ReplicationSlotManager, slotName string, cfg *config.WALConfig) *WALService {
 	return &WALService{
 		db:            db,
 		changeTracker: changeTracker,
 		pool:          pool,
 		slotManager:   slotManager,
 		cfg:           cfg,
+		types:         NewTypeDecoder(),
 		slotName:      slotName,
-		stopChan:      make(chan struct{}),
-	}, nil
+	}
+}
+
+// Types returns the decoder for column values, on which decoders for custom
+// types can be registered before the service is started
+func (ws *WALService) Types() *TypeDecoder {
+	return ws.types
 }
 
-// Start starts the WAL reading service
+// Start sets up the publication and the replication slot, then starts the WAL
+// reading service. Only the leader starts the service, so replicas do not race
+// each other creating them.
 func (ws *WALService) Start(ctx context.Context) error {
 	if ws.running {
 		return fmt.Errorf("WAL service already running")
 	}
 
+	if err := ws.setup(ctx); err != nil {
+		return err
+	}
+
 	ws.running = true
+	ctx, ws.cancel = context.WithCancel(ctx)
+	ws.done = make(chan struct{})
 
 	// Run WAL reader in background
-	go ws.runWALReader(ctx)
+	go func() {
+		defer close(ws.done)
+		ws.runWALReader(ctx)
+	}()
 
 	return nil
 }
 
-// Stop stops the WAL reading service
+// Stop stops the WAL reading service and waits until the replication
+// connection is closed, so a replica that steps down never streams alongside
+// the next leader
 func (ws *WALService) Stop() {
 	if !ws.running {
 		return
 	}
 
-	close(ws.stopChan)
+	ws.cancel()
+	<-ws.done
 	ws.running = false
 }
 
-// runWALReader runs the WAL reader loop
+// setup creates or reconciles the publication streamed by pgoutput, checks the
+// replica identity of its tables and creates the replication slot
+func (ws *WALService) setup(ctx context.Context) error {
+	if err := ws.slotManager.EnsurePublication(ctx); err != nil {
+		return fmt.Errorf("failed to set up publication: %w", err)
+	}
+	log.Printf("Created/verified publication: %s", ws.slotManager.GetPublicationName())
+
+	// Deletes must carry the routing columns to be sent to devices as tombstones
+	if err := ws.slotManager.EnsureReplicaIdentity(ctx); err != nil {
+		return fmt.Errorf("failed to set replica identity: %w", err)
+	}
+
+	if _, err := ws.slotManager.CreateReplicationSlot(ctx); err != nil {
+		return fmt.Errorf("failed to create replication slot: %w", err)
+	}
+	log.Printf("Created/verified replication slot: %s", ws.slotName)
+	return nil
+}
+
+// runWALReader keeps a replication stream open, reconnecting after failures.
+// read_interval is used as the delay between reconnect attempts.
 func (ws *WALService) runWALReader(ctx context.Context) {
-	readInterval, err := time.ParseDuration(ws.cfg.ReadInterval)
+	retryInterval, err := time.ParseDuration(ws.cfg.ReadInterval)
 	if err != nil {
-		readInterval = time.Second
+		retryInterval = time.Second
 	}
 
-	ticker := time.NewTicker(readInterval)
-	defer ticker.Stop()
-
 	for {
+		if err := ws.readWALChanges(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error reading WAL changes: %v", err)
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case <-ws.stopChan:
-			return
-		case <-ticker.C:
-			if err := ws.readWALChanges(ctx); err != nil {
-				log.Printf("Error reading WAL changes: %v", err)
-			}
+		case <-time.After(retryInterval):
 		}
 	}
 }
 
-// readWALChanges reads WAL changes and adds them to the change tracker
+// readWALChanges opens a replication connection and streams changes into the
+// change tracker until the stream fails or the context is cancelled
 func (ws *WALService) readWALChanges(ctx context.Context) error {
-	// Get a connection from the pool for replication
-	conn, err := ws.pool.Acquire(ctx)
+	conn, err := ws.slotManager.ConnectReplication(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to acquire connection: %w", err)
-	}
-	defer conn.Release()
-
-	// Create replication connection
-	// Note: This is a simplified implementation
-	// For production, you'd need a proper pgoutput parser
-	// or use a library like pglogrepl
-	
-	// For now, we'll use a query-based approach to get recent changes
-	// This is a fallback until full WAL parsing is implemented
-	return ws.readChangesViaQuery(ctx)
+		return err
+	}
+
+	// Resolved on every connect so types created while running are picked up
+	if err := ws.types.ResolveTypeNames(ctx, ws.db); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	reader := NewWALReader(conn, ws.slotName, ws.cfg, ws.flushPosition, ws.types)
+	defer reader.Close(context.Background())
+
+	startLSN, err := ws.GetStartLSN(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := reader.StartReplication(ctx, startLSN); err != nil {
+		return err
+	}
+	log.Printf("Streaming WAL changes from slot %s at %s", ws.slotName, startLSN)
+
+	return reader.ReadChanges(ctx, func(txn *Transaction) error {
+		commitLSN := txn.LSN
+		// After a reconnect the server resends transactions from the confirmed flush position
+		if commitLSN <= ws.lastCommitLSN {
+			return nil
+		}
+
+		// Stop the stream on failure so the transaction is replayed after reconnecting;
+		// queuing is idempotent, so devices never see it twice
+		if err := ws.changeTracker.AddTransactionBatches(ctx, txn); err != nil {
+			return fmt.Errorf("failed to track WAL transaction %d at %s: %w", txn.XID, commitLSN, err)
+		}
+		ws.lastCommitLSN = commitLSN
+		return nil
+	})
 }
 
-// readChangesViaQuery reads changes using a query (fallback method)
-// This is used until full WAL parsing is implemented
-func (ws *WALService) readChangesViaQuery(ctx context.Context) error {
-	// This is a placeholder - in production, you'd read from WAL
-	// For now, we'll rely on the polling method as fallback
-	// The WAL reader will be enhanced with proper pgoutput parsing
-	
-	// TODO: Implement proper WAL reading with pgoutput parser
-	// For now, return nil to allow the system to work with polling fallback
-	return nil
+// flushPosition returns the LSN every active device has acknowledged, so the
+// slot only releases WAL that no device still has to consume. Without any
+// active device nothing is waiting on the WAL read so far.
+func (ws *WALService) flushPosition(ctx context.Context, received models.LSN) (models.LSN, error) {
+	minLSNStr, err := ws.db.GetMinSyncedLSN(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get minimum synced LSN: %w", err)
+	}
+	if minLSNStr == nil {
+		return received, nil
+	}
+
+	minLSN, err := models.ParseLSN(*minLSNStr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse minimum synced LSN: %w", err)
+	}
+	if minLSN > received {
+		return received, nil
+	}
+	return minLSN, nil
 }
 
 // GetStartLSN gets the starting LSN for replication
@@ -0,0 +1,217 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"posduif/sync-engine/internal/models"
+)
+
+// spillStore keeps the row messages of in-progress transactions streamed with
+// pgoutput protocol v2. PostgreSQL streams a transaction once it outgrows
+// logical_decoding_work_mem, possibly in many chunks interleaved with other
+// transactions, and only then says whether it committed. The raw messages are
+// appended to one file per transaction and decoded when the commit arrives.
+type spillStore struct {
+	dir  string
+	txns map[uint32]*spilledTransaction // Top-level XID -> spill file
+}
+
+// spilledTransaction is the spill file of one streamed transaction
+type spilledTransaction struct {
+	file      *os.File
+	w         *bufio.Writer
+	count     int
+	aborted   map[uint32]bool    // Rolled back subtransactions
+	relations []streamedRelation // Relation layouts sent inside the stream
+}
+
+// streamedRelation is a relation message received inside a stream block.
+// Its layout is forgotten if the (sub)transaction it was sent for aborts.
+type streamedRelation struct {
+	id  uint32
+	lsn models.LSN
+	xid uint32
+}
+
+// spillReader reads back the surviving row messages of a committed transaction
+type spillReader struct {
+	store *spillStore
+	xid   uint32
+	txn   *spilledTransaction
+	r     *bufio.Reader
+}
+
+// spilledMessage is a row message read back from a spill file
+type spilledMessage struct {
+	LSN     models.LSN
+	XID     uint32 // XID of the (sub)transaction that made the change
+	MsgType byte
+	Data    []byte
+}
+
+func newSpillStore(dir string) *spillStore {
+	return &spillStore{dir: dir, txns: make(map[uint32]*spilledTransaction)}
+}
+
+// reset removes the spill files of a previous stream. The server streams
+// in-progress transactions again from their first chunk after a reconnect.
+func (s *spillStore) reset() error {
+	s.close()
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to clear spill directory: %w", err)
+	}
+	return nil
+}
+
+// start returns the spill file for a chunk of transaction xid, creating it for
+// the first chunk
+func (s *spillStore) start(xid uint32, first bool) (*spilledTransaction, error) {
+	txn := s.txns[xid]
+	if !first {
+		if txn == nil {
+			return nil, fmt.Errorf("stream of transaction %d continued without its first chunk", xid)
+		}
+		return txn, nil
+	}
+
+	if txn != nil {
+		s.remove(xid)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path(xid), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	txn = &spilledTransaction{file: file, w: bufio.NewWriter(file), aborted: make(map[uint32]bool)}
+	s.txns[xid] = txn
+	return txn, nil
+}
+
+// append writes a row message of subtransaction xid
+func (t *spilledTransaction) append(lsn models.LSN, xid uint32, msgType byte, data []byte) error {
+	// Record: LSN (8), XID (4), length (4), message type (1), message
+	var header [17]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(lsn))
+	binary.BigEndian.PutUint32(header[8:12], xid)
+	binary.BigEndian.PutUint32(header[12:16], uint32(len(data)))
+	header[16] = msgType
+
+	if _, err := t.w.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to spill change: %w", err)
+	}
+	if _, err := t.w.Write(data); err != nil {
+		return fmt.Errorf("failed to spill change: %w", err)
+	}
+	t.count++
+	return nil
+}
+
+// abort discards a rolled back transaction, or the changes of a rolled back
+// subtransaction. It returns the relation messages sent for what was rolled back.
+func (s *spillStore) abort(xid, subXID uint32) []streamedRelation {
+	txn := s.txns[xid]
+	if txn == nil {
+		return nil
+	}
+	if xid == subXID {
+		s.remove(xid)
+		return txn.relations
+	}
+
+	txn.aborted[subXID] = true
+	var aborted, kept []streamedRelation
+	for _, rel := range txn.relations {
+		if rel.xid == subXID {
+			aborted = append(aborted, rel)
+		} else {
+			kept = append(kept, rel)
+		}
+	}
+	txn.relations = kept
+	return aborted
+}
+
+// commit returns a reader for the row messages of a committed transaction.
+// The spill file is removed when the reader is closed.
+func (s *spillStore) commit(xid uint32) (*spillReader, error) {
+	txn := s.txns[xid]
+	if txn == nil {
+		return nil, fmt.Errorf("commit of streamed transaction %d that was never started", xid)
+	}
+
+	if err := txn.w.Flush(); err != nil {
+		s.remove(xid)
+		return nil, fmt.Errorf("failed to flush spill file: %w", err)
+	}
+	if _, err := txn.file.Seek(0, io.SeekStart); err != nil {
+		s.remove(xid)
+		return nil, fmt.Errorf("failed to rewind spill file: %w", err)
+	}
+	return &spillReader{store: s, xid: xid, txn: txn, r: bufio.NewReader(txn.file)}, nil
+}
+
+// next reads up to n more surviving row messages in stream order. It returns
+// none once the spill file is exhausted.
+func (sr *spillReader) next(n int) ([]spilledMessage, error) {
+	var messages []spilledMessage
+	var header [17]byte
+	for len(messages) < n {
+		if _, err := io.ReadFull(sr.r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read spill file: %w", err)
+		}
+
+		msg := spilledMessage{
+			LSN:     models.LSN(binary.BigEndian.Uint64(header[0:8])),
+			XID:     binary.BigEndian.Uint32(header[8:12]),
+			MsgType: header[16],
+			Data:    make([]byte, binary.BigEndian.Uint32(header[12:16])),
+		}
+		if _, err := io.ReadFull(sr.r, msg.Data); err != nil {
+			return nil, fmt.Errorf("failed to read spill file: %w", err)
+		}
+		if !sr.txn.aborted[msg.XID] {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// close removes the spill file of the transaction
+func (sr *spillReader) close() {
+	sr.store.remove(sr.xid)
+}
+
+// remove closes and deletes the spill file of a transaction
+func (s *spillStore) remove(xid uint32) {
+	txn := s.txns[xid]
+	if txn == nil {
+		return
+	}
+	delete(s.txns, xid)
+	txn.file.Close()
+	os.Remove(txn.file.Name())
+}
+
+// close removes the spill files of all transactions still in progress
+func (s *spillStore) close() {
+	for xid := range s.txns {
+		s.remove(xid)
+	}
+}
+
+func (s *spillStore) path(xid uint32) string {
+	return filepath.Join(s.dir, strconv.FormatUint(uint64(xid), 10)+".spill")
+}
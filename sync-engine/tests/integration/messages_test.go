@@ -14,6 +14,7 @@ import (
 	"posduif/sync-engine/internal/database"
 	"posduif/sync-engine/internal/models"
 	"posduif/sync-engine/internal/redis"
+	"posduif/sync-engine/internal/sync"
 )
 
 func TestCreateMessage(t *testing.T) {
@@ -43,7 +44,7 @@ func TestCreateMessage(t *testing.T) {
 	defer redisClient.Close()
 
 	publisher := redis.NewPublisher(redisClient.GetClient(), &config.Config{})
-	handler := handlers.NewMessagesHandler(db, publisher)
+	handler := handlers.NewMessagesHandler(db, publisher, sync.NewHLCClock("test", 0))
 
 	// Create authenticated request
 	req := httptest.NewRequest("POST", "/api/messages", bytes.NewBuffer([]byte(`{